@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/host/v3"
+)
+
+const (
+	// defaultSeriesOhms is the fixed resistor in the voltage divider, matching a 10k NTC
+	defaultSeriesOhms = 10000.0
+	// defaultVref is the supply voltage of the divider
+	defaultVref = 3.3
+	// defaultADS1115Addr is the I2C address of an ADS1115 with ADDR tied to ground
+	defaultADS1115Addr = 0x48
+	// adcSamples is the number of conversions used for each temperature update
+	adcSamples = 5
+)
+
+// ADC reads a channel of an analog to digital converter, returning the fraction of the
+// reference voltage present on the channel (0.0-1.0).
+type ADC interface {
+	Read(channel int) (float64, error)
+}
+
+// MCP3008 is a 10-bit, 8 channel SPI ADC.  It is ratiometric, the divider and the chip
+// share the same supply.
+type MCP3008 struct {
+	conn conn.Conn
+}
+
+// NewMCP3008 creates an MCP3008 on the given SPI connection
+func NewMCP3008(c conn.Conn) *MCP3008 {
+	return &MCP3008{conn: c}
+}
+
+// Read performs a single ended conversion on the given channel
+func (m *MCP3008) Read(channel int) (float64, error) {
+	if channel < 0 || channel > 7 {
+		return 0.0, fmt.Errorf("invalid MCP3008 channel %d", channel)
+	}
+	w := []byte{0x01, byte(0x80 | channel<<4), 0x00}
+	r := make([]byte, len(w))
+	if err := m.conn.Tx(w, r); err != nil {
+		return 0.0, err
+	}
+	value := int(r[1]&0x03)<<8 | int(r[2])
+	return float64(value) / 1023.0, nil
+}
+
+// ADS1115 is a 16-bit, 4 channel I2C ADC.  It measures against an internal reference, so the
+// supply voltage of the divider (vref) is needed to get a ratio.
+type ADS1115 struct {
+	conn conn.Conn
+	vref float64
+}
+
+// NewADS1115 creates an ADS1115 on the given I2C connection, vref is the divider supply
+func NewADS1115(c conn.Conn, vref float64) *ADS1115 {
+	return &ADS1115{conn: c, vref: vref}
+}
+
+const (
+	ads1115Conversion = 0x00
+	ads1115Config     = 0x01
+	ads1115Start      = 0x8000 // OS: begin a single conversion / conversion complete
+	ads1115Mux        = 0x4000 // MUX: single ended, AINx vs GND (channel in bits 12-13)
+	ads1115Gain       = 0x0200 // PGA: +/-4.096v
+	ads1115Single     = 0x0100 // MODE: single shot
+	ads1115Rate       = 0x0080 // DR: 128 samples per second
+	ads1115NoComp     = 0x0003 // COMP_QUE: comparator disabled
+	ads1115FullScale  = 4.096
+)
+
+// Read performs a single ended conversion on the given channel
+func (a *ADS1115) Read(channel int) (float64, error) {
+	if channel < 0 || channel > 3 {
+		return 0.0, fmt.Errorf("invalid ADS1115 channel %d", channel)
+	}
+	cfg := ads1115Start | ads1115Mux | channel<<12 | ads1115Gain | ads1115Single | ads1115Rate | ads1115NoComp
+	if err := a.conn.Tx([]byte{ads1115Config, byte(cfg >> 8), byte(cfg)}, nil); err != nil {
+		return 0.0, err
+	}
+	r := make([]byte, 2)
+	ready := false
+	for i := 0; i < 10 && !ready; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if err := a.conn.Tx([]byte{ads1115Config}, r); err != nil {
+			return 0.0, err
+		}
+		ready = r[0]&0x80 != 0
+	}
+	if !ready {
+		return 0.0, fmt.Errorf("ADS1115 conversion timed out")
+	}
+	if err := a.conn.Tx([]byte{ads1115Conversion}, r); err != nil {
+		return 0.0, err
+	}
+	volts := float64(int16(uint16(r[0])<<8|uint16(r[1]))) * ads1115FullScale / 32768.0
+	return volts / a.vref, nil
+}
+
+// dividerOhms returns the resistance of a thermistor between the ADC input and ground, with
+// seriesOhms between the input and the supply.
+func dividerOhms(ratio, seriesOhms float64) (float64, error) {
+	if ratio <= 0.0 || ratio >= 1.0 {
+		return 0.0, fmt.Errorf("reading(%0.4f) out of range, open or shorted thermistor", ratio)
+	}
+	return seriesOhms * ratio / (1.0 - ratio), nil
+}
+
+// ADCThermometer is a thermistor in a voltage divider read through an ADC
+type ADCThermometer struct {
+	name       string
+	mutex      sync.Mutex
+	adc        ADC
+	channel    int
+	seriesOhms float64
+	model      ThermistorModel
+	updated    time.Time
+	accessory  *accessory.Thermometer
+}
+
+// NewADCThermometer creates an ADCThermometer on the channel of an ADC
+func NewADCThermometer(name, manufacturer string, adc ADC, channel int, seriesOhms float64) *ADCThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -20.0, 100.0, 1.0)
+	if seriesOhms <= 0.0 {
+		seriesOhms = defaultSeriesOhms
+	}
+	return &ADCThermometer{
+		name:       name,
+		adc:        adc,
+		channel:    channel,
+		seriesOhms: seriesOhms,
+		model:      LegacyModel{},
+		updated:    time.Now().Add(-24 * time.Hour),
+		accessory:  acc,
+	}
+}
+
+// SetModel changes the ThermistorModel used to convert resistance to temperature
+func (t *ADCThermometer) SetModel(m ThermistorModel) {
+	t.model = m
+}
+
+// Name returns the name of the ADCThermometer
+func (t *ADCThermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory related to the ADCThermometer
+func (t *ADCThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate is not supported, the divider resistor is configured directly
+func (t *ADCThermometer) Calibrate(ohms float64) error {
+	return fmt.Errorf("not supported")
+}
+
+// Temperature returns the last temperature read from the ADCThermometer
+func (t *ADCThermometer) Temperature() float64 {
+	return t.accessory.TempSensor.CurrentTemperature.GetValue()
+}
+
+// Update reads the median of several conversions and updates the temperature
+func (t *ADCThermometer) Update() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	h := NewHistory(adcSamples)
+	var err error
+	for i := 0; i < adcSamples; i++ {
+		var ratio float64
+		ratio, err = t.adc.Read(t.channel)
+		if err == nil {
+			h.Push(ratio)
+		}
+	}
+	if h.Len() == 0 {
+		Info("%s Thermometer update failed: %v", t.name, err)
+		return err
+	}
+	ohms, err := dividerOhms(h.Median(), t.seriesOhms)
+	if err != nil {
+		Info("%s Thermometer update failed: %v", t.name, err)
+		return err
+	}
+	temp := t.model.Temperature(ohms)
+	Debug("Calculating temperature (%f) for %s: %f ohms", temp, t.name, ohms)
+	t.accessory.TempSensor.CurrentTemperature.SetValue(temp)
+	t.updated = time.Now()
+	return nil
+}
+
+// openADC opens the ADC described by a SensorConfig
+func openADC(sc *SensorConfig) (ADC, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, err
+	}
+	switch sc.Type {
+	case SensorMCP3008:
+		port, err := spireg.Open(sc.Bus)
+		if err != nil {
+			return nil, err
+		}
+		c, err := port.Connect(physic.MegaHertz, spi.Mode0, 8)
+		if err != nil {
+			return nil, err
+		}
+		return NewMCP3008(c), nil
+	case SensorADS1115:
+		bus, err := i2creg.Open(sc.Bus)
+		if err != nil {
+			return nil, err
+		}
+		addr := sc.Address
+		if addr == 0 {
+			addr = defaultADS1115Addr
+		}
+		vref := sc.Vref
+		if vref == 0.0 {
+			vref = defaultVref
+		}
+		return NewADS1115(&i2c.Dev{Bus: bus, Addr: addr}, vref), nil
+	}
+	return nil, fmt.Errorf("%s is not an ADC", sc.Type)
+}
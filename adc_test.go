@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"periph.io/x/conn/v3"
+)
+
+// fakeSPI answers MCP3008 conversions with a fixed 10-bit value per channel
+type fakeSPI struct {
+	values [8]int
+}
+
+func (f *fakeSPI) String() string      { return "fakeSPI" }
+func (f *fakeSPI) Duplex() conn.Duplex { return conn.Full }
+
+func (f *fakeSPI) Tx(w, r []byte) error {
+	if len(w) != 3 || len(r) != 3 || w[0] != 0x01 || w[1]&0x80 == 0 {
+		return errors.New("bad MCP3008 command")
+	}
+	v := f.values[(w[1]>>4)&0x07]
+	r[0], r[1], r[2] = 0, byte(v>>8)&0x03, byte(v)
+	return nil
+}
+
+// fakeI2C answers ADS1115 register reads, with a fixed conversion result per channel
+type fakeI2C struct {
+	values [4]int16
+	config uint16
+}
+
+func (f *fakeI2C) String() string      { return "fakeI2C" }
+func (f *fakeI2C) Duplex() conn.Duplex { return conn.Half }
+
+func (f *fakeI2C) Tx(w, r []byte) error {
+	switch {
+	case len(w) == 3 && w[0] == ads1115Config:
+		f.config = uint16(w[1])<<8 | uint16(w[2])
+	case len(w) == 1 && w[0] == ads1115Config:
+		r[0], r[1] = byte(f.config>>8)|0x80, byte(f.config)
+	case len(w) == 1 && w[0] == ads1115Conversion:
+		v := f.values[(f.config>>12)&0x03]
+		r[0], r[1] = byte(uint16(v)>>8), byte(v)
+	default:
+		return errors.New("bad ADS1115 command")
+	}
+	return nil
+}
+
+func TestADC(t *testing.T) {
+	t.Run("MCP3008", func(t *testing.T) {
+		bus := &fakeSPI{}
+		bus.values[2] = 1023
+		bus.values[3] = 512
+		adc := NewMCP3008(bus)
+		v, err := adc.Read(2)
+		assert.NoError(t, err)
+		assert.InDelta(t, 1.0, v, 0.0001)
+		v, err = adc.Read(3)
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.5, v, 0.001)
+		_, err = adc.Read(8)
+		assert.Error(t, err)
+	})
+
+	t.Run("ADS1115", func(t *testing.T) {
+		bus := &fakeI2C{}
+		bus.values[1] = 12890 // 1.611v
+		adc := NewADS1115(bus, 3.3)
+		v, err := adc.Read(1)
+		assert.NoError(t, err)
+		assert.InDelta(t, 1.611/3.3, v, 0.001)
+		_, err = adc.Read(4)
+		assert.Error(t, err)
+	})
+
+	t.Run("Divider", func(t *testing.T) {
+		ohms, err := dividerOhms(0.5, 10000.0)
+		assert.NoError(t, err)
+		assert.InDelta(t, 10000.0, ohms, 0.001)
+		ohms, err = dividerOhms(0.25, 10000.0)
+		assert.NoError(t, err)
+		assert.InDelta(t, 3333.333, ohms, 0.001)
+		_, err = dividerOhms(0.0, 10000.0)
+		assert.Error(t, err, "Shorted thermistor")
+		_, err = dividerOhms(1.0, 10000.0)
+		assert.Error(t, err, "Open thermistor")
+	})
+}
+
+func TestADCThermometer(t *testing.T) {
+	bus := &fakeSPI{}
+	bus.values[0] = 512
+	therm := NewADCThermometer("Test", mftr, NewMCP3008(bus), 0, 0.0)
+
+	assert.NoError(t, therm.Update())
+	ohms, _ := dividerOhms(512.0/1023.0, defaultSeriesOhms)
+	assert.InDelta(t, LegacyModel{}.Temperature(ohms), therm.Temperature(), 0.01)
+
+	bus.values[0] = 0
+	assert.Error(t, therm.Update(), "Shorted thermistor")
+	assert.InDelta(t, LegacyModel{}.Temperature(ohms), therm.Temperature(), 0.01, "Last good value kept")
+}
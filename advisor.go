@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// advisorBand is how close (in C) to the target the pool must be to count as "in band"
+	advisorBand = 1.0
+	// advisorBucket is the width (in C) of the roof/water difference buckets
+	advisorBucket = 2.0
+	// advisorStep is the resolution used when reading history from the RRDs
+	advisorStep = 5 * time.Minute
+	// advisorDays is the amount of history analyzed
+	advisorDays = 14
+)
+
+var (
+	advisorDeltaTs    = []float64{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	advisorTolerances = []float64{0.25, 0.5, 0.75, 1.0, 1.5}
+)
+
+// TuningSample is a single point of recorded history used by the TuningAdvisor
+type TuningSample struct {
+	Time  time.Time
+	Water float64
+	Roof  float64
+	State State
+}
+
+// GainBucket holds the measured change in water temperature while running solar for a
+// given range of roof/water differences.
+type GainBucket struct {
+	MinDiff float64
+	MaxDiff float64
+	Hours   float64 // hours of solar operation observed
+	Rate    float64 // C per hour
+}
+
+// TuningCandidate is the simulated outcome of a DeltaT/Tolerance pair
+type TuningCandidate struct {
+	DeltaT    float64
+	Tolerance float64
+	PumpHours float64
+	InBand    float64 // fraction of the time the pool was within advisorBand of the target
+}
+
+// TuningRecommendation is the result of analyzing the history
+type TuningRecommendation struct {
+	Generated  time.Time
+	From       time.Time
+	To         time.Time
+	Samples    int
+	Passive    float64 // C per hour while the pumps are off
+	Buckets    []GainBucket
+	Current    TuningCandidate
+	Best       TuningCandidate
+	Candidates []TuningCandidate
+}
+
+// TuningAdvisor mines the recorded temperatures and pump states to recommend DeltaT and
+// Tolerance values.
+type TuningAdvisor struct {
+	mtx     sync.Mutex
+	tempRrd *Rrd
+	pumpRrd *Rrd
+	running bool
+	last    *TuningRecommendation
+	err     error
+}
+
+// NewTuningAdvisor creates a TuningAdvisor that reads from the given RRDs
+func NewTuningAdvisor(tempRrd, pumpRrd *Rrd) *TuningAdvisor {
+	return &TuningAdvisor{
+		tempRrd: tempRrd,
+		pumpRrd: pumpRrd,
+	}
+}
+
+// Last returns the most recent recommendation and the error from the most recent run
+func (a *TuningAdvisor) Last() (*TuningRecommendation, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.last, a.err
+}
+
+// Run reads the history and produces a new recommendation.  Only one run happens at a time.
+func (a *TuningAdvisor) Run(cfg *PersistedConfig) {
+	a.mtx.Lock()
+	if a.running {
+		a.mtx.Unlock()
+		return
+	}
+	a.running = true
+	a.mtx.Unlock()
+
+	end := time.Now()
+	start := end.Add(-advisorDays * 24 * time.Hour)
+	var rec *TuningRecommendation
+	samples, err := a.history(start, end)
+	if err == nil {
+		rec, err = AnalyzeTuning(samples, cfg)
+	}
+	if err != nil {
+		Error("Tuning analysis failed: %v", err)
+	} else {
+		Info("Tuning analysis: DeltaT(%0.2f) Tolerance(%0.2f) PumpHours(%0.1f) InBand(%0.2f)",
+			rec.Best.DeltaT, rec.Best.Tolerance, rec.Best.PumpHours, rec.Best.InBand)
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.running = false
+	a.err = err
+	if rec != nil {
+		a.last = rec
+	}
+}
+
+func (a *TuningAdvisor) history(start, end time.Time) ([]TuningSample, error) {
+	temps, err := a.tempRrd.Fetch(start, end, advisorStep)
+	if err != nil {
+		return nil, fmt.Errorf("could not read temperatures: %w", err)
+	}
+	defer temps.FreeValues()
+	pumps, err := a.pumpRrd.Fetch(start, end, advisorStep)
+	if err != nil {
+		return nil, fmt.Errorf("could not read pump status: %w", err)
+	}
+	defer pumps.FreeValues()
+
+	pool := dsIndex(temps.DsNames, "pool")
+	roof := dsIndex(temps.DsNames, "roof")
+	status := dsIndex(pumps.DsNames, "status")
+	if pool < 0 || roof < 0 || status < 0 {
+		return nil, fmt.Errorf("missing data sources")
+	}
+
+	samples := []TuningSample{}
+	for row := 0; row < temps.RowCnt; row++ {
+		tm := temps.Start.Add(time.Duration(row) * temps.Step)
+		prow := int(tm.Sub(pumps.Start) / pumps.Step)
+		if prow < 0 || prow >= pumps.RowCnt {
+			continue
+		}
+		s := TuningSample{
+			Time:  tm,
+			Water: temps.ValueAt(pool, row),
+			Roof:  temps.ValueAt(roof, row),
+			State: State(math.Floor(pumps.ValueAt(status, prow))),
+		}
+		if math.IsNaN(s.Water) || math.IsNaN(s.Roof) ||
+			math.IsNaN(pumps.ValueAt(status, prow)) {
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+func dsIndex(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func bucketIndex(diff float64) int {
+	return int(math.Floor(diff / advisorBucket))
+}
+
+// AnalyzeTuning measures the heat gain from the samples and simulates each candidate
+// DeltaT/Tolerance pair against the recorded roof temperatures.  The recommendation is the
+// candidate with the fewest pump hours that keeps the pool in band at least as well as the
+// current settings.
+func AnalyzeTuning(samples []TuningSample, cfg *PersistedConfig) (*TuningRecommendation, error) {
+	if len(samples) < 2 {
+		return nil, fmt.Errorf("not enough history to analyze (%d samples)", len(samples))
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	maxGap := 3 * advisorStep
+
+	gains := map[int]*GainBucket{}
+	passiveChange, passiveHours := 0.0, 0.0
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		gap := b.Time.Sub(a.Time)
+		if gap <= 0 || gap > maxGap {
+			continue
+		}
+		dt := gap.Hours()
+		change := b.Water - a.Water
+		switch {
+		case a.State >= SOLAR && b.State >= SOLAR:
+			idx := bucketIndex(a.Roof - a.Water)
+			g, ok := gains[idx]
+			if !ok {
+				g = &GainBucket{
+					MinDiff: float64(idx) * advisorBucket,
+					MaxDiff: float64(idx+1) * advisorBucket,
+				}
+				gains[idx] = g
+			}
+			// Rate holds the total change until the buckets are finalized below
+			g.Rate += change
+			g.Hours += dt
+		case a.State == OFF:
+			passiveChange += change
+			passiveHours += dt
+		}
+	}
+
+	rec := TuningRecommendation{
+		Generated: time.Now(),
+		From:      samples[0].Time,
+		To:        samples[len(samples)-1].Time,
+		Samples:   len(samples),
+	}
+	if passiveHours > 0 {
+		rec.Passive = passiveChange / passiveHours
+	}
+	keys := []int{}
+	for k := range gains {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		g := gains[k]
+		g.Rate = g.Rate / g.Hours
+		rec.Buckets = append(rec.Buckets, *g)
+	}
+	if len(rec.Buckets) == 0 {
+		return nil, fmt.Errorf("no solar operation found in the history")
+	}
+
+	rec.Current = simulateTuning(samples, cfg, cfg.DeltaT, cfg.Tolerance, rec.Buckets, rec.Passive)
+	rec.Best = rec.Current
+	for _, d := range advisorDeltaTs {
+		for _, tol := range advisorTolerances {
+			c := simulateTuning(samples, cfg, d, tol, rec.Buckets, rec.Passive)
+			rec.Candidates = append(rec.Candidates, c)
+			if c.InBand < rec.Current.InBand-0.01 {
+				continue
+			}
+			if c.PumpHours < rec.Best.PumpHours ||
+				(c.PumpHours == rec.Best.PumpHours && c.InBand > rec.Best.InBand) {
+				rec.Best = c
+			}
+		}
+	}
+	return &rec, nil
+}
+
+// gainRate finds the measured rate for a roof/water difference, using the closest bucket
+// with evidence when there is no exact match.
+func gainRate(buckets []GainBucket, diff float64) float64 {
+	best := -1
+	bestDist := math.MaxFloat64
+	for i, b := range buckets {
+		if diff >= b.MinDiff && diff < b.MaxDiff {
+			return b.Rate
+		}
+		dist := math.Min(math.Abs(diff-b.MinDiff), math.Abs(diff-b.MaxDiff))
+		if dist < bestDist {
+			best = i
+			bestDist = dist
+		}
+	}
+	if best < 0 {
+		return 0.0
+	}
+	return buckets[best].Rate
+}
+
+func simulateTuning(samples []TuningSample, cfg *PersistedConfig, deltaT, tolerance float64,
+	buckets []GainBucket, passive float64) TuningCandidate {
+	c := TuningCandidate{DeltaT: deltaT, Tolerance: tolerance}
+	sim := *cfg
+	sim.DeltaT = deltaT
+	sim.Tolerance = tolerance
+	sim.SolarDisabled = false
+
+	water := samples[0].Water
+	total, inBand := 0.0, 0.0
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		dt := b.Time.Sub(a.Time).Hours()
+		if dt <= 0 || dt > (3*advisorStep).Hours() {
+			water = b.Water // resynchronize after a gap in the history
+			continue
+		}
+		if warmingHelps(&sim, water, a.Roof) || coolingHelps(&sim, water, a.Roof) {
+			water += gainRate(buckets, a.Roof-water) * dt
+			c.PumpHours += dt
+		} else {
+			water += passive * dt
+		}
+		total += dt
+		if math.Abs(water-cfg.Target) <= advisorBand {
+			inBand += dt
+		}
+	}
+	if total > 0 {
+		c.InBand = inBand / total
+	}
+	return c
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tuningHistory creates alternating hours of solar heating and idle time
+func tuningHistory(hours int) []TuningSample {
+	samples := []TuningSample{}
+	start := time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local)
+	water := 25.0
+	for i := 0; i < hours*12; i++ {
+		tm := start.Add(time.Duration(i) * advisorStep)
+		state := OFF
+		roof := water - 5.0
+		if (i/12)%2 == 0 {
+			state = SOLAR
+			roof = water + 11.0
+			water += 0.1 // 1.2C per hour
+		} else if i%12 == 11 {
+			water -= 0.6 // the pool cooled while the pumps were off
+		}
+		samples = append(samples, TuningSample{Time: tm, Water: water, Roof: roof, State: state})
+	}
+	return samples
+}
+
+func TestAnalyzeTuning(t *testing.T) {
+	cfg := &PersistedConfig{Target: 30.0, DeltaT: 12.0, Tolerance: 0.5}
+
+	t.Run("NotEnoughHistory", func(t *testing.T) {
+		_, err := AnalyzeTuning([]TuningSample{}, cfg)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("NoSolar", func(t *testing.T) {
+		samples := tuningHistory(4)
+		for i := range samples {
+			samples[i].State = OFF
+		}
+		_, err := AnalyzeTuning(samples, cfg)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Recommends", func(t *testing.T) {
+		rec, err := AnalyzeTuning(tuningHistory(48), cfg)
+		assert.Nil(t, err)
+		if !assert.NotNil(t, rec) {
+			return
+		}
+		assert.Equal(t, 48*12, rec.Samples)
+		assert.InDelta(t, 1.2, gainRate(rec.Buckets, 11.0), 0.01)
+		assert.InDelta(t, -0.5, rec.Passive, 0.02)
+		assert.True(t, rec.Best.PumpHours <= rec.Current.PumpHours)
+		assert.True(t, rec.Best.InBand >= rec.Current.InBand-0.01)
+		assert.Equal(t, len(advisorDeltaTs)*len(advisorTolerances), len(rec.Candidates))
+	})
+}
+
+func TestGainRate(t *testing.T) {
+	buckets := []GainBucket{
+		{MinDiff: 4, MaxDiff: 6, Rate: 0.5},
+		{MinDiff: 10, MaxDiff: 12, Rate: 1.5},
+	}
+	assert.Equal(t, 0.5, gainRate(buckets, 5.0))
+	assert.Equal(t, 1.5, gainRate(buckets, 11.0))
+	assert.Equal(t, 1.5, gainRate(buckets, 20.0), "Closest bucket should be used")
+	assert.Equal(t, 0.5, gainRate(buckets, 0.0), "Closest bucket should be used")
+	assert.Equal(t, 0.0, gainRate([]GainBucket{}, 5.0))
+}
+
+func TestTuningHandler(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	cfg := trp.ppc.config.cfg
+	deltaT, tolerance := cfg.DeltaT, cfg.Tolerance
+	defer func() {
+		cfg.DeltaT, cfg.Tolerance = deltaT, tolerance
+		trp.ppc.config.Save()
+	}()
+	trp.ppc.advisor.last = &TuningRecommendation{Best: TuningCandidate{DeltaT: 8.0, Tolerance: 0.3}}
+	h := Handler{ppc: trp.ppc}
+	request := func(method, target string, auth bool) int {
+		r := httptest.NewRequest(method, target, nil)
+		if auth {
+			r.SetBasicAuth("admin", defaultPin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, 200, request("GET", "/tuning", false))
+	assert.Equal(t, 401, request("GET", "/tuning?refresh=true", false))
+	assert.Equal(t, 401, request("POST", "/tuning?apply=true", false))
+	assert.Equal(t, 405, request("GET", "/tuning?apply=true", true), "A link can't apply it")
+	assert.Equal(t, deltaT, cfg.DeltaT)
+	assert.Equal(t, 405, request("GET", "/tuning?refresh=true", true))
+
+	assert.Equal(t, 200, request("POST", "/tuning?apply=true", true))
+	assert.Equal(t, 8.0, cfg.DeltaT)
+	assert.Equal(t, 0.3, cfg.Tolerance)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxAlerts is the number of AlertEvents kept for display
+const maxAlerts = 50
+
+// AlertEvent is a notable event that should be brought to the attention of the user
+type AlertEvent struct {
+	Time    time.Time
+	Source  string
+	Message string
+}
+
+// Alerts keeps the recent AlertEvents so they can be shown in the web UI
+type Alerts struct {
+	mtx    sync.Mutex
+	events []AlertEvent
+}
+
+// NewAlerts creates an empty set of Alerts
+func NewAlerts() *Alerts {
+	return &Alerts{}
+}
+
+func (a *Alerts) add(source, message string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.events = append(a.events, AlertEvent{Time: time.Now(), Source: source, Message: message})
+	if len(a.events) > maxAlerts {
+		a.events = a.events[len(a.events)-maxAlerts:]
+	}
+}
+
+// Raise records an alert and sends it to syslog at the Alert level
+func (a *Alerts) Raise(source, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	Alert("%s: %s", source, message)
+	a.add(source, message)
+}
+
+// Recent returns up to n of the most recent events, newest first
+func (a *Alerts) Recent(n int) []AlertEvent {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	out := []AlertEvent{}
+	for i := len(a.events) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, a.events[i])
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/host/v3"
+)
+
+const (
+	// defaultBME280Addr is the I2C address of a BME280 with SDO tied to ground
+	defaultBME280Addr = 0x76
+
+	bme280ChipID     = 0xD0
+	bme280Calib      = 0x88
+	bme280Status     = 0xF3
+	bme280CtrlMeas   = 0xF4
+	bme280Temp       = 0xFA
+	bme280Measuring  = 0x08
+	bme280Forced     = 0x21 // temperature oversampling x1, forced mode, pressure skipped
+	bme280ID         = 0x60
+	bmp280ID         = 0x58 // the BMP280 shares the temperature registers
+	bme280ReadyPolls = 10
+)
+
+// bme280Calibration holds the factory temperature trimming parameters of a BME280
+type bme280Calibration struct {
+	t1 uint16
+	t2 int16
+	t3 int16
+}
+
+// temperature compensates a raw 20 bit reading, returning degrees celsius
+func (c *bme280Calibration) temperature(raw int32) float64 {
+	adc := float64(raw)
+	t1 := float64(c.t1)
+	var1 := (adc/16384.0 - t1/1024.0) * float64(c.t2)
+	var2 := (adc/131072.0 - t1/8192.0) * (adc/131072.0 - t1/8192.0) * float64(c.t3)
+	return (var1 + var2) / 5120.0
+}
+
+// BME280Thermometer reads the temperature from a Bosch BME280 (or BMP280) over I2C
+type BME280Thermometer struct {
+	name      string
+	mutex     sync.Mutex
+	conn      conn.Conn
+	calib     *bme280Calibration
+	updated   time.Time
+	accessory *accessory.Thermometer
+}
+
+// NewBME280Thermometer creates a BME280Thermometer on the given I2C connection
+func NewBME280Thermometer(name, manufacturer string, c conn.Conn) *BME280Thermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -40.0, 85.0, 1.0)
+	return &BME280Thermometer{
+		name:      name,
+		conn:      c,
+		updated:   time.Now().Add(-24 * time.Hour),
+		accessory: acc,
+	}
+}
+
+// Name returns the name of the BME280Thermometer
+func (t *BME280Thermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory related to the BME280Thermometer
+func (t *BME280Thermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate is not needed, the BME280 is factory calibrated
+func (t *BME280Thermometer) Calibrate(a float64) error {
+	return errors.New("not supported")
+}
+
+// Temperature returns the last temperature read from the BME280Thermometer
+func (t *BME280Thermometer) Temperature() float64 {
+	return t.accessory.TempSensor.CurrentTemperature.GetValue()
+}
+
+// readCalibration checks the chip id and reads the trimming parameters
+func (t *BME280Thermometer) readCalibration() error {
+	id := make([]byte, 1)
+	if err := t.conn.Tx([]byte{bme280ChipID}, id); err != nil {
+		return err
+	}
+	if id[0] != bme280ID && id[0] != bmp280ID {
+		return fmt.Errorf("unexpected BME280 chip id 0x%02x", id[0])
+	}
+	r := make([]byte, 6)
+	if err := t.conn.Tx([]byte{bme280Calib}, r); err != nil {
+		return err
+	}
+	t.calib = &bme280Calibration{
+		t1: uint16(r[1])<<8 | uint16(r[0]),
+		t2: int16(uint16(r[3])<<8 | uint16(r[2])),
+		t3: int16(uint16(r[5])<<8 | uint16(r[4])),
+	}
+	return nil
+}
+
+// Update triggers a forced conversion and reads the temperature
+func (t *BME280Thermometer) Update() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.calib == nil {
+		if err := t.readCalibration(); err != nil {
+			return fmt.Errorf("%s thermometer: %w", t.name, err)
+		}
+	}
+	if err := t.conn.Tx([]byte{bme280CtrlMeas, bme280Forced}, nil); err != nil {
+		return fmt.Errorf("%s thermometer: %w", t.name, err)
+	}
+	status := make([]byte, 1)
+	ready := false
+	for i := 0; i < bme280ReadyPolls && !ready; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if err := t.conn.Tx([]byte{bme280Status}, status); err != nil {
+			return fmt.Errorf("%s thermometer: %w", t.name, err)
+		}
+		ready = status[0]&bme280Measuring == 0
+	}
+	if !ready {
+		return fmt.Errorf("%s thermometer: BME280 conversion timed out", t.name)
+	}
+	r := make([]byte, 3)
+	if err := t.conn.Tx([]byte{bme280Temp}, r); err != nil {
+		return fmt.Errorf("%s thermometer: %w", t.name, err)
+	}
+	raw := int32(r[0])<<12 | int32(r[1])<<4 | int32(r[2])>>4
+	if raw == 0x80000 {
+		return fmt.Errorf("%s thermometer: BME280 temperature measurement skipped", t.name)
+	}
+	temp := t.calib.temperature(raw)
+	Debug("Calculating temperature (%f) for %s: raw %d", temp, t.name, raw)
+	t.accessory.TempSensor.CurrentTemperature.SetValue(temp)
+	t.updated = time.Now()
+	return nil
+}
+
+// openBME280 opens the I2C connection to the BME280 described by a SensorConfig
+func openBME280(sc *SensorConfig) (conn.Conn, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, err
+	}
+	bus, err := i2creg.Open(sc.Bus)
+	if err != nil {
+		return nil, err
+	}
+	addr := sc.Address
+	if addr == 0 {
+		addr = defaultBME280Addr
+	}
+	return &i2c.Dev{Bus: bus, Addr: addr}, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"periph.io/x/conn/v3"
+)
+
+// fakeBME280 answers register reads with the example calibration from the datasheet
+type fakeBME280 struct {
+	id  byte
+	raw int32
+}
+
+func (f *fakeBME280) String() string      { return "fakeBME280" }
+func (f *fakeBME280) Duplex() conn.Duplex { return conn.Half }
+
+func (f *fakeBME280) Tx(w, r []byte) error {
+	switch {
+	case len(w) == 1 && w[0] == bme280ChipID:
+		r[0] = f.id
+	case len(w) == 1 && w[0] == bme280Calib:
+		copy(r, []byte{0x70, 0x6b, 0x43, 0x67, 0x18, 0xfc}) // 27504, 26435, -1000
+	case len(w) == 2 && w[0] == bme280CtrlMeas:
+	case len(w) == 1 && w[0] == bme280Status:
+		r[0] = 0
+	case len(w) == 1 && w[0] == bme280Temp:
+		r[0], r[1], r[2] = byte(f.raw>>12), byte(f.raw>>4), byte(f.raw<<4)
+	default:
+		return errors.New("bad BME280 command")
+	}
+	return nil
+}
+
+func TestBME280Thermometer(t *testing.T) {
+	bus := &fakeBME280{id: bme280ID, raw: 519888}
+	therm := NewBME280Thermometer("Air", mftr, bus)
+	assert.NoError(t, therm.Update())
+	assert.InDelta(t, 25.08, therm.Temperature(), 0.01)
+	assert.Error(t, therm.Calibrate(1000.0))
+
+	bus.raw = 0x80000
+	assert.Error(t, therm.Update(), "Skipped measurement")
+
+	therm = NewBME280Thermometer("Air", mftr, &fakeBME280{id: 0x55})
+	assert.Error(t, therm.Update(), "Wrong chip")
+}
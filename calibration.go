@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+)
+
+// CalibrationPoint is a reading from a probe taken alongside a reference thermometer
+type CalibrationPoint struct {
+	Time      time.Time
+	Raw       float64 // temperature reported by the probe before correction
+	Reference float64 // temperature from the reference thermometer
+}
+
+// ProbeCalibration corrects the readings of a probe: Gain * raw + Offset.  Points holds the
+// readings used to fit the correction, Previous is kept so a bad fit can be rolled back.
+type ProbeCalibration struct {
+	Points   []CalibrationPoint
+	Gain     float64
+	Offset   float64
+	Residual float64 // root mean square error of the fit against Points
+	Fitted   time.Time
+	Previous *ProbeCalibration `json:",omitempty"`
+}
+
+// Correct applies the calibration to a raw reading, a nil or unfitted calibration changes nothing
+func (pc *ProbeCalibration) Correct(raw float64) float64 {
+	if pc == nil || pc.Gain == 0.0 {
+		return raw
+	}
+	return pc.Gain*raw + pc.Offset
+}
+
+// FitCalibration fits a gain and offset to the points with least squares.  A single point (or
+// points all at the same raw temperature) only determines an offset.
+func FitCalibration(points []CalibrationPoint) (*ProbeCalibration, error) {
+	n := float64(len(points))
+	if n == 0 {
+		return nil, errors.New("no calibration points")
+	}
+	var sx, sy, sxx, sxy float64
+	for _, p := range points {
+		sx += p.Raw
+		sy += p.Reference
+		sxx += p.Raw * p.Raw
+		sxy += p.Raw * p.Reference
+	}
+	gain := 1.0
+	offset := (sy - sx) / n
+	if d := n*sxx - sx*sx; n > 1 && d > 1e-6*n*n {
+		gain = (n*sxy - sx*sy) / d
+		offset = (sy - gain*sx) / n
+	}
+	if gain < 0.5 || gain > 2.0 {
+		return nil, fmt.Errorf("calibration gain(%0.3f) is implausible, check the points", gain)
+	}
+	pc := &ProbeCalibration{
+		Points: append([]CalibrationPoint(nil), points...),
+		Gain:   gain,
+		Offset: offset,
+		Fitted: time.Now(),
+	}
+	var sse float64
+	for _, p := range points {
+		e := pc.Correct(p.Raw) - p.Reference
+		sse += e * e
+	}
+	pc.Residual = math.Sqrt(sse / n)
+	return pc, nil
+}
+
+// thermometerWrapper is implemented by thermometers that add behavior to another Thermometer
+type thermometerWrapper interface {
+	Unwrap() Thermometer
+}
+
+// findThermometer looks through any wrappers for a Thermometer that matches
+func findThermometer(t Thermometer, match func(Thermometer) bool) Thermometer {
+	for t != nil {
+		if match(t) {
+			return t
+		}
+		w, ok := t.(thermometerWrapper)
+		if !ok {
+			return nil
+		}
+		t = w.Unwrap()
+	}
+	return nil
+}
+
+// asGpioThermometer finds the GpioThermometer underneath any wrappers
+func asGpioThermometer(t Thermometer) (*GpioThermometer, bool) {
+	g, ok := findThermometer(t, func(t Thermometer) bool {
+		_, ok := t.(*GpioThermometer)
+		return ok
+	}).(*GpioThermometer)
+	return g, ok
+}
+
+// asCalibratedThermometer finds the CalibratedThermometer underneath any wrappers
+func asCalibratedThermometer(t Thermometer) (*CalibratedThermometer, bool) {
+	c, ok := findThermometer(t, func(t Thermometer) bool {
+		_, ok := t.(*CalibratedThermometer)
+		return ok
+	}).(*CalibratedThermometer)
+	return c, ok
+}
+
+// asSampledThermometer finds the SampledThermometer underneath any wrappers
+func asSampledThermometer(t Thermometer) (*SampledThermometer, bool) {
+	s, ok := findThermometer(t, func(t Thermometer) bool {
+		_, ok := t.(*SampledThermometer)
+		return ok
+	}).(*SampledThermometer)
+	return s, ok
+}
+
+// CalibratedThermometer applies a ProbeCalibration to the readings of a Thermometer
+type CalibratedThermometer struct {
+	mtx         sync.Mutex
+	thermometer Thermometer
+	calibration *ProbeCalibration
+	accessory   *accessory.Thermometer
+}
+
+// NewCalibratedThermometer wraps a Thermometer with a calibration, which may be nil
+func NewCalibratedThermometer(t Thermometer, manufacturer string, pc *ProbeCalibration) *CalibratedThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(t.Name(), manufacturer), 0.0, -20.0, 100.0, 1.0)
+	return &CalibratedThermometer{
+		thermometer: t,
+		calibration: pc,
+		accessory:   acc,
+	}
+}
+
+// SetCalibration changes the calibration applied to the readings
+func (t *CalibratedThermometer) SetCalibration(pc *ProbeCalibration) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.calibration = pc
+	t.accessory.TempSensor.CurrentTemperature.SetValue(pc.Correct(t.thermometer.Temperature()))
+}
+
+// Calibration returns the calibration applied to the readings
+func (t *CalibratedThermometer) Calibration() *ProbeCalibration {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.calibration
+}
+
+// Unwrap returns the underlying Thermometer
+func (t *CalibratedThermometer) Unwrap() Thermometer {
+	return t.thermometer
+}
+
+// Name returns the name of the underlying Thermometer
+func (t *CalibratedThermometer) Name() string {
+	return t.thermometer.Name()
+}
+
+// Calibrate passes a resistance calibration on to the underlying Thermometer
+func (t *CalibratedThermometer) Calibrate(ohms float64) error {
+	return t.thermometer.Calibrate(ohms)
+}
+
+// Raw returns the temperature of the underlying Thermometer before correction
+func (t *CalibratedThermometer) Raw() float64 {
+	return t.thermometer.Temperature()
+}
+
+// Temperature returns the corrected temperature
+func (t *CalibratedThermometer) Temperature() float64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.calibration.Correct(t.thermometer.Temperature())
+}
+
+// Update updates the underlying Thermometer and the corrected temperature
+func (t *CalibratedThermometer) Update() error {
+	err := t.thermometer.Update()
+	t.accessory.TempSensor.CurrentTemperature.SetValue(t.Temperature())
+	return err
+}
+
+// Accessory returns the Apple HomeKit accessory
+func (t *CalibratedThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// probeCalibration returns the calibration stored for a role
+func (c *Config) probeCalibration(role string) *ProbeCalibration {
+	if c.cfg.Calibrations == nil {
+		return nil
+	}
+	return c.cfg.Calibrations[role]
+}
+
+// roleThermometer returns the thermometer for a role
+func (ppc *PoolPumpController) roleThermometer(role string) Thermometer {
+	switch role {
+	case RolePump:
+		return ppc.pumpTemp
+	case RoleRoof:
+		return ppc.roofTemp
+	case RoleAir:
+		return ppc.airTemp
+	case RoleReturn:
+		return ppc.returnTemp
+	case RolePool:
+		return ppc.poolTemp
+	}
+	return nil
+}
+
+// AddCalibrationPoint records the current raw reading of a role's probe against a
+// reference temperature.  The point is stored but not used until the calibration is fit.
+func (ppc *PoolPumpController) AddCalibrationPoint(role string, reference float64) (*CalibrationPoint, error) {
+	ct, ok := asCalibratedThermometer(ppc.roleThermometer(role))
+	if !ok {
+		return nil, fmt.Errorf("no calibrated thermometer for %s", role)
+	}
+	cfg := ppc.config.cfg
+	if cfg.Calibrations == nil {
+		cfg.Calibrations = map[string]*ProbeCalibration{}
+	}
+	pc := cfg.Calibrations[role]
+	if pc == nil {
+		pc = &ProbeCalibration{}
+		cfg.Calibrations[role] = pc
+	}
+	p := CalibrationPoint{Time: time.Now(), Raw: ct.Raw(), Reference: reference}
+	pc.Points = append(pc.Points, p)
+	Info("Calibration point for %s: raw(%0.2f) reference(%0.2f)", role, p.Raw, p.Reference)
+	return &p, ppc.config.Save()
+}
+
+// ClearCalibrationPoints removes the stored points for a role, leaving the fit in place
+func (ppc *PoolPumpController) ClearCalibrationPoints(role string) error {
+	pc := ppc.config.probeCalibration(role)
+	if pc == nil {
+		return nil
+	}
+	pc.Points = nil
+	return ppc.config.Save()
+}
+
+// FitCalibration fits the stored points for a role and applies the result, keeping the
+// previous calibration for rollback.
+func (ppc *PoolPumpController) FitCalibration(role string) (*ProbeCalibration, error) {
+	ct, ok := asCalibratedThermometer(ppc.roleThermometer(role))
+	if !ok {
+		return nil, fmt.Errorf("no calibrated thermometer for %s", role)
+	}
+	old := ppc.config.probeCalibration(role)
+	if old == nil {
+		return nil, errors.New("no calibration points")
+	}
+	pc, err := FitCalibration(old.Points)
+	if err != nil {
+		return nil, err
+	}
+	if old.Gain != 0.0 {
+		prev := *old
+		prev.Previous = nil
+		pc.Previous = &prev
+	}
+	ppc.config.cfg.Calibrations[role] = pc
+	ct.SetCalibration(pc)
+	Log("Calibrated %s: gain(%0.4f) offset(%0.3f) residual(%0.3f) from %d points",
+		role, pc.Gain, pc.Offset, pc.Residual, len(pc.Points))
+	return pc, ppc.config.Save()
+}
+
+// RollbackCalibration restores the previous calibration for a role
+func (ppc *PoolPumpController) RollbackCalibration(role string) error {
+	ct, ok := asCalibratedThermometer(ppc.roleThermometer(role))
+	if !ok {
+		return fmt.Errorf("no calibrated thermometer for %s", role)
+	}
+	pc := ppc.config.probeCalibration(role)
+	if pc == nil || pc.Previous == nil {
+		return errors.New("no previous calibration")
+	}
+	ppc.config.cfg.Calibrations[role] = pc.Previous
+	ct.SetCalibration(pc.Previous)
+	Log("Rolled back %s calibration to gain(%0.4f) offset(%0.3f)", role, pc.Previous.Gain, pc.Previous.Offset)
+	return ppc.config.Save()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitCalibration(t *testing.T) {
+	t.Run("OffsetOnly", func(t *testing.T) {
+		pc, err := FitCalibration([]CalibrationPoint{{Raw: 24.0, Reference: 25.0}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, pc.Gain)
+		assert.InDelta(t, 1.0, pc.Offset, 0.0001)
+		assert.InDelta(t, 0.0, pc.Residual, 0.0001)
+	})
+
+	t.Run("Linear", func(t *testing.T) {
+		points := []CalibrationPoint{
+			{Raw: 1.0, Reference: 0.0},
+			{Raw: 27.0, Reference: 26.0},
+			{Raw: 43.5, Reference: 42.5},
+		}
+		for i := range points {
+			points[i].Raw = points[i].Raw * 0.9
+		}
+		pc, err := FitCalibration(points)
+		assert.NoError(t, err)
+		assert.InDelta(t, 1.0/0.9, pc.Gain, 0.0001)
+		assert.InDelta(t, -1.0, pc.Offset, 0.0001)
+		assert.InDelta(t, 26.0, pc.Correct(27.0*0.9), 0.0001)
+		assert.InDelta(t, 0.0, pc.Residual, 0.0001)
+	})
+
+	t.Run("Residual", func(t *testing.T) {
+		pc, err := FitCalibration([]CalibrationPoint{
+			{Raw: 25.0, Reference: 25.5},
+			{Raw: 25.0, Reference: 24.5},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, pc.Gain, "Same raw value only fits an offset")
+		assert.InDelta(t, 0.0, pc.Offset, 0.0001)
+		assert.InDelta(t, 0.5, pc.Residual, 0.0001)
+	})
+
+	t.Run("Bad", func(t *testing.T) {
+		_, err := FitCalibration(nil)
+		assert.Error(t, err)
+		_, err = FitCalibration([]CalibrationPoint{{Raw: 0, Reference: 40}, {Raw: 40, Reference: 0}})
+		assert.Error(t, err, "Negative gain")
+	})
+
+	t.Run("Uncalibrated", func(t *testing.T) {
+		var pc *ProbeCalibration
+		assert.Equal(t, 12.5, pc.Correct(12.5))
+		assert.Equal(t, 12.5, (&ProbeCalibration{}).Correct(12.5))
+	})
+}
+
+func TestCalibratedThermometer(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	defer func() {
+		trp.ppc.config.cfg.Calibrations = nil
+		trp.ppc.config.Save()
+	}()
+	ct := NewCalibratedThermometer(&trp.pumpTemp, mftr, nil)
+	trp.ppc.pumpTemp = ct
+	trp.pumpTemp.temp = 20.0
+
+	t.Run("Unwrap", func(t *testing.T) {
+		g := newGpioThermometer("Test", mftr, &TestPin{})
+		found, ok := asGpioThermometer(NewCalibratedThermometer(g, mftr, nil))
+		assert.True(t, ok)
+		assert.Equal(t, g, found)
+		_, ok = asGpioThermometer(ct)
+		assert.False(t, ok)
+		found2, ok := asCalibratedThermometer(trp.ppc.pumpTemp)
+		assert.True(t, ok)
+		assert.Equal(t, ct, found2)
+	})
+
+	t.Run("Fit", func(t *testing.T) {
+		_, err := trp.ppc.FitCalibration(RolePump)
+		assert.Error(t, err, "No points yet")
+		_, err = trp.ppc.AddCalibrationPoint(RolePump, 21.0)
+		assert.NoError(t, err)
+		trp.pumpTemp.temp = 40.0
+		_, err = trp.ppc.AddCalibrationPoint(RolePump, 41.0)
+		assert.NoError(t, err)
+		_, err = trp.ppc.AddCalibrationPoint(RoleRoof, 41.0)
+		assert.Error(t, err, "Roof isn't calibrated in this test")
+
+		pc, err := trp.ppc.FitCalibration(RolePump)
+		assert.NoError(t, err)
+		assert.Nil(t, pc.Previous)
+		assert.InDelta(t, 41.0, ct.Temperature(), 0.0001)
+		assert.Equal(t, 40.0, ct.Raw())
+		assert.NoError(t, ct.Update())
+		assert.InDelta(t, 41.0, ct.accessory.TempSensor.CurrentTemperature.GetValue(), 0.0001)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		assert.NoError(t, trp.ppc.ClearCalibrationPoints(RolePump))
+		_, err := trp.ppc.AddCalibrationPoint(RolePump, 38.0)
+		assert.NoError(t, err)
+		pc, err := trp.ppc.FitCalibration(RolePump)
+		assert.NoError(t, err)
+		assert.NotNil(t, pc.Previous)
+		assert.InDelta(t, 38.0, ct.Temperature(), 0.0001)
+
+		assert.NoError(t, trp.ppc.RollbackCalibration(RolePump))
+		assert.InDelta(t, 41.0, ct.Temperature(), 0.0001)
+		assert.Error(t, trp.ppc.RollbackCalibration(RolePump), "Only one level of rollback")
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brutella/hc/accessory"
+)
+
+const (
+	// PolicyMean averages the members
+	PolicyMean = "mean"
+	// PolicyMedian uses the median of the members
+	PolicyMedian = "median"
+	// PolicyVote rejects the member furthest from the others, then averages the rest
+	PolicyVote = "vote"
+
+	// defaultDisagreement is how far a member can be from the combined value before it is
+	// reported as disagreeing
+	defaultDisagreement = 1.0
+)
+
+// memberReading is a reading from a member of a CompositeThermometer
+type memberReading struct {
+	name  string
+	value float64
+}
+
+// CompositeThermometer combines several thermometers measuring the same thing, so a single
+// failed probe doesn't blind the controller.
+type CompositeThermometer struct {
+	mtx         sync.Mutex
+	name        string
+	policy      string
+	tolerance   float64
+	members     []Thermometer
+	value       float64
+	primed      bool
+	disagreeing []string
+	accessory   *accessory.Thermometer
+}
+
+// NewCompositeThermometer creates a CompositeThermometer from its members
+func NewCompositeThermometer(name, manufacturer, policy string, tolerance float64,
+	members []Thermometer) *CompositeThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -20.0, 100.0, 1.0)
+	if tolerance <= 0.0 {
+		tolerance = defaultDisagreement
+	}
+	if policy == "" {
+		policy = PolicyMedian
+	}
+	return &CompositeThermometer{
+		name:      name,
+		policy:    policy,
+		tolerance: tolerance,
+		members:   members,
+		accessory: acc,
+	}
+}
+
+// Members returns the thermometers that make up the CompositeThermometer
+func (t *CompositeThermometer) Members() []Thermometer {
+	return t.members
+}
+
+// Name returns the name of the CompositeThermometer
+func (t *CompositeThermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory
+func (t *CompositeThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate calibrates each of the members
+func (t *CompositeThermometer) Calibrate(ohms float64) error {
+	for _, m := range t.members {
+		if err := m.Calibrate(ohms); err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Temperature returns the combined temperature
+func (t *CompositeThermometer) Temperature() float64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.value
+}
+
+// Disagreeing returns the names of the members that failed or disagree with the combined value
+func (t *CompositeThermometer) Disagreeing() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return append([]string(nil), t.disagreeing...)
+}
+
+// Update updates each member and combines the readings of those that succeeded
+func (t *CompositeThermometer) Update() error {
+	readings := []memberReading{}
+	failed := []string{}
+	for _, m := range t.members {
+		if err := m.Update(); err != nil {
+			failed = append(failed, m.Name()+" (failed)")
+			continue
+		}
+		readings = append(readings, memberReading{name: m.Name(), value: m.Temperature()})
+	}
+	if len(readings) == 0 {
+		return fmt.Errorf("%s: all %d members failed", t.name, len(t.members))
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	value, err := t.combine(readings)
+	if err != nil {
+		return err
+	}
+	disagreeing := failed
+	for _, r := range readings {
+		if math.Abs(r.value-value) > t.tolerance {
+			disagreeing = append(disagreeing, r.name)
+		}
+	}
+	if strings.Join(disagreeing, ",") != strings.Join(t.disagreeing, ",") {
+		Info("%s members disagreeing: %v", t.name, disagreeing)
+	}
+	t.disagreeing = disagreeing
+	t.value = value
+	t.primed = true
+	t.accessory.TempSensor.CurrentTemperature.SetValue(value)
+	return nil
+}
+
+// combine applies the policy to the readings
+func (t *CompositeThermometer) combine(readings []memberReading) (float64, error) {
+	values := []float64{}
+	for _, r := range readings {
+		values = append(values, r.value)
+	}
+	sort.Float64s(values)
+	switch t.policy {
+	case PolicyMean:
+		return mean(values), nil
+	case PolicyMedian:
+		n := len(values)
+		if n%2 == 0 {
+			return (values[n/2-1] + values[n/2]) / 2.0, nil
+		}
+		return values[n/2], nil
+	case PolicyVote:
+		if len(values) < 2 {
+			return values[0], nil
+		}
+		// The outlier is furthest from the others.  With two members, the one furthest from
+		// the last combined value is rejected if they disagree.
+		center := mean(values)
+		if len(values) == 2 {
+			if values[1]-values[0] <= t.tolerance || !t.primed {
+				return center, nil
+			}
+			center = t.value
+		}
+		worst := 0
+		for i, v := range values {
+			if math.Abs(v-center) > math.Abs(values[worst]-center) {
+				worst = i
+			}
+		}
+		return mean(append(values[:worst:worst], values[worst+1:]...)), nil
+	}
+	return 0.0, fmt.Errorf("unknown policy %q", t.policy)
+}
+
+func mean(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// asCompositeThermometer finds the CompositeThermometer underneath any wrappers
+func asCompositeThermometer(t Thermometer) (*CompositeThermometer, bool) {
+	c, ok := findThermometer(t, func(t Thermometer) bool {
+		_, ok := t.(*CompositeThermometer)
+		return ok
+	}).(*CompositeThermometer)
+	return c, ok
+}
+
+// gpioThermometers returns every GpioThermometer underneath t, including composite members
+func gpioThermometers(t Thermometer) []*GpioThermometer {
+	found := []*GpioThermometer{}
+	for t != nil {
+		switch v := t.(type) {
+		case *GpioThermometer:
+			return append(found, v)
+		case *CompositeThermometer:
+			for _, m := range v.members {
+				found = append(found, gpioThermometers(m)...)
+			}
+			return found
+		case thermometerWrapper:
+			t = v.Unwrap()
+		default:
+			return found
+		}
+	}
+	return found
+}
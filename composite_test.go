@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestComposite(policy string, temps ...float64) (*CompositeThermometer, []*FakeThermometer) {
+	fakes := []*FakeThermometer{}
+	members := []Thermometer{}
+	for i, temp := range temps {
+		f := &FakeThermometer{name: string(rune('A' + i)), temp: temp}
+		fakes = append(fakes, f)
+		members = append(members, f)
+	}
+	return NewCompositeThermometer("Test", mftr, policy, 0.0, members), fakes
+}
+
+func TestCompositeThermometer(t *testing.T) {
+	t.Run("Mean", func(t *testing.T) {
+		c, _ := newTestComposite(PolicyMean, 20.0, 21.0, 25.0)
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 22.0, c.Temperature())
+		assert.Equal(t, []string{"A", "C"}, c.Disagreeing())
+	})
+
+	t.Run("Median", func(t *testing.T) {
+		c, _ := newTestComposite("", 20.0, 21.0, 80.0)
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 21.0, c.Temperature())
+		assert.Equal(t, []string{"C"}, c.Disagreeing())
+
+		c, _ = newTestComposite(PolicyMedian, 20.0, 21.0, 22.0, 80.0)
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 21.5, c.Temperature())
+	})
+
+	t.Run("Vote", func(t *testing.T) {
+		c, _ := newTestComposite(PolicyVote, 20.0, 20.5, 30.0)
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 20.25, c.Temperature())
+		assert.Equal(t, []string{"C"}, c.Disagreeing())
+
+		c, fakes := newTestComposite(PolicyVote, 20.0, 20.4)
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 20.2, c.Temperature())
+		fakes[1].temp = 35.0
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 20.0, c.Temperature(), "The member that jumped away is rejected")
+		assert.Equal(t, []string{"B"}, c.Disagreeing())
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		c, fakes := newTestComposite(PolicyMedian, 20.0, 21.0, 22.0)
+		fakes[0].updateError = errors.New("broken")
+		assert.NoError(t, c.Update())
+		assert.Equal(t, 21.5, c.Temperature())
+		assert.Equal(t, []string{"A (failed)"}, c.Disagreeing())
+
+		for _, f := range fakes {
+			f.updateError = errors.New("broken")
+		}
+		assert.Error(t, c.Update())
+		assert.Equal(t, 21.5, c.Temperature(), "Keeps the last value")
+
+		c, _ = newTestComposite("bogus", 20.0)
+		assert.Error(t, c.Update())
+	})
+}
+
+func TestCompositeConfig(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := NewConfig(flag.NewFlagSet("TestCompositeConfig", flag.ContinueOnError), []string{"-data_dir", dir})
+	c.cfg.Sensors = map[string]*SensorConfig{
+		RolePump: {
+			Type:   SensorComposite,
+			Policy: PolicyVote,
+			Members: []*SensorConfig{
+				{Type: SensorGpio, Gpio: 5},
+				{Type: SensorGpio, Gpio: 6},
+			},
+		},
+	}
+	therm, err := NewThermometer(c, RolePump, "Pump", waterGpio)
+	assert.NoError(t, err)
+	comp, ok := therm.(*CompositeThermometer)
+	assert.True(t, ok)
+	assert.Equal(t, PolicyVote, comp.policy)
+	assert.Equal(t, "Pump 1", comp.Members()[0].Name())
+
+	ct := NewCalibratedThermometer(NewSampledThermometer(therm, nil), mftr, nil)
+	found, ok := asCompositeThermometer(ct)
+	assert.True(t, ok)
+	assert.Equal(t, comp, found)
+	gpios := gpioThermometers(ct)
+	assert.Len(t, gpios, 2)
+	assert.Equal(t, "Pump 2", gpios[1].Name())
+
+	c.cfg.Sensors[RolePump].Members = []*SensorConfig{{Type: SensorGpio, Gpio: 5}, {Type: SensorGpio}}
+	therm, _ = NewThermometer(c, RolePump, "Pump", waterGpio)
+	assert.Len(t, therm.(*CompositeThermometer).Members(), 1, "Members need their own GPIO")
+	c.cfg.Sensors[RolePump].Members = []*SensorConfig{{Gpio: 5}, {Gpio: 5}, {Gpio: 6}}
+	therm, _ = NewThermometer(c, RolePump, "Pump", waterGpio)
+	gpios = gpioThermometers(therm)
+	assert.Len(t, gpios, 2, "A pin is only read once")
+	assert.Equal(t, uint8(6), gpios[1].pin.Pin())
+	c.cfg.Sensors[RolePump].Members = []*SensorConfig{{Type: SensorGpio}}
+	therm, _ = NewThermometer(c, RolePump, "Pump", waterGpio)
+	assert.Equal(t, uint8(waterGpio), gpioThermometers(therm)[0].pin.Pin(), "A lone member can use the default")
+
+	c.cfg.Sensors[RolePump].Members = nil
+	therm, _ = NewThermometer(c, RolePump, "Pump", waterGpio)
+	_, ok = therm.(*GpioThermometer)
+	assert.True(t, ok, "Empty composite falls back to GPIO")
+}
+
+func TestCompositeCalibration(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	a := newGpioThermometer("Pump A", mftr, &TestPin{pin: 5})
+	b := newGpioThermometer("Pump B", mftr, &TestPin{pin: 6})
+	trp.ppc.pumpTemp = NewCompositeThermometer("Pump", mftr, PolicyMean, 0.0, []Thermometer{a, b})
+	defer func() {
+		trp.ppc.config.cfg.ProbeAdjustments = nil
+		trp.ppc.config.Save()
+	}()
+
+	a.adjust, b.adjust = 2.1, 2.7
+	trp.ppc.PersistCalibration()
+	assert.InDelta(t, 2.1, trp.ppc.config.cfg.ProbeAdjustments[5], 0.0001)
+	assert.InDelta(t, 2.7, trp.ppc.config.cfg.ProbeAdjustments[6], 0.0001)
+	assert.Equal(t, defaultPumpAdjustment, trp.ppc.config.cfg.PumpAdjustment, "Single probe value untouched")
+
+	a.adjust, b.adjust = 0.0, 0.0
+	trp.ppc.SyncAdjustments()
+	assert.InDelta(t, 2.1, a.adjust, 0.0001, "Each member keeps its own calibration")
+	assert.InDelta(t, 2.7, b.adjust, 0.0001)
+
+	c := newGpioThermometer("Pump C", mftr, &TestPin{pin: 7})
+	trp.ppc.pumpTemp = NewCompositeThermometer("Pump", mftr, PolicyMean, 0.0, []Thermometer{a, b, c})
+	trp.ppc.SyncAdjustments()
+	assert.InDelta(t, defaultPumpAdjustment, c.adjust, 0.0001, "Uncalibrated member uses the role")
+}
@@ -17,6 +17,7 @@ var (
 	defaultSslKey         = "/etc/ssl/private/pool-controller.key"
 	defaultDataDir        = "/var/cache/homekit"
 	defaultPidFile        = "/tmp/pool-controller.pid"
+	defaultW1Dir          = "/sys/bus/w1/devices"
 	defaultPin            = "74023718"
 	defaultTarget         = 30.0
 	defaultDeltaT         = 12.0
@@ -25,6 +26,8 @@ var (
 	defaultRoofAdjustment = 2.5
 	defaultFrequency      = 2
 	defaultRunTime        = 6
+	defaultFreezeTemp     = 1.0
+	defaultColdAirTemp    = 10.0
 	serverConfiguration   = "/server.conf"
 )
 
@@ -34,11 +37,15 @@ type Config struct {
 	sslCertificate *string
 	sslPrivateKey  *string
 	dataDirectory  *string
+	w1Directory    *string
 	forceRrd       *bool
 	persist        *bool
+	weatherPort    *int
 
 	// Internal
 	pidfile *string
+	remotes *RemoteSensors  // sensors that push their readings, by id
+	station *WeatherStation // uploads from the local weather station
 
 	// Persisted
 	cfg *PersistedConfig
@@ -47,28 +54,59 @@ type Config struct {
 // PersistedConfig is the portion of the configuration that can be altered and saved from the UI
 type PersistedConfig struct {
 	// Updatable
-	Disabled       bool
-	ButtonDisabled bool
-	SolarDisabled  bool
-	Auth           string
-	Pin            string
-	Target         float64
-	DeltaT         float64
-	Tolerance      float64
-	PumpAdjustment float64
-	RoofAdjustment float64
-	DailyFrequency float64 // days between automated runs
-	RunTime        float64 // hours when a pump is manually engaged it will run for this many hours
-	Mtime          time.Time
-	Ctime          time.Time
-	Schedule       *Schedule
+	Disabled          bool
+	ButtonDisabled    bool
+	SolarDisabled     bool
+	Auth              string
+	Pin               string
+	Target            float64
+	DeltaT            float64
+	Tolerance         float64
+	PumpAdjustment    float64
+	RoofAdjustment    float64
+	DailyFrequency    float64 // days between automated runs
+	RunTime           float64 // hours when a pump is manually engaged it will run for this many hours
+	SolarCheckMinutes float64 // minutes of solar operation before checking the water responded
+	SolarMinChange    float64 // minimum change in water temperature expected after SolarCheckMinutes
+	FlowGraceSeconds  float64 // seconds the flow switch has to close after the pump starts
+	FlowRetries       float64 // restarts without flow before the pump is held off with a fault
+	FlowRetryMinutes  float64 // wait before the first restart without flow, doubling after each
+	PumpWatts         float64 // power used by the main pump
+	SweepWatts        float64 // power used by the sweep booster pump
+	ValveWatts        float64 // power used by the solar valve motor while it moves
+	CostPerKWh        float64 // price of electricity
+	FreezeProtect     bool    // run the pump below FreezeTemp to keep the pipes from freezing
+	FreezeTemp        float64 // below this temperature the pump runs to keep the pipes from freezing
+	ColdAirTemp       float64 // below this air temperature the sweep runs with solar to mix the water
+	MinIrradiance     float64 // W/m^2 below which solar heating isn't attempted
+	CoastMinutes      float64 // solar heating stops when the trend reaches the target within this
+	LoadShedInput     bool    // a demand-response dry contact is wired to the load shed GPIO
+	ReturnProbe       bool    // a thermometer is wired to the solar return line
+	FlowGPM           float64 // gallons per minute through the solar panels, 0 if unknown
+	PoolGallons       float64 // volume of the pool, 0 if unknown
+	ReferenceOhms     float64 // precision resistor wired to the reference GPIO, 0 if not wired
+	ReferenceBaseline float64 // adjustment measured on the reference resistor when first wired
+	Mtime             time.Time
+	Ctime             time.Time
+	Schedule          *Schedule
+	Shadow            *ShadowConfig                // candidate settings evaluated without touching the relays
+	Sensors           map[string]*SensorConfig     // thermometer used for each role (pump, roof, air)
+	Calibrations      map[string]*ProbeCalibration // reference calibration for each role
+	ProbeAdjustments  map[uint8]float64            // adjustment for each member of a composite thermometer, by GPIO
+	Irradiance        *IrradianceConfig            // source of the solar irradiance, nil if there is none
+	Station           *StationConfig               // local weather station uploading over the LAN, nil if there is none
+	Forecast          *ForecastConfig              // source of the weather forecast for planning, nil if there is none
+	Inputs            []*InputConfig               // switches wired to GPIOs (flow, rain, cover, leak)
+	FlowMeter         *FlowMeterConfig             // pulse output flow meter, nil if there is none
 }
 
 // NewConfig creates a config objects based on a given flagset and arguments.
 func NewConfig(fs *flag.FlagSet, args []string) *Config {
 	c := Config{
-		cfg: &PersistedConfig{},
+		cfg:     &PersistedConfig{},
+		remotes: NewRemoteSensors(),
 	}
+	c.station = NewWeatherStation(&c)
 
 	c.sslCertificate = fs.String("ssl_cert", defaultSslCert,
 		"SSL cert to use for web server and homekit server")
@@ -76,8 +114,12 @@ func NewConfig(fs *flag.FlagSet, args []string) *Config {
 		"SSL private key to use for web server and homekit server")
 	c.dataDirectory = fs.String("data_dir", defaultDataDir,
 		"Directory for homekit data")
+	c.w1Directory = fs.String("w1_dir", defaultW1Dir,
+		"Directory where the kernel lists 1-Wire devices")
 	c.pidfile = fs.String("pid", defaultPidFile,
 		"File to write the process id into.")
+	c.weatherPort = fs.Int("weather_port", 0,
+		"Port for plain HTTP uploads from a local weather station, 0 disables")
 	c.forceRrd = fs.Bool("f", false,
 		"force creation of new RRD files if present")
 	c.persist = fs.Bool("p", false,
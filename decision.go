@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Conditions are everything the automatic pump control decides on: the sensors, the inputs
+// and the run history.  Gathering them up front keeps the decision itself free of the
+// hardware, so the live controller and the shadow make it the same way.
+type Conditions struct {
+	Water        float64 // water temperature at the pump
+	Roof         float64 // roof temperature next to the panels
+	Pool         float64 // best measure of the pool, used for the plan
+	Air          float64 // outdoor air temperature, when AirOK
+	AirOK        bool    // there is a healthy air thermometer
+	RoofOK       bool    // the roof thermometer is healthy
+	Healthy      bool    // the pump and roof thermometers can be trusted
+	Leak         bool    // the leak input is active
+	Cover        bool    // the pool is covered
+	Raining      bool    // the rain input or the weather station says it's raining
+	Irradiance   float64 // measured sun, when IrradianceOK
+	IrradianceOK bool    // there is an irradiance reading
+	Forecast     *Forecast
+	Trend        Trend
+	SolarFault   bool          // solar is latched off until the fault is acknowledged
+	FlowBlocked  bool          // the flow watchdog is holding the pumps off
+	FlowReason   string        // why the flow watchdog is holding the pumps off
+	Shedding     bool          // a demand response request is active
+	Owed         time.Duration // filtration to make up after shedding load
+	Manual       bool          // the current state was set by hand and hasn't run out
+	Started      time.Time     // when the pumps last started
+	Completed    time.Time     // when the daily filtration was last completed
+	Deferred     bool          // the morning filtration was left to a solar run today
+	Filtered     bool          // the daily run time has just been reached
+	Ran          time.Duration // how long the pumps have run today
+}
+
+// Decision is the State the automatic control wants, with the reason it changed
+type Decision struct {
+	State  State
+	Reason string
+}
+
+// freezeReading returns the temperature used to decide on freeze protection.  The air
+// temperature is used when there is an air sensor, otherwise it is inferred from the roof.
+func freezeReading(c *Conditions) (string, float64, bool) {
+	if c.AirOK {
+		return "Air", c.Air, true
+	}
+	if !c.RoofOK {
+		return "", 0.0, false
+	}
+	return "Roof", c.Roof, true
+}
+
+// freezeWanted returns true when freeze protection is enabled and it is cold enough outside
+// that the water needs to keep moving to protect the pipes.  Once running, it keeps running
+// until it is a degree warmer than the limit.
+func freezeWanted(cfg *PersistedConfig, c *Conditions, state State) bool {
+	if !cfg.FreezeProtect {
+		return false
+	}
+	_, temp, ok := freezeReading(c)
+	if !ok {
+		return false
+	}
+	limit := freezeTemp(cfg)
+	if state > OFF {
+		limit += 1.0
+	}
+	return temp < limit
+}
+
+// airCold returns true when the air is cold enough that the sweep should run with solar to
+// mix the water
+func airCold(cfg *PersistedConfig, c *Conditions) bool {
+	return c.AirOK && c.Air < coldAirTemp(cfg)
+}
+
+// sunPlausible returns false when it's raining, or the measured sun is too weak for the
+// panels to add heat.  Without a measurement the roof temperature has to be trusted.
+func sunPlausible(cfg *PersistedConfig, c *Conditions) bool {
+	if c.Raining {
+		return false
+	}
+	return !c.IrradianceOK || c.Irradiance >= minIrradiance(cfg)
+}
+
+// coolingWanted returns true when running the water through the cold panels would bring it
+// down to the target
+func coolingWanted(cfg *PersistedConfig, c *Conditions) bool {
+	return !c.SolarFault && c.Healthy && coolingHelps(cfg, c.Water, c.Roof)
+}
+
+// warmingWanted returns true when running the water through the hot panels would bring it up
+// to the target, or bank heat ahead of a cold front
+func warmingWanted(cfg *PersistedConfig, c *Conditions, now time.Time) bool {
+	if cfg.SolarDisabled || c.SolarFault || !c.Healthy || !sunPlausible(cfg, c) {
+		return false
+	}
+	return warmingHelps(cfg, c.Water, c.Roof) || preWarmWanted(cfg, c, now)
+}
+
+// preWarmWanted returns true while the plan calls for banking heat ahead of a cold front: the
+// water is heated to the top of the band, rather than only when it drops below it.
+func preWarmWanted(cfg *PersistedConfig, c *Conditions, now time.Time) bool {
+	plan := makePlan(c.Forecast, now, cfg, c.Pool)
+	if plan == nil || !plan.PreWarm {
+		return false
+	}
+	return c.Water < cfg.Target+cfg.Tolerance && c.Water < c.Roof-cfg.DeltaT
+}
+
+// coastWanted returns true when solar heating can stop early: the pool is warming fast enough
+// that the heat left in the panels and pipes will carry it past the target within the coast
+// period, so running out the rest of the hour would overshoot.
+func coastWanted(cfg *PersistedConfig, c *Conditions, state State) bool {
+	if state != SOLAR && state != MIXING {
+		return false
+	}
+	if !c.Trend.Valid || c.Trend.Slope < trendSteady {
+		return false
+	}
+	projected := c.Water + c.Trend.Slope*coastMinutes(cfg)/60.0
+	return projected >= cfg.Target
+}
+
+// filtrationWanted returns true when the daily filtration run should be happening.  It runs
+// in the early morning, unless the plan has an afternoon solar run doing the filtration, in
+// which case deferring is returned.  When that solar run falls short of the run time, the
+// rest is made up in the evening.
+func filtrationWanted(cfg *PersistedConfig, c *Conditions, now time.Time) (due, deferring bool) {
+	if now.Sub(c.Completed) <= dailyFrequency(cfg) {
+		return false, false
+	}
+	if now.Hour() < 6 { // run in the early morning
+		if plan := makePlan(c.Forecast, now, cfg, c.Pool); plan != nil && plan.SkipSweep {
+			return false, true
+		}
+		return true, false
+	}
+	return now.Hour() >= planEvening && c.Deferred, false
+}
+
+// withoutSweep drops the sweep from a state while the cover is closed, it would tangle in it
+func withoutSweep(c *Conditions, state State) State {
+	if !c.Cover {
+		return state
+	}
+	switch state {
+	case SWEEP:
+		return PUMP
+	case MIXING:
+		return SOLAR
+	}
+	return state
+}
+
+// decide makes the automatic pump decision.  If the water is not within the tolerance limit
+// of the target, and the roof temperature would help get the temperature to be closer to the
+// target, the pumps are run through the panels.  If the outdoor temperature is low or the pool
+// is very cold, the sweep is also run to help mix the water as it approaches the target.
+// Otherwise the pumps run for the daily filtration, and are turned off once there is no reason
+// to run them.
+func decide(cfg *PersistedConfig, c *Conditions, state State, now time.Time) Decision {
+	keep := Decision{State: state}
+
+	// Pumping with a leak at the equipment would empty the pool, even on a manual run
+	if c.Leak {
+		if state > OFF {
+			return Decision{State: OFF, Reason: "Leak detected: stopping pumps"}
+		}
+		return keep
+	}
+	if c.Manual {
+		return keep
+	}
+	if state == DISABLED && !cfg.Disabled && !cfg.SolarDisabled {
+		return Decision{State: OFF}
+	}
+	if cfg.Disabled {
+		if state > DISABLED {
+			return Decision{State: DISABLED}
+		}
+		return keep
+	}
+
+	// Running dry burns out the pump seals, so wait out the retry or the acknowledgement
+	if c.FlowBlocked {
+		if state > OFF {
+			return Decision{State: OFF, Reason: "Stopping pumps: " + c.FlowReason}
+		}
+		return keep
+	}
+	if freezeWanted(cfg, c, state) {
+		if state == OFF {
+			name, temp, _ := freezeReading(c)
+			return Decision{State: PUMP, Reason: fmt.Sprintf("Freeze protection: %s(%0.1f) < %0.1f",
+				name, temp, freezeTemp(cfg))}
+		}
+		return keep
+	}
+
+	// Demand response, suspend everything else
+	if c.Shedding {
+		if state > OFF {
+			return Decision{State: OFF, Reason: "Load shed: stopping pumps"}
+		}
+		return keep
+	}
+
+	if coolingWanted(cfg, c) || warmingWanted(cfg, c, now) {
+		// Wide deltaT between target and temp or when it's cold, run sweep
+		if state == MIXING && !c.Cover {
+			return keep
+		}
+		next := solarState(cfg, c.Water)
+		if next == SOLAR && airCold(cfg, c) {
+			next = MIXING
+		}
+		return Decision{State: withoutSweep(c, next), Reason: fmt.Sprintf(
+			"Solar: Pool(%0.1f) Roof(%0.1f) Target(%0.1f)", c.Water, c.Roof, cfg.Target)}
+	}
+
+	if c.Owed > 0 {
+		if state == OFF {
+			return Decision{State: PUMP, Reason: fmt.Sprintf(
+				"Making up %s of filtration missed while shedding load", c.Owed)}
+		}
+		return keep
+	}
+
+	// If the pumps havent run in a day, wait til 4AM then start them
+	if due, _ := filtrationWanted(cfg, c, now); due {
+		return Decision{State: withoutSweep(c, SWEEP), Reason: fmt.Sprintf(
+			"Daily running SWEEP: %s", dailyFrequency(cfg))}
+	}
+	if c.Filtered && (state == PUMP || state == SWEEP) {
+		return Decision{State: OFF, Reason: fmt.Sprintf(
+			"Daily filtration complete: ran %s today", shortDuration(c.Ran))}
+	}
+	// Coast in to the target rather than run out the hour and overshoot it
+	if coastWanted(cfg, c, state) {
+		return Decision{State: OFF, Reason: fmt.Sprintf("Coasting in: Pool(%0.1f) %s", c.Water, c.Trend)}
+	}
+	// If there is no reason to turn on the pumps and it's not manual, turn off
+	if state > OFF && c.Started.Add(time.Hour).Before(now) {
+		return Decision{State: OFF}
+	}
+	return keep
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+)
+
+const (
+	// ds18b20PowerOn is the value the DS18B20 reports before its first conversion, usually
+	// seen after a brown out.  It is never a real reading for a pool.
+	ds18b20PowerOn = 85000
+	// ds18b20Retries is the number of times a read is retried after a CRC failure
+	ds18b20Retries = 3
+)
+
+// DS18B20Thermometer reads a DS18B20 1-Wire thermometer through the Linux w1 sysfs interface
+type DS18B20Thermometer struct {
+	name      string
+	device    string
+	path      string
+	mutex     sync.Mutex
+	updated   time.Time
+	accessory *accessory.Thermometer
+}
+
+// NewDS18B20Thermometer creates a DS18B20Thermometer for a device (ex. 28-0316a2795eff)
+// found under baseDir (normally /sys/bus/w1/devices)
+func NewDS18B20Thermometer(name, manufacturer, baseDir, device string) *DS18B20Thermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -20.0, 100.0, 1.0)
+	return &DS18B20Thermometer{
+		name:      name,
+		device:    device,
+		path:      filepath.Join(baseDir, device, "w1_slave"),
+		updated:   time.Now().Add(-24 * time.Hour),
+		accessory: acc,
+	}
+}
+
+// Name returns the name of the DS18B20Thermometer
+func (t *DS18B20Thermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory related to the DS18B20Thermometer
+func (t *DS18B20Thermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate is not needed, the DS18B20 is factory calibrated
+func (t *DS18B20Thermometer) Calibrate(a float64) error {
+	return errors.New("not supported")
+}
+
+// Temperature returns the last temperature read from the DS18B20Thermometer
+func (t *DS18B20Thermometer) Temperature() float64 {
+	return t.accessory.TempSensor.CurrentTemperature.GetValue()
+}
+
+// Update reads the current temperature from the device, retrying on CRC failures
+func (t *DS18B20Thermometer) Update() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var err error
+	for i := 0; i < ds18b20Retries; i++ {
+		var data []byte
+		data, err = ioutil.ReadFile(t.path)
+		if err != nil {
+			return fmt.Errorf("%s thermometer(%s) read failed: %w", t.name, t.device, err)
+		}
+		var temp float64
+		temp, err = parseW1Slave(string(data))
+		if err == nil {
+			Debug("Temperature for %s(%s): %0.3f", t.name, t.device, temp)
+			t.accessory.TempSensor.CurrentTemperature.SetValue(temp)
+			t.updated = time.Now()
+			return nil
+		}
+		if !errors.Is(err, errW1Crc) {
+			break
+		}
+	}
+	Info("%s thermometer(%s) update failed: %v", t.name, t.device, err)
+	return err
+}
+
+var (
+	errW1Crc     = errors.New("crc check failed")
+	errW1PowerOn = errors.New("power-on reset value")
+)
+
+// parseW1Slave reads the temperature from the contents of a w1_slave file:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func parseW1Slave(data string) (float64, error) {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) < 2 {
+		return 0.0, fmt.Errorf("unexpected w1_slave format: %q", data)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0.0, errW1Crc
+	}
+	idx := strings.LastIndex(lines[1], "t=")
+	if idx < 0 {
+		return 0.0, fmt.Errorf("no temperature found: %q", lines[1])
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(lines[1][idx+2:]))
+	if err != nil {
+		return 0.0, fmt.Errorf("could not parse temperature: %w", err)
+	}
+	if milli == ds18b20PowerOn {
+		return 0.0, errW1PowerOn
+	}
+	return float64(milli) / 1000.0, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeW1Slave(t *testing.T, dir, device, data string) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, device), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, device, "w1_slave"), []byte(data), 0644))
+}
+
+func TestDS18B20Thermometer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "w1")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	device := "28-0316a2795eff"
+	therm := NewDS18B20Thermometer("Test", mftr, dir, device)
+
+	t.Run("Reads", func(t *testing.T) {
+		writeW1Slave(t, dir, device,
+			"72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+		assert.NoError(t, therm.Update())
+		assert.InDelta(t, 23.125, therm.Temperature(), 0.0001)
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		writeW1Slave(t, dir, device,
+			"5e ff 4b 46 7f ff 0c 10 1c : crc=1c YES\n5e ff 4b 46 7f ff 0c 10 1c t=-10125\n")
+		assert.NoError(t, therm.Update())
+		assert.InDelta(t, -10.125, therm.Temperature(), 0.0001)
+	})
+
+	t.Run("CrcFailure", func(t *testing.T) {
+		writeW1Slave(t, dir, device,
+			"72 01 4b 46 7f ff 0e 10 57 : crc=12 NO\n72 01 4b 46 7f ff 0e 10 57 t=40000\n")
+		err := therm.Update()
+		assert.ErrorIs(t, err, errW1Crc)
+		assert.InDelta(t, -10.125, therm.Temperature(), 0.0001, "Last good value kept")
+	})
+
+	t.Run("PowerOn", func(t *testing.T) {
+		writeW1Slave(t, dir, device,
+			"50 05 4b 46 7f ff 0c 10 1c : crc=1c YES\n50 05 4b 46 7f ff 0c 10 1c t=85000\n")
+		assert.ErrorIs(t, therm.Update(), errW1PowerOn)
+		assert.InDelta(t, -10.125, therm.Temperature(), 0.0001, "Last good value kept")
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		missing := NewDS18B20Thermometer("Missing", mftr, dir, "28-000000000000")
+		assert.Error(t, missing.Update())
+		assert.Error(t, missing.Calibrate(10000.0))
+	})
+
+	t.Run("Garbage", func(t *testing.T) {
+		_, err := parseW1Slave("")
+		assert.Error(t, err)
+		_, err = parseW1Slave("crc=57 YES\nno reading")
+		assert.Error(t, err)
+	})
+}
+
+func TestNewThermometer(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := NewConfig(flag.NewFlagSet("TestNewThermometer", flag.ContinueOnError),
+		[]string{"-data_dir", dir, "-w1_dir", "/tmp/w1"})
+	config.cfg.Sensors = map[string]*SensorConfig{
+		RoleRoof: {Type: SensorDS18B20, Device: "28-0316a2795eff"},
+		RoleAir:  {Type: SensorGpio, Gpio: 5, Thermistor: &ThermistorConfig{Part: "NTC-10K-3950"}},
+	}
+
+	therm, err := NewThermometer(config, RolePump, "Pump", waterGpio)
+	assert.NoError(t, err)
+	pump, ok := therm.(*GpioThermometer)
+	assert.True(t, ok, "Unconfigured roles use a GpioThermometer")
+	assert.Equal(t, uint8(waterGpio), pump.pin.Pin())
+
+	therm, _ = NewThermometer(config, RoleRoof, "Roof", roofGpio)
+	roof, ok := therm.(*DS18B20Thermometer)
+	assert.True(t, ok)
+	assert.Equal(t, "/tmp/w1/28-0316a2795eff/w1_slave", roof.path)
+
+	therm, _ = NewThermometer(config, RoleAir, "Air", 0)
+	air, ok := therm.(*GpioThermometer)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(5), air.pin.Pin())
+	assert.Equal(t, BetaModel{R0: 10000, T0: 25, Beta: 3950}, air.model)
+
+	config.cfg.Sensors[RoleAir] = &SensorConfig{Type: SensorGpio}
+	_, err = NewThermometer(config, RoleAir, "Air", 0)
+	assert.Error(t, err, "Air has no default GPIO")
+	assert.Nil(t, OptionalRoleSampler(config, RoleAir, "Air"))
+	config.cfg.Sensors[RolePool] = &SensorConfig{Type: SensorComposite, Members: []*SensorConfig{{Gpio: 6}, {}}}
+	therm, err = NewThermometer(config, RolePool, "Pool", 0)
+	assert.NoError(t, err)
+	assert.Len(t, gpioThermometers(therm), 1, "The member without a GPIO is left out")
+	delete(config.cfg.Sensors, RolePool)
+	assert.Nil(t, OptionalRoleSampler(config, RolePool, "Pool"), "Not configured")
+}
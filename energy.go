@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// CauseSolar is energy used while heating or cooling with the solar panels
+	CauseSolar = "solar"
+	// CauseSweep is energy used while cleaning the pool
+	CauseSweep = "sweep"
+	// CauseSchedule is energy used by automated pump runs
+	CauseSchedule = "schedule"
+	// CauseManual is energy used when the pumps were started by hand
+	CauseManual = "manual"
+
+	// energyDays is the number of days of energy history that are kept
+	energyDays = 400
+	dayFormat  = "2006-01-02"
+)
+
+var (
+	defaultPumpWatts  = 1100.0
+	defaultSweepWatts = 750.0
+	defaultValveWatts = 25.0
+	energyCauses      = []string{CauseSolar, CauseSweep, CauseSchedule, CauseManual}
+)
+
+// EnergyReport holds the energy used over a period, broken down by cause
+type EnergyReport struct {
+	Name  string
+	KWh   map[string]float64
+	Total float64
+	Cost  float64
+}
+
+type trackedRelay struct {
+	relay *Relay
+	watts func() float64
+	cause func() string
+}
+
+// EnergyMeter accumulates the energy used by the relays from the time they spend on.
+type EnergyMeter struct {
+	mtx    sync.Mutex
+	cfg    *PersistedConfig
+	path   string
+	Days   map[string]map[string]float64 // day -> cause -> kWh
+	relays []trackedRelay
+}
+
+// NewEnergyMeter creates an EnergyMeter, restoring any history saved to path.
+func NewEnergyMeter(cfg *PersistedConfig, path string) *EnergyMeter {
+	m := EnergyMeter{
+		cfg:  cfg,
+		path: path,
+		Days: map[string]map[string]float64{},
+	}
+	if buf, err := ioutil.ReadFile(path); err == nil {
+		if err = json.Unmarshal(buf, &m); err != nil {
+			Error("Could not read energy history: %v", err)
+		}
+	}
+	if m.Days == nil {
+		m.Days = map[string]map[string]float64{}
+	}
+	return &m
+}
+
+// PumpWatts returns the configured wattage of the main pump
+func (m *EnergyMeter) PumpWatts() float64 {
+	return wattsOrDefault(m.cfg.PumpWatts, defaultPumpWatts)
+}
+
+// SweepWatts returns the configured wattage of the sweep booster pump
+func (m *EnergyMeter) SweepWatts() float64 {
+	return wattsOrDefault(m.cfg.SweepWatts, defaultSweepWatts)
+}
+
+// ValveWatts returns the configured wattage of the solar valve motor
+func (m *EnergyMeter) ValveWatts() float64 {
+	return wattsOrDefault(m.cfg.ValveWatts, defaultValveWatts)
+}
+
+func wattsOrDefault(watts, defaultWatts float64) float64 {
+	if watts <= 0.0 {
+		return defaultWatts
+	}
+	return watts
+}
+
+// Track starts accounting for the energy used by a relay
+func (m *EnergyMeter) Track(r *Relay, watts func() float64, cause func() string) {
+	m.mtx.Lock()
+	m.relays = append(m.relays, trackedRelay{relay: r, watts: watts, cause: cause})
+	m.mtx.Unlock()
+	r.OnUsage(func(start, stop time.Time) {
+		m.Add(cause(), watts(), start, stop)
+		m.Save()
+	})
+}
+
+// Add records watts used between start and stop, split across the days it covers
+func (m *EnergyMeter) Add(cause string, watts float64, start, stop time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.add(m.Days, cause, watts, start, stop)
+	m.prune(stop)
+}
+
+func (m *EnergyMeter) add(days map[string]map[string]float64, cause string, watts float64,
+	start, stop time.Time) {
+	for start.Before(stop) {
+		y, mo, d := start.Date()
+		midnight := time.Date(y, mo, d+1, 0, 0, 0, 0, start.Location())
+		end := stop
+		if midnight.Before(stop) {
+			end = midnight
+		}
+		day := start.Format(dayFormat)
+		if days[day] == nil {
+			days[day] = map[string]float64{}
+		}
+		days[day][cause] += watts * end.Sub(start).Hours() / 1000.0
+		start = end
+	}
+}
+
+func (m *EnergyMeter) prune(now time.Time) {
+	oldest := now.AddDate(0, 0, -energyDays).Format(dayFormat)
+	for day := range m.Days {
+		if day < oldest {
+			delete(m.Days, day)
+		}
+	}
+}
+
+// Save writes the energy history to disk
+func (m *EnergyMeter) Save() {
+	m.mtx.Lock()
+	buf, err := json.Marshal(m)
+	m.mtx.Unlock()
+	if err == nil {
+		err = ioutil.WriteFile(m.path, buf, 0644)
+	}
+	if err != nil {
+		Error("Could not save energy history: %v", err)
+	}
+}
+
+// Power returns the watts currently being used by the tracked relays
+func (m *EnergyMeter) Power() float64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	watts := 0.0
+	for _, t := range m.relays {
+		if t.relay.on {
+			watts += t.watts()
+		}
+	}
+	return watts
+}
+
+// Report returns the energy used during the last given number of days (including today).
+// Relays that are currently on are included up to now.
+func (m *EnergyMeter) Report(name string, days int, now time.Time) EnergyReport {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	current := map[string]map[string]float64{}
+	for _, t := range m.relays {
+		if t.relay.on {
+			m.add(current, t.cause(), t.watts(), t.relay.startTime, now)
+		}
+	}
+
+	report := EnergyReport{Name: name, KWh: map[string]float64{}}
+	first := now.AddDate(0, 0, 1-days).Format(dayFormat)
+	for _, set := range []map[string]map[string]float64{m.Days, current} {
+		for day, causes := range set {
+			if day < first {
+				continue
+			}
+			for cause, kwh := range causes {
+				report.KWh[cause] += kwh
+				report.Total += kwh
+			}
+		}
+	}
+	report.Cost = report.Total * m.cfg.CostPerKWh
+	return report
+}
+
+// Causes returns the known causes in a stable order, followed by any others in the report
+func (r EnergyReport) Causes() []string {
+	out := append([]string{}, energyCauses...)
+	extra := []string{}
+	for cause := range r.KWh {
+		found := false
+		for _, c := range energyCauses {
+			found = found || c == cause
+		}
+		if !found {
+			extra = append(extra, cause)
+		}
+	}
+	sort.Strings(extra)
+	return append(out, extra...)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnergyMeter(t *testing.T) {
+	path := fmt.Sprintf("/tmp/test-energy-%d.json", rand.Uint32())
+	defer os.Remove(path)
+	cfg := &PersistedConfig{PumpWatts: 1000, CostPerKWh: 0.25}
+	m := NewEnergyMeter(cfg, path)
+	now := time.Date(2026, 6, 10, 12, 0, 0, 0, time.Local)
+
+	t.Run("SplitsDays", func(t *testing.T) {
+		start := time.Date(2026, 6, 9, 23, 0, 0, 0, time.Local)
+		m.Add(CauseSolar, 1000, start, start.Add(2*time.Hour))
+		assert.InDelta(t, 1.0, m.Days["2026-06-09"][CauseSolar], 0.0001)
+		assert.InDelta(t, 1.0, m.Days["2026-06-10"][CauseSolar], 0.0001)
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		m.Add(CauseManual, 500, now.AddDate(0, 0, -3), now.AddDate(0, 0, -3).Add(2*time.Hour))
+		today := m.Report("Today", 1, now)
+		assert.InDelta(t, 1.0, today.Total, 0.0001)
+		assert.InDelta(t, 0.25, today.Cost, 0.0001)
+		week := m.Report("Week", 7, now)
+		assert.InDelta(t, 3.0, week.Total, 0.0001)
+		assert.InDelta(t, 1.0, week.KWh[CauseManual], 0.0001)
+		assert.Equal(t, energyCauses, week.Causes())
+	})
+
+	t.Run("Persists", func(t *testing.T) {
+		m.Save()
+		m2 := NewEnergyMeter(cfg, path)
+		assert.Equal(t, m.Days, m2.Days)
+	})
+
+	t.Run("TracksRelay", func(t *testing.T) {
+		m := NewEnergyMeter(cfg, path)
+		relay := newRelay(&TestPin{}, "Test Pump", mftr)
+		cause := CauseSchedule
+		m.Track(relay, m.PumpWatts, func() string { return cause })
+		assert.Equal(t, 0.0, m.Power())
+
+		relay.TurnOn()
+		relay.startTime = relay.startTime.Add(-time.Hour)
+		assert.Equal(t, 1000.0, m.Power())
+		open := m.Report("Today", 1, time.Now())
+		assert.InDelta(t, 1.0, open.KWh[CauseSchedule], 0.01, "Running relays should be included")
+
+		relay.TurnOn() // Still on, closes the first period
+		cause = CauseSolar
+		relay.startTime = relay.startTime.Add(-30 * time.Minute)
+		relay.TurnOff()
+		assert.Equal(t, 0.0, m.Power())
+		r := m.Report("Today", 1, time.Now())
+		assert.InDelta(t, 1.0, r.KWh[CauseSchedule], 0.01)
+		assert.InDelta(t, 0.5, r.KWh[CauseSolar], 0.01)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		m := NewEnergyMeter(&PersistedConfig{}, path)
+		assert.Equal(t, defaultPumpWatts, m.PumpWatts())
+		assert.Equal(t, defaultSweepWatts, m.SweepWatts())
+		assert.Equal(t, defaultValveWatts, m.ValveWatts())
+	})
+}
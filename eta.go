@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+	"github.com/brutella/hc/characteristic"
+	"github.com/brutella/hc/service"
+)
+
+const (
+	// defaultSolarEndHour is when the panels stop being useful, used when the site
+	// coordinates aren't configured
+	defaultSolarEndHour = 16
+	// daylightStep is the resolution of the search for the end of useful sun
+	daylightStep = 10 * time.Minute
+)
+
+// ETA is the estimated time for the pool to reach the target with solar heating
+type ETA struct {
+	Target    float64
+	Reached   bool          // the pool is at or above the target
+	Reachable bool          // the target can be reached before the sun is gone
+	Remaining time.Duration // time to the target at Rate
+	Rate      float64       // degrees celsius per hour used for the estimate
+	Source    string        // where the rate came from
+	Daylight  time.Duration // useful sun left today
+	Reason    string        // why the target can't be reached
+}
+
+// String describes the ETA, ex. "pool will reach 30.0°C in about 3h20m at the current solar rate"
+func (e ETA) String() string {
+	switch {
+	case e.Reached:
+		return fmt.Sprintf("pool is at the target (%0.1f°C)", e.Target)
+	case e.Reachable:
+		return fmt.Sprintf("pool will reach %0.1f°C in about %s at the %s", e.Target,
+			shortDuration(e.Remaining), e.Source)
+	}
+	return fmt.Sprintf("won't reach target today, %s", e.Reason)
+}
+
+// shortDuration formats a duration as hours and minutes, ex. 3h20m
+func shortDuration(d time.Duration) string {
+	d = d.Round(10 * time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// estimateETA works out when water heating at rate (per hour) reaches the target, if it can
+// before the daylight runs out
+func estimateETA(water, target, rate float64, source string, daylight time.Duration) ETA {
+	eta := ETA{Target: target, Rate: rate, Source: source, Daylight: daylight}
+	if water >= target {
+		eta.Reached = true
+		return eta
+	}
+	if rate <= 0.0 {
+		eta.Reason = "the water isn't warming"
+		return eta
+	}
+	eta.Remaining = time.Duration((target - water) / rate * float64(time.Hour))
+	if eta.Remaining > daylight {
+		eta.Reason = fmt.Sprintf("needs %s with %s of sun left", shortDuration(eta.Remaining),
+			shortDuration(daylight))
+		return eta
+	}
+	eta.Reachable = true
+	return eta
+}
+
+// daylightRemaining returns how long the sun will be strong enough to heat the water.  With
+// the site coordinates the clear sky model is used, otherwise the sun is assumed useful until
+// the afternoon.
+func (ppc *PoolPumpController) daylightRemaining(now time.Time) time.Duration {
+	cfg := ppc.config.cfg
+	if ic := cfg.Irradiance; ic != nil && (ic.Latitude != 0.0 || ic.Longitude != 0.0) {
+		sky := NewClearSkyIrradiance(ic.Latitude, ic.Longitude)
+		limit := minIrradiance(cfg)
+		t := now
+		for ; t.Sub(now) < 24*time.Hour; t = t.Add(daylightStep) {
+			if value, _ := sky.Irradiance(t); value < limit {
+				break
+			}
+		}
+		return t.Sub(now)
+	}
+	end := time.Date(now.Year(), now.Month(), now.Day(), defaultSolarEndHour, 0, 0, 0, now.Location())
+	if now.After(end) {
+		return 0
+	}
+	return end.Sub(now)
+}
+
+// ETA estimates when the pool will reach the target.  While solar is running the measured
+// trend is used, otherwise the rate the tuning advisor has seen for the current roof
+// temperature.
+func (ppc *PoolPumpController) ETA(now time.Time) ETA {
+	cfg := ppc.config.cfg
+	water := ppc.runningTemp.Temperature()
+	daylight := ppc.daylightRemaining(now)
+	if water >= cfg.Target {
+		return estimateETA(water, cfg.Target, 0.0, "", daylight)
+	}
+	if cfg.SolarDisabled {
+		eta := estimateETA(water, cfg.Target, 0.0, "", daylight)
+		eta.Reason = "solar is disabled"
+		return eta
+	}
+	if fault, _ := ppc.solarWatch.Fault(); fault {
+		eta := estimateETA(water, cfg.Target, 0.0, "", daylight)
+		eta.Reason = "solar has a fault"
+		return eta
+	}
+	state := ppc.switches.State()
+	trend := ppc.PoolTrend()
+	if (state == SOLAR || state == MIXING) && trend.Valid && trend.Slope > trendSteady {
+		return estimateETA(water, cfg.Target, trend.Slope, "current solar rate", daylight)
+	}
+	roof := ppc.roofTemp.Temperature()
+	if roof-water < cfg.DeltaT {
+		eta := estimateETA(water, cfg.Target, 0.0, "", daylight)
+		eta.Reason = "the roof isn't hot enough"
+		return eta
+	}
+	rate := 0.0
+	if rec, _ := ppc.advisor.Last(); rec != nil {
+		rate = gainRate(rec.Buckets, roof-water)
+	}
+	eta := estimateETA(water, cfg.Target, rate, "expected solar rate", daylight)
+	if rate <= 0.0 {
+		eta.Reason = "no solar history to estimate from"
+	}
+	return eta
+}
+
+// TargetNotifier raises an alert when the pool reaches the target, and shows it in HomeKit
+// as a contact sensor so the Home app can notify on it.
+type TargetNotifier struct {
+	mtx       sync.Mutex
+	reached   bool
+	sensor    *service.ContactSensor
+	accessory *accessory.Accessory
+}
+
+// NewTargetNotifier creates a TargetNotifier with its HomeKit accessory
+func NewTargetNotifier(name, manufacturer string) *TargetNotifier {
+	acc := accessory.New(AccessoryInfo(name, manufacturer), accessory.TypeSensor)
+	sensor := service.NewContactSensor()
+	sensor.ContactSensorState.SetValue(characteristic.ContactSensorStateContactNotDetected)
+	acc.AddService(sensor.Service)
+	return &TargetNotifier{sensor: sensor, accessory: acc}
+}
+
+// Accessory returns the Apple HomeKit accessory
+func (n *TargetNotifier) Accessory() *accessory.Accessory {
+	return n.accessory
+}
+
+// Reached returns true while the pool is at the target
+func (n *TargetNotifier) Reached() bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.reached
+}
+
+// Check returns true when the pool has just reached the target.  It resets once the water
+// drops below the tolerance band.
+func (n *TargetNotifier) Check(water, target, tolerance float64) bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	switch {
+	case !n.reached && water >= target:
+		n.reached = true
+		n.sensor.ContactSensorState.SetValue(characteristic.ContactSensorStateContactDetected)
+		return true
+	case n.reached && water < target-tolerance:
+		n.reached = false
+		n.sensor.ContactSensorState.SetValue(characteristic.ContactSensorStateContactNotDetected)
+	}
+	return false
+}
+
+// CheckTarget raises an alert when the pool reaches the target.  The pump probe is only
+// trusted while the water is moving past it.
+func (ppc *PoolPumpController) CheckTarget() {
+	water, ok := ppc.poolWater()
+	if !ok {
+		return
+	}
+	cfg := ppc.config.cfg
+	if ppc.atTarget.Check(water, cfg.Target, cfg.Tolerance) {
+		ppc.alerts.Raise("Pool", "reached the target of %0.1f°C", cfg.Target)
+	}
+}
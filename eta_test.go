@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateETA(t *testing.T) {
+	eta := estimateETA(28.0, 30.0, 0.6, "current solar rate", 5*time.Hour)
+	assert.True(t, eta.Reachable)
+	assert.Equal(t, 200*time.Minute, eta.Remaining.Round(time.Minute))
+	assert.Equal(t, "pool will reach 30.0°C in about 3h20m at the current solar rate", eta.String())
+
+	eta = estimateETA(28.0, 30.0, 0.6, "current solar rate", 2*time.Hour)
+	assert.False(t, eta.Reachable)
+	assert.Equal(t, "won't reach target today, needs 3h20m with 2h00m of sun left", eta.String())
+
+	eta = estimateETA(28.0, 30.0, 0.0, "", 2*time.Hour)
+	assert.False(t, eta.Reachable)
+	assert.Equal(t, "pool is at the target (30.0°C)", estimateETA(30.2, 30.0, 0.0, "", 0).String())
+	assert.Equal(t, "40m", shortDuration(38*time.Minute))
+}
+
+func TestDaylightRemaining(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	now := time.Date(2021, time.June, 21, 13, 0, 0, 0, time.Local)
+	assert.Equal(t, 3*time.Hour, trp.ppc.daylightRemaining(now))
+	assert.Equal(t, time.Duration(0), trp.ppc.daylightRemaining(now.Add(4*time.Hour)))
+
+	trp.ppc.config.cfg.Irradiance = &IrradianceConfig{Type: IrradianceClearSky, Latitude: 37.3, Longitude: -121.9}
+	defer func() { trp.ppc.config.cfg.Irradiance = nil }()
+	pst := time.FixedZone("PST", -8*3600)
+	d := trp.ppc.daylightRemaining(time.Date(2021, time.June, 21, 13, 0, 0, 0, pst))
+	assert.True(t, d > 3*time.Hour && d < 6*time.Hour, "%s", d)
+	assert.Equal(t, time.Duration(0), trp.ppc.daylightRemaining(time.Date(2021, time.June, 21, 23, 0, 0, 0, pst)))
+}
+
+func TestControllerETA(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 28.0, 50.0, 33.0, OFF)
+	trp.ppc.runningTemp = &trp.pumpTemp
+	morning := time.Date(2021, time.June, 21, 10, 0, 0, 0, time.Local)
+
+	eta := trp.ppc.ETA(morning)
+	assert.False(t, eta.Reachable)
+	assert.Equal(t, "no solar history to estimate from", eta.Reason)
+
+	trp.ppc.advisor.last = &TuningRecommendation{Buckets: []GainBucket{{MinDiff: 15.0, MaxDiff: 30.0, Rate: 0.5}}}
+	defer func() { trp.ppc.advisor.last = nil }()
+	eta = trp.ppc.ETA(morning)
+	assert.True(t, eta.Reachable)
+	assert.Equal(t, "expected solar rate", eta.Source)
+	assert.Equal(t, 4*time.Hour, eta.Remaining.Round(time.Minute))
+
+	trp.roofTemp.temp = 35.0
+	assert.Equal(t, "the roof isn't hot enough", trp.ppc.ETA(morning).Reason)
+
+	trp.ppc.switches.state = SOLAR
+	now := time.Now()
+	for i := 0; i <= 20; i++ {
+		trp.ppc.trend.Push(27.8+float64(i)*0.01, now.Add(time.Duration(i)*time.Minute))
+	}
+	eta = trp.ppc.ETA(morning)
+	assert.Equal(t, "current solar rate", eta.Source)
+	assert.InDelta(t, 0.6, eta.Rate, 0.001)
+}
+
+func TestTargetNotifier(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 29.8, 50.0, 33.0, SOLAR)
+	n := trp.ppc.atTarget
+	trp.ppc.CheckTarget()
+	assert.False(t, n.Reached())
+
+	trp.pumpTemp.temp = 30.0
+	trp.ppc.CheckTarget()
+	assert.True(t, n.Reached())
+	assert.Equal(t, characteristic.ContactSensorStateContactDetected, n.sensor.ContactSensorState.GetValue())
+	assert.Contains(t, trp.ppc.alerts.Recent(1)[0].Message, "reached the target")
+
+	assert.False(t, n.Check(29.8, 30.0, 0.5), "Only notifies once")
+	assert.True(t, n.Reached(), "Stays reached within the tolerance")
+	n.Check(29.4, 30.0, 0.5)
+	assert.False(t, n.Reached())
+	assert.True(t, n.Check(30.1, 30.0, 0.5))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/brutella/hc/accessory"
+)
+
+const (
+	// FilterNone passes readings through unchanged
+	FilterNone = "none"
+	// FilterEWMA is an exponentially weighted moving average
+	FilterEWMA = "ewma"
+	// FilterKalman is a one dimensional Kalman filter
+	FilterKalman = "kalman"
+	// FilterMedian is the median of the last N readings
+	FilterMedian = "median"
+
+	defaultFilterAlpha      = 0.3
+	defaultProcessNoise     = 0.01
+	defaultMeasurementNoise = 0.25
+	defaultFilterSamples    = 5
+)
+
+// FilterConfig selects the filter applied to a thermometer's readings
+type FilterConfig struct {
+	Type             string  // FilterNone, FilterEWMA, FilterKalman, FilterMedian
+	Alpha            float64 // FilterEWMA weight of a new reading (0-1), 0 uses 0.3
+	ProcessNoise     float64 // FilterKalman variance of the real temperature between readings, 0 uses 0.01
+	MeasurementNoise float64 // FilterKalman variance of the readings, 0 uses 0.25
+	Samples          int     // FilterMedian number of readings, 0 uses 5
+}
+
+// Filter smooths a series of readings
+type Filter interface {
+	Apply(value float64) float64
+}
+
+// passFilter doesn't change the readings
+type passFilter struct{}
+
+func (f *passFilter) Apply(value float64) float64 {
+	return value
+}
+
+// EWMAFilter is an exponentially weighted moving average
+type EWMAFilter struct {
+	alpha  float64
+	value  float64
+	primed bool
+}
+
+// Apply adds a reading and returns the filtered value
+func (f *EWMAFilter) Apply(value float64) float64 {
+	if !f.primed {
+		f.value = value
+		f.primed = true
+	} else {
+		f.value += f.alpha * (value - f.value)
+	}
+	return f.value
+}
+
+// KalmanFilter estimates a slowly changing temperature from noisy readings.  q is the variance
+// of the real temperature between readings, r is the variance of the readings.
+type KalmanFilter struct {
+	q      float64
+	r      float64
+	x      float64
+	p      float64
+	primed bool
+}
+
+// Apply adds a reading and returns the filtered value
+func (f *KalmanFilter) Apply(value float64) float64 {
+	if !f.primed {
+		f.x = value
+		f.p = f.r
+		f.primed = true
+		return f.x
+	}
+	f.p += f.q
+	k := f.p / (f.p + f.r)
+	f.x += k * (value - f.x)
+	f.p *= 1 - k
+	return f.x
+}
+
+// MedianFilter returns the median of the last N readings
+type MedianFilter struct {
+	values []float64
+	n      int
+}
+
+// Apply adds a reading and returns the filtered value
+func (f *MedianFilter) Apply(value float64) float64 {
+	f.values = append(f.values, value)
+	if len(f.values) > f.n {
+		f.values = f.values[len(f.values)-f.n:]
+	}
+	sorted := append([]float64(nil), f.values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// NewFilter creates the Filter described by the configuration, nil passes readings through
+func NewFilter(fc *FilterConfig) (Filter, error) {
+	if fc == nil {
+		return &passFilter{}, nil
+	}
+	switch fc.Type {
+	case FilterNone, "":
+		return &passFilter{}, nil
+	case FilterEWMA:
+		alpha := fc.Alpha
+		if alpha == 0.0 {
+			alpha = defaultFilterAlpha
+		}
+		if alpha < 0.0 || alpha > 1.0 {
+			return nil, fmt.Errorf("ewma alpha(%0.2f) must be between 0 and 1", alpha)
+		}
+		return &EWMAFilter{alpha: alpha}, nil
+	case FilterKalman:
+		q, r := fc.ProcessNoise, fc.MeasurementNoise
+		if q == 0.0 {
+			q = defaultProcessNoise
+		}
+		if r == 0.0 {
+			r = defaultMeasurementNoise
+		}
+		if q < 0.0 || r < 0.0 {
+			return nil, fmt.Errorf("kalman noise must be positive")
+		}
+		return &KalmanFilter{q: q, r: r}, nil
+	case FilterMedian:
+		n := fc.Samples
+		if n == 0 {
+			n = defaultFilterSamples
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("median samples(%d) must be positive", n)
+		}
+		return &MedianFilter{n: n}, nil
+	}
+	return nil, fmt.Errorf("unknown filter %q", fc.Type)
+}
+
+// FilteredThermometer smooths the readings of a Thermometer, keeping the raw value as well
+type FilteredThermometer struct {
+	mtx         sync.Mutex
+	thermometer Thermometer
+	filter      Filter
+	raw         float64
+	filtered    float64
+}
+
+// NewFilteredThermometer wraps a Thermometer with a Filter
+func NewFilteredThermometer(t Thermometer, f Filter) *FilteredThermometer {
+	return &FilteredThermometer{
+		thermometer: t,
+		filter:      f,
+	}
+}
+
+// Unwrap returns the underlying Thermometer
+func (t *FilteredThermometer) Unwrap() Thermometer {
+	return t.thermometer
+}
+
+// Name returns the name of the underlying Thermometer
+func (t *FilteredThermometer) Name() string {
+	return t.thermometer.Name()
+}
+
+// Calibrate passes a resistance calibration on to the underlying Thermometer
+func (t *FilteredThermometer) Calibrate(ohms float64) error {
+	return t.thermometer.Calibrate(ohms)
+}
+
+// Raw returns the last reading before filtering
+func (t *FilteredThermometer) Raw() float64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.raw
+}
+
+// Temperature returns the filtered temperature
+func (t *FilteredThermometer) Temperature() float64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.filtered
+}
+
+// Update updates the underlying Thermometer and feeds a successful reading to the filter
+func (t *FilteredThermometer) Update() error {
+	err := t.thermometer.Update()
+	if err != nil {
+		return err
+	}
+	raw := t.thermometer.Temperature()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.raw = raw
+	t.filtered = t.filter.Apply(raw)
+	return nil
+}
+
+// Accessory returns the Apple HomeKit accessory of the underlying Thermometer
+func (t *FilteredThermometer) Accessory() *accessory.Accessory {
+	return t.thermometer.Accessory()
+}
+
+// asFilteredThermometer finds the FilteredThermometer underneath any wrappers
+func asFilteredThermometer(t Thermometer) (*FilteredThermometer, bool) {
+	f, ok := findThermometer(t, func(t Thermometer) bool {
+		_, ok := t.(*FilteredThermometer)
+		return ok
+	}).(*FilteredThermometer)
+	return f, ok
+}
+
+// rawTemperature returns the reading of a Thermometer before any filter, with calibration applied
+func rawTemperature(t Thermometer) float64 {
+	f, ok := asFilteredThermometer(t)
+	if !ok {
+		return t.Temperature()
+	}
+	if c, ok := asCalibratedThermometer(t); ok {
+		return c.Calibration().Correct(f.Raw())
+	}
+	return f.Raw()
+}
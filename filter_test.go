@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilters(t *testing.T) {
+	t.Run("EWMA", func(t *testing.T) {
+		f, err := NewFilter(&FilterConfig{Type: FilterEWMA, Alpha: 0.5})
+		assert.NoError(t, err)
+		assert.Equal(t, 20.0, f.Apply(20.0), "First reading primes the filter")
+		assert.Equal(t, 21.0, f.Apply(22.0))
+		assert.Equal(t, 21.5, f.Apply(22.0))
+	})
+
+	t.Run("Kalman", func(t *testing.T) {
+		f, err := NewFilter(&FilterConfig{Type: FilterKalman})
+		assert.NoError(t, err)
+		assert.Equal(t, 25.0, f.Apply(25.0))
+		v := 0.0
+		for i := 0; i < 50; i++ {
+			noise := 1.0
+			if i%2 == 0 {
+				noise = -1.0
+			}
+			v = f.Apply(25.0 + noise)
+		}
+		assert.InDelta(t, 25.0, v, 0.2, "Noise is smoothed out")
+		for i := 0; i < 200; i++ {
+			v = f.Apply(30.0)
+		}
+		assert.InDelta(t, 30.0, v, 0.1, "Follows a real change")
+	})
+
+	t.Run("Median", func(t *testing.T) {
+		f, err := NewFilter(&FilterConfig{Type: FilterMedian, Samples: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, 20.0, f.Apply(20.0))
+		assert.Equal(t, 80.0, f.Apply(80.0))
+		assert.Equal(t, 20.0, f.Apply(20.0), "Spike rejected")
+		assert.Equal(t, 21.0, f.Apply(21.0))
+		assert.Equal(t, 21.0, f.Apply(22.0))
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		f, err := NewFilter(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 12.0, f.Apply(12.0))
+		f, err = NewFilter(&FilterConfig{Type: FilterEWMA})
+		assert.NoError(t, err)
+		assert.Equal(t, defaultFilterAlpha, f.(*EWMAFilter).alpha)
+
+		_, err = NewFilter(&FilterConfig{Type: FilterEWMA, Alpha: 1.5})
+		assert.Error(t, err)
+		_, err = NewFilter(&FilterConfig{Type: FilterMedian, Samples: -1})
+		assert.Error(t, err)
+		_, err = NewFilter(&FilterConfig{Type: "bogus"})
+		assert.Error(t, err)
+	})
+}
+
+func TestFilteredThermometer(t *testing.T) {
+	fake := &FakeThermometer{name: "fake", temp: 20.0}
+	f, _ := NewFilter(&FilterConfig{Type: FilterEWMA, Alpha: 0.5})
+	ft := NewFilteredThermometer(fake, f)
+	ct := NewCalibratedThermometer(NewSampledThermometer(ft, nil), mftr,
+		&ProbeCalibration{Gain: 1.0, Offset: 1.0})
+
+	assert.NoError(t, ft.Update())
+	fake.temp = 30.0
+	assert.NoError(t, ft.Update())
+	assert.Equal(t, 25.0, ft.Temperature())
+	assert.Equal(t, 30.0, ft.Raw())
+
+	fake.temp = 0.0
+	fake.updateError = errors.New("broken")
+	assert.Error(t, ft.Update())
+	assert.Equal(t, 25.0, ft.Temperature(), "Failed readings don't reach the filter")
+	assert.Equal(t, 30.0, ft.Raw())
+
+	s, _ := asSampledThermometer(ct)
+	fake.updateError = nil
+	fake.temp = 30.0
+	s.Sample()
+	assert.Equal(t, 28.5, ct.Temperature())
+	assert.Equal(t, 31.0, rawTemperature(ct), "Raw is calibrated but not filtered")
+	assert.Equal(t, 30.0, rawTemperature(fake))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Filtration keeps track of how long the pump has run each day, and when the daily filtration
+// was last completed.  Any pump run counts, so an afternoon of solar heating filters the water
+// as well as the early morning sweep does.
+type Filtration struct {
+	mtx       sync.Mutex
+	day       string        // day the run time is being counted for
+	ran       time.Duration // pump run time on day
+	last      time.Time
+	completed time.Time // when the pump last ran for the full run time in a day
+	deferred  string    // day the morning run was left to a planned solar run
+}
+
+// NewFiltration creates a Filtration that considers the filtration done at now, so a restart
+// doesn't kick off a run
+func NewFiltration(now time.Time) *Filtration {
+	return &Filtration{completed: now}
+}
+
+// clone returns a copy of the filtration history, which is then kept separately
+func (f *Filtration) clone() *Filtration {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return &Filtration{day: f.day, ran: f.ran, last: f.last, completed: f.completed, deferred: f.deferred}
+}
+
+// Account adds the time since the last call to the day's run time if the pump is running.  It
+// returns true when the run time for the day has just been reached.
+func (f *Filtration) Account(now time.Time, running bool, runtime time.Duration) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	dt := time.Duration(0)
+	if !f.last.IsZero() {
+		dt = now.Sub(f.last)
+		if dt > time.Minute {
+			dt = time.Minute
+		}
+	}
+	f.last = now
+	if day := now.Format(dayFormat); day != f.day {
+		f.day = day
+		f.ran = 0
+	}
+	if !running || dt <= 0 {
+		return false
+	}
+	before := f.ran
+	f.ran += dt
+	if before < runtime && f.ran >= runtime {
+		f.completed = now
+		return true
+	}
+	return false
+}
+
+// Ran returns how long the pump has run on the day of now
+func (f *Filtration) Ran(now time.Time) time.Duration {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if now.Format(dayFormat) != f.day {
+		return 0
+	}
+	return f.ran
+}
+
+// Completed returns when the daily filtration was last completed
+func (f *Filtration) Completed() time.Time {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.completed
+}
+
+// Defer records that the morning run of the day of now was left to a planned solar run.  It
+// returns true the first time it is recorded for the day.
+func (f *Filtration) Defer(now time.Time) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	day := now.Format(dayFormat)
+	if f.deferred == day {
+		return false
+	}
+	f.deferred = day
+	return true
+}
+
+// Deferred returns true if the morning run of the day of now was left to a solar run
+func (f *Filtration) Deferred(now time.Time) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.deferred == now.Format(dayFormat)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiltration(t *testing.T) {
+	day := time.Date(2021, time.June, 21, 4, 0, 0, 0, time.Local)
+	f := NewFiltration(day.Add(-24 * time.Hour))
+	runtime := 3 * time.Minute
+
+	assert.False(t, f.Account(day, true, runtime))
+	assert.False(t, f.Account(day.Add(time.Minute), true, runtime))
+	assert.False(t, f.Account(day.Add(90*time.Second), false, runtime), "Off time isn't counted")
+	assert.Equal(t, time.Minute, f.Ran(day))
+	assert.False(t, f.Account(day.Add(time.Hour), true, runtime))
+	assert.Equal(t, 2*time.Minute, f.Ran(day), "Long gaps count for at most a minute")
+	assert.Equal(t, day.Add(-24*time.Hour), f.Completed())
+	assert.True(t, f.Account(day.Add(time.Hour+time.Minute), true, runtime))
+	assert.Equal(t, day.Add(time.Hour+time.Minute), f.Completed())
+	assert.False(t, f.Account(day.Add(time.Hour+2*time.Minute), true, runtime), "Only completed once a day")
+
+	tomorrow := day.AddDate(0, 0, 1)
+	assert.Equal(t, time.Duration(0), f.Ran(tomorrow))
+	f.Account(tomorrow, true, runtime)
+	assert.Equal(t, time.Minute, f.Ran(tomorrow), "Yesterday's run time isn't carried over")
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	// hourFormat keys the hourly flow history
+	hourFormat = "2006-01-02 15"
+	// flowSaveInterval is how often the flow history is written to disk
+	flowSaveInterval = 10 * time.Minute
+	// turnoverWindow is the period the gallons filtered are counted over
+	turnoverWindow = 24 * time.Hour
+)
+
+// FlowMeterConfig describes a hall-effect paddle-wheel flow meter wired to a GPIO
+type FlowMeterConfig struct {
+	Gpio    uint8   // GPIO the pulse output is wired to
+	KFactor float64 // pulses per gallon, from the meter's data sheet
+	Pull    string  // "up", "down" or "float", empty uses up for an open collector output
+}
+
+// FlowMeter counts the pulses from a flow meter, giving the flow rate and the gallons pumped
+type FlowMeter struct {
+	mtx      sync.Mutex
+	pin      PiPin
+	path     string
+	kFactor  float64
+	pulses   uint64 // counted since the last Sample
+	gpm      float64
+	last     time.Time
+	lastSave time.Time
+	Total    float64            // gallons ever pumped
+	Hours    map[string]float64 // hour -> gallons
+	done     chan bool
+}
+
+// NewFlowMeter creates a FlowMeter from its configuration, restoring any history saved to path.
+// It returns nil when there is no meter configured.
+func NewFlowMeter(fc *FlowMeterConfig, path string) (*FlowMeter, error) {
+	if fc == nil {
+		return nil, nil
+	}
+	if fc.Gpio == 0 {
+		return nil, fmt.Errorf("no GPIO for the flow meter")
+	}
+	return newFlowMeter(fc, NewGpio(fc.Gpio), path)
+}
+
+func newFlowMeter(fc *FlowMeterConfig, pin PiPin, path string) (*FlowMeter, error) {
+	if fc.KFactor <= 0.0 {
+		return nil, fmt.Errorf("flow meter K-factor must be positive, not %0.2f", fc.KFactor)
+	}
+	pull, err := (&InputConfig{Pull: fc.Pull}).pull()
+	if err != nil {
+		return nil, err
+	}
+	m := FlowMeter{
+		pin:      pin,
+		path:     path,
+		kFactor:  fc.KFactor,
+		Hours:    map[string]float64{},
+		last:     time.Now(),
+		lastSave: time.Now(),
+		done:     make(chan bool),
+	}
+	if buf, err := ioutil.ReadFile(path); err == nil {
+		if err = json.Unmarshal(buf, &m); err != nil {
+			Error("Could not read flow history: %v", err)
+		}
+	}
+	if m.Hours == nil {
+		m.Hours = map[string]float64{}
+	}
+	m.pin.InputEdge(pull, RisingEdge)
+	return &m, nil
+}
+
+// count adds a pulse
+func (m *FlowMeter) count() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.pulses++
+}
+
+// Start counts pulses in the background
+func (m *FlowMeter) Start() {
+	go func() {
+		for {
+			if m.pin.WaitForEdge(inputPoll) {
+				m.count()
+			}
+			select {
+			case <-m.done:
+				return
+			default: // Required to not block
+			}
+		}
+	}()
+}
+
+// Stop ends the pulse counting
+func (m *FlowMeter) Stop() {
+	m.done <- true
+}
+
+// Sample converts the pulses since the last call to a flow rate, and adds them to the history
+func (m *FlowMeter) Sample(now time.Time) {
+	m.mtx.Lock()
+	if !now.After(m.last) {
+		m.mtx.Unlock()
+		return
+	}
+	gallons := float64(m.pulses) / m.kFactor
+	m.gpm = gallons / now.Sub(m.last).Minutes()
+	m.pulses = 0
+	m.last = now
+	m.Total += gallons
+	m.Hours[now.Format(hourFormat)] += gallons
+	oldest := now.AddDate(0, 0, -energyDays).Format(hourFormat)
+	for hour := range m.Hours {
+		if hour < oldest {
+			delete(m.Hours, hour)
+		}
+	}
+	save := now.Sub(m.lastSave) > flowSaveInterval
+	m.mtx.Unlock()
+	if save {
+		m.Save()
+	}
+}
+
+// GPM returns the flow rate measured by the last Sample
+func (m *FlowMeter) GPM() float64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.gpm
+}
+
+// Gallons returns the gallons pumped in the hours after the one holding since, through now
+func (m *FlowMeter) Gallons(since, now time.Time) float64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	from := since.Format(hourFormat)
+	to := now.Format(hourFormat)
+	gallons := 0.0
+	for hour, g := range m.Hours {
+		if hour > from && hour <= to {
+			gallons += g
+		}
+	}
+	return gallons
+}
+
+// Save writes the flow history to disk
+func (m *FlowMeter) Save() {
+	m.mtx.Lock()
+	m.lastSave = time.Now()
+	buf, err := json.Marshal(m)
+	m.mtx.Unlock()
+	if err == nil {
+		err = ioutil.WriteFile(m.path, buf, 0644)
+	}
+	if err != nil {
+		Error("Could not save flow history: %v", err)
+	}
+}
+
+// UpdateFlow samples the flow meter, if there is one
+func (ppc *PoolPumpController) UpdateFlow() {
+	if ppc.flowMeter != nil {
+		ppc.flowMeter.Sample(time.Now())
+	}
+}
+
+// Turnover returns the gallons filtered over the last day, and how many times that turned
+// over the pool.  Turnovers are 0 without the pool volume, and both are 0 without a meter.
+func (ppc *PoolPumpController) Turnover(now time.Time) (float64, float64) {
+	if ppc.flowMeter == nil {
+		return 0.0, 0.0
+	}
+	gallons := ppc.flowMeter.Gallons(now.Add(-turnoverWindow), now)
+	if ppc.config.cfg.PoolGallons <= 0.0 {
+		return gallons, 0.0
+	}
+	return gallons, gallons / ppc.config.cfg.PoolGallons
+}
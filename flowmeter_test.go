@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowMeter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flow")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flow.json")
+	pin := &TestPin{pin: 12, wake: make(chan bool)}
+	m, err := newFlowMeter(&FlowMeterConfig{Gpio: 12, KFactor: 100.0}, pin, path)
+	assert.NoError(t, err)
+	assert.Equal(t, PullUp, pin.pull)
+	assert.Equal(t, RisingEdge, pin.edge)
+
+	now := time.Date(2021, time.June, 21, 10, 0, 0, 0, time.Local)
+	m.last = now
+	for i := 0; i < 2000; i++ {
+		m.count()
+	}
+	m.Sample(now.Add(30 * time.Second))
+	assert.InDelta(t, 40.0, m.GPM(), 0.001, "20 gallons in half a minute")
+	for i := 0; i < 1000; i++ {
+		m.count()
+	}
+	m.Sample(now.Add(time.Hour))
+	assert.InDelta(t, 10.0/59.5, m.GPM(), 0.001)
+	assert.InDelta(t, 30.0, m.Total, 0.001)
+	assert.InDelta(t, 10.0, m.Gallons(now, now.Add(time.Hour)), 0.001, "The first hour is before since")
+	assert.InDelta(t, 30.0, m.Gallons(now.Add(-time.Hour), now.Add(time.Hour)), 0.001)
+
+	t.Run("Persisted", func(t *testing.T) {
+		m.Save()
+		restored, err := newFlowMeter(&FlowMeterConfig{Gpio: 12, KFactor: 100.0}, &TestPin{}, path)
+		assert.NoError(t, err)
+		assert.InDelta(t, 30.0, restored.Total, 0.001)
+		assert.Len(t, restored.Hours, 2)
+	})
+
+	t.Run("Bad Configs", func(t *testing.T) {
+		m, err := NewFlowMeter(nil, path)
+		assert.NoError(t, err)
+		assert.Nil(t, m)
+		_, err = NewFlowMeter(&FlowMeterConfig{KFactor: 100.0}, path)
+		assert.Error(t, err, "No GPIO")
+		_, err = newFlowMeter(&FlowMeterConfig{Gpio: 12}, &TestPin{}, path)
+		assert.Error(t, err, "No K-factor")
+		_, err = newFlowMeter(&FlowMeterConfig{Gpio: 12, KFactor: 100.0, Pull: "sideways"}, &TestPin{}, path)
+		assert.Error(t, err)
+	})
+}
+
+func TestMeasuredFlow(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 25.0, 20.0, 33.0, OFF)
+	dir, err := ioutil.TempDir("", "flow")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	m, err := newFlowMeter(&FlowMeterConfig{Gpio: 12, KFactor: 100.0}, &TestPin{}, filepath.Join(dir, "flow.json"))
+	assert.NoError(t, err)
+	cfg := trp.ppc.config.cfg
+	gpm, volume := cfg.FlowGPM, cfg.PoolGallons
+	defer func() { cfg.FlowGPM, cfg.PoolGallons = gpm, volume }()
+	cfg.FlowGPM = 20.0
+	cfg.PoolGallons = 0.0
+	assert.Equal(t, 20.0, trp.ppc.flowGPM(), "Assumed without a meter")
+
+	trp.ppc.flowMeter = m
+	now := time.Now()
+	y, mo, d := now.Date()
+	dawn := time.Date(y, mo, d, 4, 0, 0, 0, time.Local)
+	m.last = dawn.Add(-12 * time.Hour)
+	m.pulses = 2000000 // 20,000 gallons
+	m.Sample(dawn.Add(-12*time.Hour + 5*time.Minute))
+	assert.InDelta(t, 4000.0, trp.ppc.flowGPM(), 0.001, "Measured")
+	assert.InDelta(t, 4000.0, *trp.ppc.StatusReport().FlowGPM, 0.001)
+	w := httptest.NewRecorder()
+	h := Handler{ppc: trp.ppc}
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/flow", nil))
+	assert.Equal(t, 200, w.Code, "Graphed on its own")
+
+	gallons, turnovers := trp.ppc.Turnover(dawn)
+	assert.InDelta(t, 20000.0, gallons, 0.001)
+	assert.Equal(t, 0.0, turnovers, "Pool volume unknown")
+	cfg.PoolGallons = 25000.0
+	_, turnovers = trp.ppc.Turnover(dawn)
+	assert.InDelta(t, 0.8, turnovers, 0.001)
+
+	trp.ppc.filtration.completed = dawn.Add(-48 * time.Hour)
+	cfg.PoolGallons = 15000.0
+	assert.True(t, trp.ppc.filtrationDue(dawn), "A turnover doesn't replace the cleaning run")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+)
+
+const (
+	defaultFlowGraceSeconds = 60.0
+	defaultFlowRetries      = 3.0
+	defaultFlowRetryMinutes = 5.0
+)
+
+// flowAction is what the controller has to do after a FlowWatchdog check
+type flowAction int
+
+const (
+	// flowOK means there is flow, or it is too soon to tell
+	flowOK flowAction = iota
+	// flowRetry means the pump has to stop, and can be tried again after the backoff
+	flowRetry
+	// flowFault means the retries are used up, the pump is held off until acknowledged
+	flowFault
+)
+
+func flowGrace(cfg *PersistedConfig) time.Duration {
+	return seconds(cfg.FlowGraceSeconds, time.Duration(defaultFlowGraceSeconds*float64(time.Second)))
+}
+
+func flowRetries(cfg *PersistedConfig) int {
+	if cfg.FlowRetries <= 0.0 {
+		return int(defaultFlowRetries)
+	}
+	return int(cfg.FlowRetries)
+}
+
+// flowBackoff returns how long the pump is held off after the given number of failed starts,
+// doubling each time
+func flowBackoff(cfg *PersistedConfig, attempts int) time.Duration {
+	minutes := cfg.FlowRetryMinutes
+	if minutes <= 0.0 {
+		minutes = defaultFlowRetryMinutes
+	}
+	return time.Duration(minutes*float64(time.Minute)) << uint(attempts-1)
+}
+
+// FlowWatchdog confirms the flow switch closes once the pump is running.  A pump that has
+// lost its prime runs dry, so without flow the pump is stopped and retried with a growing
+// backoff, and after the retries a fault is latched until it is acknowledged.
+type FlowWatchdog struct {
+	mtx       sync.Mutex
+	running   bool
+	lastFlow  time.Time // when the pump started, or flow was last seen while running
+	attempts  int       // failed starts in a row
+	retryAt   time.Time // the pump is held off until then
+	fault     bool
+	faultTime time.Time
+	reason    string
+	status    *characteristic.StatusFault
+}
+
+// NewFlowWatchdog creates a FlowWatchdog without a fault
+func NewFlowWatchdog() *FlowWatchdog {
+	return &FlowWatchdog{status: characteristic.NewStatusFault()}
+}
+
+// StatusFault returns the HomeKit characteristic that shows the fault
+func (w *FlowWatchdog) StatusFault() *characteristic.StatusFault {
+	return w.status
+}
+
+// Check looks at whether the pump is on and the flow switch is closed.  The flow has to be
+// seen within the grace period after starting, and can't be lost for longer than that.
+func (w *FlowWatchdog) Check(cfg *PersistedConfig, pumpOn, flowing bool, now time.Time) (flowAction, string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if !pumpOn {
+		w.running = false
+		return flowOK, ""
+	}
+	if !w.running {
+		w.running = true
+		w.lastFlow = now
+	}
+	if flowing {
+		if w.attempts > 0 {
+			Log("Flow confirmed after %d failed starts", w.attempts)
+			w.attempts = 0
+		}
+		w.lastFlow = now
+		return flowOK, ""
+	}
+	grace := flowGrace(cfg)
+	if now.Sub(w.lastFlow) < grace {
+		return flowOK, ""
+	}
+	w.running = false
+	w.attempts++
+	if w.attempts > flowRetries(cfg) {
+		w.fault = true
+		w.faultTime = now
+		w.reason = fmt.Sprintf("no flow for %s after %d attempts", grace, w.attempts)
+		w.status.SetValue(characteristic.StatusFaultGeneralFault)
+		return flowFault, w.reason
+	}
+	w.retryAt = now.Add(flowBackoff(cfg, w.attempts))
+	return flowRetry, fmt.Sprintf("no flow for %s, attempt %d, retrying at %s", grace, w.attempts,
+		w.retryAt.Format("15:04"))
+}
+
+// Blocked returns true while the pump can't be started, waiting out a retry or in a fault
+func (w *FlowWatchdog) Blocked(now time.Time) (bool, string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.fault {
+		return true, "flow fault, " + w.reason
+	}
+	if now.Before(w.retryAt) {
+		return true, fmt.Sprintf("no flow, retrying at %s", w.retryAt.Format("15:04"))
+	}
+	return false, ""
+}
+
+// Fault returns true if the pump is in a fault state, along with the reason
+func (w *FlowWatchdog) Fault() (bool, string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.fault, w.reason
+}
+
+// Acknowledge clears the fault so the pump can run again
+func (w *FlowWatchdog) Acknowledge() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.fault {
+		Log("Flow fault acknowledged: %s", w.reason)
+	}
+	w.fault = false
+	w.reason = ""
+	w.running = false
+	w.attempts = 0
+	w.retryAt = time.Time{}
+	w.status.SetValue(characteristic.StatusFaultNoFault)
+}
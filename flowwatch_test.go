@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowWatchdog(t *testing.T) {
+	cfg := &PersistedConfig{FlowGraceSeconds: 30.0, FlowRetries: 2.0, FlowRetryMinutes: 5.0}
+	w := NewFlowWatchdog()
+	now := time.Now()
+
+	t.Run("Flow", func(t *testing.T) {
+		action, _ := w.Check(cfg, true, false, now)
+		assert.Equal(t, flowOK, action, "Starting")
+		action, _ = w.Check(cfg, true, true, now.Add(20*time.Second))
+		assert.Equal(t, flowOK, action)
+		action, _ = w.Check(cfg, true, false, now.Add(45*time.Second))
+		assert.Equal(t, flowOK, action, "Lost for less than the grace period")
+		action, _ = w.Check(cfg, false, false, now.Add(time.Hour))
+		assert.Equal(t, flowOK, action, "Pump is off")
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		start := now.Add(2 * time.Hour)
+		w.Check(cfg, true, false, start)
+		action, reason := w.Check(cfg, true, false, start.Add(30*time.Second))
+		assert.Equal(t, flowRetry, action)
+		assert.Contains(t, reason, "attempt 1")
+		blocked, _ := w.Blocked(start.Add(time.Minute))
+		assert.True(t, blocked)
+		blocked, _ = w.Blocked(start.Add(6 * time.Minute))
+		assert.False(t, blocked)
+
+		start = start.Add(6 * time.Minute)
+		w.Check(cfg, true, false, start)
+		action, _ = w.Check(cfg, true, false, start.Add(30*time.Second))
+		assert.Equal(t, flowRetry, action)
+		blocked, _ = w.Blocked(start.Add(9 * time.Minute))
+		assert.True(t, blocked, "Backoff doubles")
+		blocked, _ = w.Blocked(start.Add(11 * time.Minute))
+		assert.False(t, blocked)
+	})
+
+	t.Run("Fault", func(t *testing.T) {
+		start := now.Add(3 * time.Hour)
+		w.Check(cfg, false, false, start)
+		w.Check(cfg, true, false, start)
+		action, reason := w.Check(cfg, true, false, start.Add(time.Minute))
+		assert.Equal(t, flowFault, action)
+		assert.Equal(t, "no flow for 30s after 3 attempts", reason)
+		assert.Equal(t, characteristic.StatusFaultGeneralFault, w.StatusFault().GetValue())
+		blocked, _ := w.Blocked(start.Add(24 * time.Hour))
+		assert.True(t, blocked, "Latched")
+
+		w.Acknowledge()
+		fault, _ := w.Fault()
+		assert.False(t, fault)
+		blocked, _ = w.Blocked(start.Add(time.Minute))
+		assert.False(t, blocked)
+		assert.Equal(t, characteristic.StatusFaultNoFault, w.StatusFault().GetValue())
+	})
+
+	t.Run("Flow Resets Attempts", func(t *testing.T) {
+		start := now.Add(4 * time.Hour)
+		w.Check(cfg, false, false, start)
+		w.Check(cfg, true, false, start)
+		action, _ := w.Check(cfg, true, false, start.Add(30*time.Second))
+		assert.Equal(t, flowRetry, action)
+		start = start.Add(10 * time.Minute)
+		w.Check(cfg, true, true, start)
+		assert.Equal(t, 0, w.attempts)
+	})
+}
+
+func TestCheckFlow(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 25.0, 20.0, 33.0, OFF)
+	flow, flowPin := testInput(t, &InputConfig{Role: InputFlow, Gpio: 6}, High)
+	trp.ppc.inputs = &Inputs{inputs: []*DigitalInput{flow}}
+	trp.ppc.flowWatch.attempts = flowRetries(trp.ppc.config.cfg) // the retries are used up
+
+	trp.ppc.switches.SetState(SWEEP, true, 1.0)
+	trp.ppc.CheckFlow()
+	assert.Equal(t, SWEEP, trp.ppc.switches.State(), "Within the grace period")
+	trp.ppc.flowWatch.lastFlow = time.Now().Add(-time.Hour)
+	trp.ppc.CheckFlow()
+	assert.Equal(t, OFF, trp.ppc.switches.State(), "Pump and sweep stopped")
+	alerts := trp.ppc.alerts.Recent(1)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "Flow", alerts[0].Source)
+	assert.NotEmpty(t, trp.ppc.StatusReport().FlowFault)
+
+	trp.ppc.switches.SetState(PUMP, true, 1.0)
+	assert.Equal(t, OFF, trp.ppc.switches.State(), "Interlocked, even manually")
+
+	h := Handler{ppc: trp.ppc}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/flowAck", nil))
+	assert.Equal(t, 401, w.Code)
+	fault, _ := trp.ppc.flowWatch.Fault()
+	assert.True(t, fault)
+
+	r := httptest.NewRequest("POST", "/flowAck", nil)
+	r.SetBasicAuth("admin", defaultPin)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	fault, _ = trp.ppc.flowWatch.Fault()
+	assert.False(t, fault)
+
+	flowPin.state = Low
+	flow.Sample(time.Now())
+	flow.Sample(time.Now().Add(time.Second))
+	trp.ppc.switches.SetState(PUMP, true, 1.0)
+	trp.ppc.CheckFlow()
+	assert.Equal(t, PUMP, trp.ppc.switches.State())
+	trp.ppc.switches.StopAll(true)
+}
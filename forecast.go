@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// ForecastOpenMeteo fetches the Open-Meteo hourly forecast JSON from a URL
+	ForecastOpenMeteo = "openmeteo"
+	// ForecastFile reads a forecast in the Open-Meteo format from a file
+	ForecastFile = "file"
+
+	// defaultForecastURL is the Open-Meteo forecast API
+	defaultForecastURL = "https://api.open-meteo.com/v1/forecast"
+	// forecastRefresh is how often the forecast is fetched
+	forecastRefresh = time.Hour
+	// forecastDays is how far ahead the forecast is requested, the plan needs tomorrow
+	forecastDays = 3
+)
+
+// ForecastConfig describes where the weather forecast comes from
+type ForecastConfig struct {
+	Type      string  // ForecastOpenMeteo or ForecastFile
+	URL       string  // ForecastOpenMeteo API, empty uses api.open-meteo.com, ex. a local mirror
+	Path      string  // ForecastFile holding the forecast JSON
+	Latitude  float64 // site latitude in degrees, north is positive
+	Longitude float64 // site longitude in degrees, east is positive
+}
+
+// ForecastHour is the forecast weather for the hour starting at Time
+type ForecastHour struct {
+	Time        time.Time
+	Temperature float64 // degrees celsius
+	CloudCover  float64 // percent
+	Irradiance  float64 // global horizontal irradiance, W/m^2
+}
+
+// Forecast is the hourly weather forecast, in time order
+type Forecast struct {
+	Source  string
+	Fetched time.Time
+	Hours   []ForecastHour
+}
+
+// Day returns the hours of the forecast on the same local day as t
+func (f *Forecast) Day(t time.Time) []ForecastHour {
+	y, m, d := t.Date()
+	hours := []ForecastHour{}
+	for _, h := range f.Hours {
+		hy, hm, hd := h.Time.In(t.Location()).Date()
+		if hy == y && hm == m && hd == d {
+			hours = append(hours, h)
+		}
+	}
+	return hours
+}
+
+// ForecastProvider supplies the hourly weather forecast
+type ForecastProvider interface {
+	Name() string
+	Forecast(now time.Time) (*Forecast, error)
+}
+
+// openMeteoForecast is the part of the Open-Meteo response used, requested with unix times
+type openMeteoForecast struct {
+	Hourly struct {
+		Time               []int64   `json:"time"`
+		Temperature2m      []float64 `json:"temperature_2m"`
+		CloudCover         []float64 `json:"cloud_cover"`
+		ShortwaveRadiation []float64 `json:"shortwave_radiation"`
+	} `json:"hourly"`
+}
+
+// parseForecast reads the Open-Meteo hourly forecast JSON
+func parseForecast(source string, buf []byte, now time.Time) (*Forecast, error) {
+	var om openMeteoForecast
+	if err := json.Unmarshal(buf, &om); err != nil {
+		return nil, fmt.Errorf("could not parse forecast: %w", err)
+	}
+	h := om.Hourly
+	if len(h.Time) == 0 {
+		return nil, errors.New("forecast has no hours")
+	}
+	if len(h.Temperature2m) != len(h.Time) || len(h.CloudCover) != len(h.Time) ||
+		len(h.ShortwaveRadiation) != len(h.Time) {
+		return nil, errors.New("forecast is missing hourly temperature_2m, cloud_cover or shortwave_radiation")
+	}
+	f := Forecast{Source: source, Fetched: now}
+	for i, t := range h.Time {
+		f.Hours = append(f.Hours, ForecastHour{
+			Time:        time.Unix(t, 0),
+			Temperature: h.Temperature2m[i],
+			CloudCover:  h.CloudCover[i],
+			Irradiance:  h.ShortwaveRadiation[i],
+		})
+	}
+	return &f, nil
+}
+
+// OpenMeteoForecast fetches the forecast from the Open-Meteo API, or anything serving the
+// same format
+type OpenMeteoForecast struct {
+	url    string
+	client *http.Client
+}
+
+// NewOpenMeteoForecast creates an OpenMeteoForecast for the site, base of "" uses api.open-meteo.com
+func NewOpenMeteoForecast(base string, latitude, longitude float64) *OpenMeteoForecast {
+	if base == "" {
+		base = defaultForecastURL
+	}
+	return &OpenMeteoForecast{
+		url: fmt.Sprintf("%s?latitude=%0.4f&longitude=%0.4f&hourly=temperature_2m,cloud_cover,"+
+			"shortwave_radiation&timeformat=unixtime&forecast_days=%d", base, latitude, longitude, forecastDays),
+		client: &http.Client{Timeout: networkTimeout},
+	}
+}
+
+// Name describes the OpenMeteoForecast
+func (p *OpenMeteoForecast) Name() string {
+	return "Open-Meteo"
+}
+
+// Forecast fetches the forecast
+func (p *OpenMeteoForecast) Forecast(now time.Time) (*Forecast, error) {
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("forecast request failed: %s", resp.Status)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseForecast(p.Name(), buf, now)
+}
+
+// FileForecast reads the forecast from a file, ex. one written by a cron job
+type FileForecast struct {
+	path string
+}
+
+// Name describes the FileForecast
+func (p *FileForecast) Name() string {
+	return p.path
+}
+
+// Forecast reads the forecast file
+func (p *FileForecast) Forecast(now time.Time) (*Forecast, error) {
+	buf, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	return parseForecast(p.Name(), buf, now)
+}
+
+// NewForecastProvider creates the ForecastProvider described by the configuration
+func NewForecastProvider(fc *ForecastConfig) (ForecastProvider, error) {
+	if fc == nil {
+		return nil, nil
+	}
+	switch fc.Type {
+	case ForecastOpenMeteo:
+		if fc.Latitude < -90.0 || fc.Latitude > 90.0 || fc.Longitude < -180.0 || fc.Longitude > 180.0 {
+			return nil, fmt.Errorf("invalid site coordinates(%0.3f, %0.3f)", fc.Latitude, fc.Longitude)
+		}
+		return NewOpenMeteoForecast(fc.URL, fc.Latitude, fc.Longitude), nil
+	case ForecastFile:
+		if fc.Path == "" {
+			return nil, errors.New("no forecast file configured")
+		}
+		return &FileForecast{path: fc.Path}, nil
+	}
+	return nil, fmt.Errorf("unknown forecast source %q", fc.Type)
+}
+
+// Forecaster keeps the last forecast from a ForecastProvider
+type Forecaster struct {
+	mtx      sync.Mutex
+	provider ForecastProvider
+	forecast *Forecast
+	err      error
+}
+
+// NewForecaster creates a Forecaster for the provider, which may be nil
+func NewForecaster(p ForecastProvider) *Forecaster {
+	return &Forecaster{provider: p}
+}
+
+// Update fetches the forecast, the last good one is kept if it fails
+func (f *Forecaster) Update(now time.Time) error {
+	if f.provider == nil {
+		return nil
+	}
+	forecast, err := f.provider.Forecast(now)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.err = err
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.provider.Name(), err)
+	}
+	f.forecast = forecast
+	return nil
+}
+
+// Latest returns the last forecast fetched, nil if there is none, and the error from the last update
+func (f *Forecaster) Latest() (*Forecast, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.forecast, f.err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testForecast returns Open-Meteo JSON for two days from midnight, highs of today and
+// tomorrow, with sun from 10:00 to 16:00 each day
+func testForecast(midnight time.Time, today, tomorrow float64) []byte {
+	var om openMeteoForecast
+	for i := 0; i < 48; i++ {
+		t := midnight.Add(time.Duration(i) * time.Hour)
+		high := today
+		if i >= 24 {
+			high = tomorrow
+		}
+		sun := 0.0
+		if t.Hour() >= 10 && t.Hour() < 16 {
+			sun = 600.0
+		}
+		om.Hourly.Time = append(om.Hourly.Time, t.Unix())
+		om.Hourly.Temperature2m = append(om.Hourly.Temperature2m, high-float64(12-t.Hour()%12)/2.0)
+		om.Hourly.CloudCover = append(om.Hourly.CloudCover, 10.0)
+		om.Hourly.ShortwaveRadiation = append(om.Hourly.ShortwaveRadiation, sun)
+	}
+	buf, _ := json.Marshal(om)
+	return buf
+}
+
+func TestParseForecast(t *testing.T) {
+	midnight := time.Date(2021, time.June, 21, 0, 0, 0, 0, time.Local)
+	f, err := parseForecast("test", testForecast(midnight, 30.0, 20.0), midnight)
+	assert.NoError(t, err)
+	assert.Len(t, f.Hours, 48)
+	assert.Len(t, f.Day(midnight.Add(5*time.Hour)), 24)
+	assert.Equal(t, 600.0, f.Day(midnight)[12].Irradiance)
+	assert.Empty(t, f.Day(midnight.AddDate(0, 0, 2)))
+
+	_, err = parseForecast("test", []byte(`{"hourly": {"time": [1624233600], "temperature_2m": [20]}}`), midnight)
+	assert.Error(t, err, "Missing fields")
+	_, err = parseForecast("test", []byte(`{"hourly": {}}`), midnight)
+	assert.Error(t, err)
+	_, err = parseForecast("test", []byte(`<html>`), midnight)
+	assert.Error(t, err)
+}
+
+func TestForecastProviders(t *testing.T) {
+	midnight := time.Date(2021, time.June, 21, 0, 0, 0, 0, time.Local)
+	forecast := testForecast(midnight, 30.0, 20.0)
+
+	t.Run("Local HTTP", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "unixtime", r.URL.Query().Get("timeformat"))
+			assert.Equal(t, "37.3000", r.URL.Query().Get("latitude"))
+			w.Write(forecast)
+		}))
+		defer server.Close()
+		p, err := NewForecastProvider(&ForecastConfig{Type: ForecastOpenMeteo, URL: server.URL,
+			Latitude: 37.3, Longitude: -121.9})
+		assert.NoError(t, err)
+		f, err := p.Forecast(midnight)
+		assert.NoError(t, err)
+		assert.Len(t, f.Hours, 48)
+		assert.Equal(t, "Open-Meteo", f.Source)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "forecast")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "forecast.json")
+		fc := &ForecastConfig{Type: ForecastFile, Path: path}
+		p, err := NewForecastProvider(fc)
+		assert.NoError(t, err)
+
+		forecaster := NewForecaster(p)
+		assert.Error(t, forecaster.Update(midnight), "No file yet")
+		assert.NoError(t, ioutil.WriteFile(path, forecast, 0644))
+		assert.NoError(t, forecaster.Update(midnight))
+		assert.NoError(t, os.Remove(path))
+		assert.Error(t, forecaster.Update(midnight))
+		f, err := forecaster.Latest()
+		assert.Error(t, err)
+		assert.Len(t, f.Hours, 48, "Last good forecast is kept")
+	})
+
+	t.Run("Bad Configs", func(t *testing.T) {
+		p, err := NewForecastProvider(nil)
+		assert.NoError(t, err)
+		assert.Nil(t, p)
+		_, err = NewForecastProvider(&ForecastConfig{Type: ForecastOpenMeteo, Latitude: 97.3})
+		assert.Error(t, err)
+		_, err = NewForecastProvider(&ForecastConfig{Type: ForecastFile})
+		assert.Error(t, err)
+		_, err = NewForecastProvider(&ForecastConfig{Type: "bogus"})
+		assert.Error(t, err)
+	})
+}
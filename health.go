@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+)
+
+// Health is the condition of a sensor
+type Health int
+
+const (
+	// HealthOK means the sensor readings are believable
+	HealthOK Health = iota
+	// HealthStale means there hasn't been a reading recently
+	HealthStale
+	// HealthOutOfRange means the reading is outside of what the probe can measure
+	HealthOutOfRange
+	// HealthStuck means the reading hasn't changed in a long time
+	HealthStuck
+	// HealthNoisy means the readings jump around too much to be trusted
+	HealthNoisy
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthOK:
+		return "OK"
+	case HealthStale:
+		return "Stale"
+	case HealthOutOfRange:
+		return "Out of Range"
+	case HealthStuck:
+		return "Stuck"
+	case HealthNoisy:
+		return "Noisy"
+	}
+	return "Unknown"
+}
+
+const (
+	// healthStaleAfter is the age at which a reading is no longer trusted
+	healthStaleAfter = 2 * time.Minute
+	// healthStuckAfter is how long a reading from a GPIO probe can stay exactly the same
+	healthStuckAfter = 2 * time.Hour
+	// healthStuckChange is the smallest change that counts as a new value
+	healthStuckChange = 0.001
+	// healthNoiseLimit is the largest believable standard deviation of the change between
+	// readings.  A steady trend has a small deviation, a loose connection doesn't.
+	healthNoiseLimit = 1.5
+	// healthSamples is the number of readings used to judge the noise
+	healthSamples = 20
+	// healthMin and healthMax bound a believable reading, they match the HomeKit range
+	healthMin = -20.0
+	healthMax = 100.0
+)
+
+// SensorHealth judges the readings of a thermometer, and reports faults through HomeKit
+type SensorHealth struct {
+	mtx        sync.Mutex
+	name       string
+	state      Health
+	detail     string
+	last       Reading
+	lastChange time.Time
+	quantized  bool // the readings come in steps, so they can hold still for hours
+	changes    *History
+	fault      *characteristic.StatusFault
+}
+
+// NewSensorHealth creates a SensorHealth, starting OK until readings say otherwise
+func NewSensorHealth(name string) *SensorHealth {
+	return &SensorHealth{
+		name:    name,
+		changes: NewHistory(healthSamples),
+		fault:   characteristic.NewStatusFault(),
+	}
+}
+
+// StatusFault returns the HomeKit characteristic that reflects the health
+func (h *SensorHealth) StatusFault() *characteristic.StatusFault {
+	return h.fault
+}
+
+// State returns the current health and a description of the problem
+func (h *SensorHealth) State() (Health, string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.state, h.detail
+}
+
+// OK returns true if the sensor can be trusted
+func (h *SensorHealth) OK() bool {
+	state, _ := h.State()
+	return state == HealthOK
+}
+
+// SetQuantized marks a sensor that reports in steps, ex. a DS18B20 or a remote probe.  In still
+// water these hold the same value for hours, so an unchanging reading doesn't mean it's stuck.
+func (h *SensorHealth) SetQuantized(quantized bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.quantized = quantized
+}
+
+// Evaluate judges the most recent reading, returning true if the health changed
+func (h *SensorHealth) Evaluate(r Reading, now time.Time) bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if !r.Time.IsZero() && r.Time != h.last.Time {
+		if h.last.Time.IsZero() || math.Abs(r.Value-h.last.Value) > healthStuckChange {
+			h.lastChange = r.Time
+		}
+		if !h.last.Time.IsZero() {
+			h.changes.Push(r.Value - h.last.Value)
+		}
+		h.last = r
+	}
+
+	state, detail := HealthOK, ""
+	switch {
+	case h.last.Time.IsZero() || now.Sub(h.last.Time) > healthStaleAfter:
+		state, detail = HealthStale, "no reading since "+timeStr(h.last.Time)
+	case h.last.Value < healthMin || h.last.Value > healthMax:
+		state, detail = HealthOutOfRange, fmt.Sprintf("%0.1f is outside %0.0f to %0.0f",
+			h.last.Value, healthMin, healthMax)
+	case !h.quantized && now.Sub(h.lastChange) > healthStuckAfter:
+		state, detail = HealthStuck, fmt.Sprintf("%0.3f since %s", h.last.Value, timeStr(h.lastChange))
+	case h.changes.Len() == healthSamples && h.changes.Stddev() > healthNoiseLimit:
+		state, detail = HealthNoisy, fmt.Sprintf("readings vary by %0.1f", h.changes.Stddev())
+	}
+	changed := state != h.state
+	h.state, h.detail = state, detail
+	if state == HealthOK {
+		h.fault.SetValue(characteristic.StatusFaultNoFault)
+	} else {
+		h.fault.SetValue(characteristic.StatusFaultGeneralFault)
+	}
+	return changed
+}
+
+// lastReading returns the most recent reading from a Thermometer, using the timestamp from a
+// SampledThermometer if there is one.
+func lastReading(t Thermometer, now time.Time) Reading {
+	if s, ok := asSampledThermometer(t); ok {
+		r := s.Last()
+		if !r.Time.IsZero() {
+			// Report the value after any calibration applied on top of the sampler
+			r.Value = t.Temperature()
+		}
+		return r
+	}
+	return Reading{Value: t.Temperature(), Time: now}
+}
+
+// rcProbes returns true when a Thermometer only reads GPIO probes.  The discharge timing
+// always jitters a little, so only a broken one reads exactly the same for hours.
+func rcProbes(t Thermometer) bool {
+	for t != nil {
+		switch v := t.(type) {
+		case *GpioThermometer:
+			return true
+		case *CompositeThermometer:
+			for _, m := range v.members {
+				if !rcProbes(m) {
+					return false
+				}
+			}
+			return len(v.members) > 0
+		case thermometerWrapper:
+			t = v.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// sensorsHealthy returns true if the pump and roof thermometers can be trusted
+func (ppc *PoolPumpController) sensorsHealthy() bool {
+	return ppc.pumpHealth.OK() && ppc.roofHealth.OK()
+}
+
+// monitoredSensor pairs a Thermometer with its SensorHealth
+type monitoredSensor struct {
+	t Thermometer
+	h *SensorHealth
+}
+
+// CheckHealth evaluates the health of the thermometers, raising an alert on any change
+func (ppc *PoolPumpController) CheckHealth() {
+	now := time.Now()
+	sensors := []monitoredSensor{{ppc.pumpTemp, ppc.pumpHealth}, {ppc.roofTemp, ppc.roofHealth}}
+	if ppc.airTemp != nil {
+		sensors = append(sensors, monitoredSensor{ppc.airTemp, ppc.airHealth})
+	}
+	if ppc.returnTemp != nil {
+		sensors = append(sensors, monitoredSensor{ppc.returnTemp, ppc.returnHealth})
+	}
+	if ppc.poolTemp != nil {
+		sensors = append(sensors, monitoredSensor{ppc.poolTemp, ppc.poolHealth})
+	}
+	for _, s := range sensors {
+		s.h.SetQuantized(!rcProbes(s.t))
+		if s.h.Evaluate(lastReading(s.t, now), now) {
+			state, detail := s.h.State()
+			if state == HealthOK {
+				ppc.alerts.Raise(s.h.name, "thermometer recovered")
+			} else {
+				ppc.alerts.Raise(s.h.name, "thermometer %s: %s", state, detail)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSensorHealth(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Stale", func(t *testing.T) {
+		h := NewSensorHealth("Test")
+		assert.True(t, h.OK(), "OK until evaluated")
+		assert.True(t, h.Evaluate(Reading{}, now))
+		state, _ := h.State()
+		assert.Equal(t, HealthStale, state)
+		assert.Equal(t, characteristic.StatusFaultGeneralFault, h.StatusFault().GetValue())
+
+		assert.True(t, h.Evaluate(Reading{Value: 20.0, Time: now}, now))
+		assert.True(t, h.OK())
+		assert.Equal(t, characteristic.StatusFaultNoFault, h.StatusFault().GetValue())
+		assert.False(t, h.Evaluate(Reading{Value: 20.0, Time: now}, now.Add(time.Minute)))
+		assert.True(t, h.Evaluate(Reading{Value: 20.0, Time: now}, now.Add(3*time.Minute)))
+		state, _ = h.State()
+		assert.Equal(t, HealthStale, state)
+	})
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		h := NewSensorHealth("Test")
+		h.Evaluate(Reading{Value: 132.0, Time: now}, now)
+		state, detail := h.State()
+		assert.Equal(t, HealthOutOfRange, state)
+		assert.Contains(t, detail, "132.0")
+	})
+
+	t.Run("Stuck", func(t *testing.T) {
+		h := NewSensorHealth("Test")
+		for i := 0; i <= 130; i++ {
+			ts := now.Add(time.Duration(i) * time.Minute)
+			h.Evaluate(Reading{Value: 25.0, Time: ts}, ts)
+		}
+		state, _ := h.State()
+		assert.Equal(t, HealthStuck, state)
+		ts := now.Add(131 * time.Minute)
+		h.Evaluate(Reading{Value: 25.1, Time: ts}, ts)
+		assert.True(t, h.OK())
+	})
+
+	t.Run("Quantized", func(t *testing.T) {
+		h := NewSensorHealth("Test")
+		h.SetQuantized(true)
+		for i := 0; i <= 180; i++ {
+			ts := now.Add(time.Duration(i) * time.Minute)
+			h.Evaluate(Reading{Value: 25.0625, Time: ts}, ts)
+		}
+		assert.True(t, h.OK(), "A DS18B20 in still water holds its value")
+	})
+
+	t.Run("Noisy", func(t *testing.T) {
+		h := NewSensorHealth("Test")
+		for i := 0; i <= healthSamples; i++ {
+			ts := now.Add(time.Duration(i) * 10 * time.Second)
+			v := 25.0
+			if i%2 == 0 {
+				v = 30.0
+			}
+			h.Evaluate(Reading{Value: v, Time: ts}, ts)
+		}
+		state, _ := h.State()
+		assert.Equal(t, HealthNoisy, state)
+	})
+
+	t.Run("Trend", func(t *testing.T) {
+		h := NewSensorHealth("Test")
+		for i := 0; i <= healthSamples; i++ {
+			ts := now.Add(time.Duration(i) * 10 * time.Second)
+			h.Evaluate(Reading{Value: 20.0 + float64(i)*0.5, Time: ts}, ts)
+		}
+		assert.True(t, h.OK(), "A steady rise isn't noise")
+	})
+}
+
+func TestRCProbes(t *testing.T) {
+	gpio := newGpioThermometer("Pump", mftr, &TestPin{})
+	assert.True(t, rcProbes(gpio))
+	assert.True(t, rcProbes(NewCalibratedThermometer(NewSampledThermometer(gpio, nil), mftr, nil)))
+	assert.False(t, rcProbes(NewDS18B20Thermometer("Roof", mftr, "/tmp/w1", "28-0316a2795eff")))
+	assert.False(t, rcProbes(NewRemoteThermometer("Float", mftr, "float", time.Minute)))
+	both := NewCompositeThermometer("Pump", mftr, PolicyMean, 0.0,
+		[]Thermometer{gpio, newGpioThermometer("Pump 2", mftr, &TestPin{})})
+	assert.True(t, rcProbes(both))
+	mixed := NewCompositeThermometer("Pump", mftr, PolicyMean, 0.0,
+		[]Thermometer{gpio, NewDS18B20Thermometer("Pump 2", mftr, "/tmp/w1", "28-0316a2795eff")})
+	assert.False(t, rcProbes(mixed), "Mixed with a DS18B20")
+}
+
+func TestHealthFailsafe(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 15.0, 50.0, 33.0, OFF)
+	assert.True(t, trp.ppc.shouldWarm())
+
+	trp.roofTemp.temp = 150.0
+	trp.ppc.CheckHealth()
+	assert.False(t, trp.ppc.roofHealth.OK())
+	assert.False(t, trp.ppc.shouldWarm(), "No solar with a bad roof probe")
+	assert.False(t, trp.ppc.shouldCool())
+	assert.NotEmpty(t, trp.ppc.alerts.Recent(1))
+
+	trp.ppc.RunPumpsIfNeeded()
+	assert.True(t, trp.ppc.switches.State() < SOLAR)
+
+	trp.roofTemp.temp = 50.0
+	trp.ppc.CheckHealth()
+	assert.True(t, trp.ppc.shouldWarm())
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	// litersPerGallon converts the flow in US gallons, a liter of water is about a kilogram
+	litersPerGallon = 3.78541
+	// waterHeatCapacity is the energy in joules to warm a kilogram of water by a degree
+	waterHeatCapacity = 4186.0
+	// btuPerWattHour converts watts to BTU per hour
+	btuPerWattHour = 3.41214
+	// heatSaveInterval is how often the heat history is written to disk
+	heatSaveInterval = 10 * time.Minute
+)
+
+// HeatReport holds the heat added by the panels over a period
+type HeatReport struct {
+	Name string
+	KWh  float64
+}
+
+// BTU returns the heat in the report in BTU
+func (r HeatReport) BTU() float64 {
+	return r.KWh * 1000.0 * btuPerWattHour
+}
+
+// heatGain returns the watts added to water flowing at gpm, warmed from supply to ret
+func heatGain(gpm, supply, ret float64) float64 {
+	return gpm * litersPerGallon / 60.0 * waterHeatCapacity * (ret - supply)
+}
+
+// HeatMeter accumulates the heat added to the water by the solar panels, measured from the
+// temperature rise between the pump and the return line.
+type HeatMeter struct {
+	mtx      sync.Mutex
+	path     string
+	Days     map[string]float64 // day -> kWh
+	watts    float64
+	last     time.Time
+	lastSave time.Time
+}
+
+// NewHeatMeter creates a HeatMeter, restoring any history saved to path
+func NewHeatMeter(path string) *HeatMeter {
+	m := HeatMeter{
+		path:     path,
+		Days:     map[string]float64{},
+		lastSave: time.Now(),
+	}
+	if buf, err := ioutil.ReadFile(path); err == nil {
+		if err = json.Unmarshal(buf, &m); err != nil {
+			Error("Could not read heat history: %v", err)
+		}
+	}
+	if m.Days == nil {
+		m.Days = map[string]float64{}
+	}
+	return &m
+}
+
+// Record sets the current heat gain, adding the heat since the last call to the history.
+// Zero watts is recorded while the water isn't going through the panels.
+func (m *HeatMeter) Record(watts float64, now time.Time) {
+	m.mtx.Lock()
+	if !m.last.IsZero() && now.After(m.last) {
+		m.add(m.watts, m.last, now)
+	}
+	m.watts = watts
+	m.last = now
+	save := now.Sub(m.lastSave) > heatSaveInterval
+	m.mtx.Unlock()
+	if save {
+		m.Save()
+	}
+}
+
+func (m *HeatMeter) add(watts float64, start, stop time.Time) {
+	for start.Before(stop) {
+		y, mo, d := start.Date()
+		midnight := time.Date(y, mo, d+1, 0, 0, 0, 0, start.Location())
+		end := stop
+		if midnight.Before(stop) {
+			end = midnight
+		}
+		m.Days[start.Format(dayFormat)] += watts * end.Sub(start).Hours() / 1000.0
+		start = end
+	}
+	oldest := stop.AddDate(0, 0, -energyDays).Format(dayFormat)
+	for day := range m.Days {
+		if day < oldest {
+			delete(m.Days, day)
+		}
+	}
+}
+
+// Watts returns the current heat gain
+func (m *HeatMeter) Watts() float64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.watts
+}
+
+// Save writes the heat history to disk
+func (m *HeatMeter) Save() {
+	m.mtx.Lock()
+	m.lastSave = time.Now()
+	buf, err := json.Marshal(m)
+	m.mtx.Unlock()
+	if err == nil {
+		err = ioutil.WriteFile(m.path, buf, 0644)
+	}
+	if err != nil {
+		Error("Could not save heat history: %v", err)
+	}
+}
+
+// Report returns the heat added since the start of the first day
+func (m *HeatMeter) Report(name string, first, now time.Time) HeatReport {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	report := HeatReport{Name: name}
+	from := first.Format(dayFormat)
+	for day, kwh := range m.Days {
+		if day >= from {
+			report.KWh += kwh
+		}
+	}
+	if !m.last.IsZero() && now.After(m.last) {
+		report.KWh += m.watts * now.Sub(m.last).Hours() / 1000.0
+	}
+	return report
+}
+
+// Reports returns the heat added today, this week, this month and this season (the year)
+func (m *HeatMeter) Reports(now time.Time) []HeatReport {
+	return []HeatReport{
+		m.Report("Today", now, now),
+		m.Report("Week", now.AddDate(0, 0, -6), now),
+		m.Report("Month", now.AddDate(0, 0, -29), now),
+		m.Report("Season", time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location()), now),
+	}
+}
+
+// flowGPM returns the flow through the panels in gallons per minute, 0 if unknown.  A flow
+// meter measures it, otherwise the configured rate is assumed.
+func (ppc *PoolPumpController) flowGPM() float64 {
+	if ppc.flowMeter != nil {
+		return ppc.flowMeter.GPM()
+	}
+	return ppc.config.cfg.FlowGPM
+}
+
+// UpdateHeat records the heat being added by the panels.  It needs the return line
+// thermometer and the flow, and is only counted while the water goes through the panels.
+func (ppc *PoolPumpController) UpdateHeat() {
+	if ppc.returnTemp == nil {
+		return
+	}
+	watts := 0.0
+	state := ppc.switches.State()
+	gpm := ppc.flowGPM()
+	if (state == SOLAR || state == MIXING) && gpm > 0.0 && ppc.returnHealth.OK() && ppc.pumpHealth.OK() {
+		watts = heatGain(gpm, ppc.pumpTemp.Temperature(), ppc.returnTemp.Temperature())
+	}
+	ppc.heat.Record(watts, time.Now())
+}
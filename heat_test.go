@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeatGain(t *testing.T) {
+	assert.InDelta(t, 2640.9, heatGain(10.0, 25.0, 26.0), 0.1)
+	assert.InDelta(t, -2640.9, heatGain(10.0, 26.0, 25.0), 0.1, "Cooling at night")
+	assert.Equal(t, 0.0, heatGain(0.0, 25.0, 30.0))
+}
+
+func TestHeatMeter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heat")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "heat.json")
+
+	m := NewHeatMeter(path)
+	start := time.Date(2021, time.July, 1, 23, 0, 0, 0, time.Local)
+	m.Record(2000.0, start)
+	m.Record(0.0, start.Add(2*time.Hour))
+	assert.InDelta(t, 2.0, m.Days["2021-07-01"], 0.001)
+	assert.InDelta(t, 2.0, m.Days["2021-07-02"], 0.001, "Split at midnight")
+
+	now := start.Add(4 * time.Hour)
+	m.Record(1000.0, now)
+	reports := m.Reports(now.Add(30 * time.Minute))
+	assert.Equal(t, "Today", reports[0].Name)
+	assert.InDelta(t, 2.5, reports[0].KWh, 0.001, "Includes the heat since the last update")
+	assert.InDelta(t, 4.5, reports[1].KWh, 0.001)
+	assert.InDelta(t, 4.5, reports[3].KWh, 0.001)
+	assert.InDelta(t, 4500.0*btuPerWattHour, reports[3].BTU(), 0.1)
+
+	m.Save()
+	restored := NewHeatMeter(path)
+	assert.InDelta(t, 2.0, restored.Days["2021-07-02"], 0.001)
+}
+
+func TestUpdateHeat(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	dir, err := ioutil.TempDir("", "heat")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	trp.ppc.heat = NewHeatMeter(filepath.Join(dir, "heat.json"))
+	trp.setConditions(30.0, 25.0, 50.0, 33.0, SOLAR)
+
+	trp.ppc.UpdateHeat()
+	assert.Equal(t, 0.0, trp.ppc.heat.Watts(), "No return probe")
+
+	ret := &FakeThermometer{name: "return", temp: 27.0}
+	trp.ppc.returnTemp = ret
+	trp.ppc.UpdateHeat()
+	assert.Equal(t, 0.0, trp.ppc.heat.Watts(), "Flow unknown")
+
+	trp.ppc.config.cfg.FlowGPM = 10.0
+	defer func() { trp.ppc.config.cfg.FlowGPM = 0.0 }()
+	trp.ppc.UpdateHeat()
+	assert.InDelta(t, 5281.9, trp.ppc.heat.Watts(), 0.1)
+
+	trp.ppc.switches.state = PUMP
+	trp.ppc.UpdateHeat()
+	assert.Equal(t, 0.0, trp.ppc.heat.Watts(), "Water isn't going through the panels")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"math"
 	"sort"
+	"sync"
 	"time"
 )
 
@@ -76,7 +77,7 @@ func (h *History) Average() float64 {
 	if h.Len() == 0 {
 		return total
 	}
-	for _, element := range h.data {
+	for _, element := range h.data[:h.Len()] {
 		total += element
 	}
 	h.avg.value = total / float64(h.Len())
@@ -92,7 +93,8 @@ func (h *History) Median() float64 {
 	if h.Len() < 2 {
 		h.med.value = h.Average()
 	} else {
-		data := []float64(h.data[:h.Len()])
+		// Sort a copy, the ring buffer has to keep its order
+		data := append([]float64(nil), h.data[:h.Len()]...)
 		sort.Float64s(data)
 		h.med.value = data[h.Len()/2]
 	}
@@ -122,3 +124,147 @@ func (h *History) Variance() float64 {
 func (h *History) Stddev() float64 {
 	return math.Sqrt(h.Variance())
 }
+
+// Sample is a value recorded at a particular time
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// TimeHistory holds the samples recorded within a window of time
+type TimeHistory struct {
+	mtx     sync.Mutex
+	window  time.Duration
+	samples []Sample
+}
+
+// NewTimeHistory creates a TimeHistory that keeps samples for the window
+func NewTimeHistory(window time.Duration) *TimeHistory {
+	return &TimeHistory{window: window}
+}
+
+// Push adds a value to the history, dropping samples older than the window
+func (h *TimeHistory) Push(value float64, t time.Time) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.samples = append(h.samples, Sample{Time: t, Value: value})
+	oldest := t.Add(-h.window)
+	i := 0
+	for i < len(h.samples) && h.samples[i].Time.Before(oldest) {
+		i++
+	}
+	h.samples = h.samples[i:]
+}
+
+// Samples returns a copy of the samples in the window, oldest first
+func (h *TimeHistory) Samples() []Sample {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return append([]Sample(nil), h.samples...)
+}
+
+// Len returns the number of samples in the window
+func (h *TimeHistory) Len() int {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return len(h.samples)
+}
+
+// Span returns the time between the oldest and newest samples
+func (h *TimeHistory) Span() time.Duration {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if len(h.samples) == 0 {
+		return 0
+	}
+	return h.samples[len(h.samples)-1].Time.Sub(h.samples[0].Time)
+}
+
+// Min returns the lowest value in the window
+func (h *TimeHistory) Min() float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if len(h.samples) == 0 {
+		return 0.0
+	}
+	min := h.samples[0].Value
+	for _, s := range h.samples {
+		min = math.Min(min, s.Value)
+	}
+	return min
+}
+
+// Max returns the highest value in the window
+func (h *TimeHistory) Max() float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if len(h.samples) == 0 {
+		return 0.0
+	}
+	max := h.samples[0].Value
+	for _, s := range h.samples {
+		max = math.Max(max, s.Value)
+	}
+	return max
+}
+
+// Percentile returns the value below which p percent (0-100) of the samples fall,
+// interpolating between the nearest samples
+func (h *TimeHistory) Percentile(p float64) float64 {
+	h.mtx.Lock()
+	values := make([]float64, len(h.samples))
+	for i, s := range h.samples {
+		values[i] = s.Value
+	}
+	h.mtx.Unlock()
+	if len(values) == 0 {
+		return 0.0
+	}
+	sort.Float64s(values)
+	rank := math.Max(0.0, math.Min(100.0, p)) / 100.0 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	if lower == len(values)-1 {
+		return values[lower]
+	}
+	return values[lower] + (rank-float64(lower))*(values[lower+1]-values[lower])
+}
+
+// EWMA returns the exponentially weighted moving average of the window.  Samples are weighted
+// by the time since the previous one, tau is the time constant.
+func (h *TimeHistory) EWMA(tau time.Duration) float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if len(h.samples) == 0 {
+		return 0.0
+	}
+	avg := h.samples[0].Value
+	for i := 1; i < len(h.samples); i++ {
+		dt := h.samples[i].Time.Sub(h.samples[i-1].Time)
+		alpha := 1.0 - math.Exp(-float64(dt)/float64(tau))
+		avg += alpha * (h.samples[i].Value - avg)
+	}
+	return avg
+}
+
+// Slope returns the least squares rate of change of the samples, per hour
+func (h *TimeHistory) Slope() float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	n := float64(len(h.samples))
+	if n < 2 {
+		return 0.0
+	}
+	var sx, sy, sxx, sxy float64
+	for _, s := range h.samples {
+		x := s.Time.Sub(h.samples[0].Time).Hours()
+		sx += x
+		sy += s.Value
+		sxx += x * x
+		sxy += x * s.Value
+	}
+	d := n*sxx - sx*sx
+	if d <= 0.0 {
+		return 0.0
+	}
+	return (n*sxy - sx*sy) / d
+}
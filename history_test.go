@@ -2,6 +2,9 @@ package main
 
 import (
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestHistory(t *testing.T) {
@@ -62,4 +65,45 @@ func TestHistory(t *testing.T) {
 			t.Errorf("Variance was %0.1f, expected 0.0", hs.Variance())
 		}
 	})
+	t.Run("Partially Full", func(t *testing.T) {
+		hs := NewHistory(10)
+		hs.Push(3.0)
+		hs.Push(1.0)
+		hs.Push(2.0)
+		assert.Equal(t, 2.0, hs.Average())
+		assert.Equal(t, 2.0, hs.Median())
+
+		hs = NewHistory(3)
+		hs.Push(3.0)
+		hs.Push(1.0)
+		hs.Push(2.0)
+		assert.Equal(t, 2.0, hs.Median())
+		hs.Push(9.0)
+		assert.Equal(t, 4.0, hs.Average(), "Median doesn't reorder the samples")
+	})
+}
+
+func TestTimeHistory(t *testing.T) {
+	now := time.Now()
+	h := NewTimeHistory(time.Hour)
+	assert.Equal(t, 0.0, h.Slope())
+	assert.Equal(t, 0.0, h.Percentile(50.0))
+	for i := 0; i <= 90; i++ {
+		h.Push(20.0+float64(i)*0.01, now.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, 61, h.Len(), "Only the last hour is kept")
+	assert.Equal(t, time.Hour, h.Span())
+	assert.InDelta(t, 20.3, h.Min(), 0.0001)
+	assert.InDelta(t, 20.9, h.Max(), 0.0001)
+	assert.InDelta(t, 20.6, h.Percentile(50.0), 0.0001)
+	assert.InDelta(t, 20.36, h.Percentile(10.0), 0.0001)
+	assert.InDelta(t, 20.9, h.Percentile(100.0), 0.0001)
+	assert.InDelta(t, 0.6, h.Slope(), 0.0001, "0.01 per minute")
+	assert.InDelta(t, 20.85, h.EWMA(5*time.Minute), 0.01, "Lags the latest by about tau")
+
+	h = NewTimeHistory(time.Hour)
+	h.Push(20.0, now)
+	h.Push(30.0, now.Add(time.Hour))
+	assert.InDelta(t, 25.0, h.Percentile(50.0), 0.0001, "Interpolated")
+	assert.InDelta(t, 10.0, h.Slope(), 0.0001)
 }
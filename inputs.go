@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+	"github.com/brutella/hc/characteristic"
+	"github.com/brutella/hc/service"
+)
+
+const (
+	// InputFlow is a flow switch, active while water is moving through the plumbing
+	InputFlow = "flow"
+	// InputRain is a rain sensor, active while it is raining
+	InputRain = "rain"
+	// InputCover is a cover switch, active while the pool cover is closed
+	InputCover = "cover"
+	// InputLeak is a leak sensor by the equipment, active while it is wet
+	InputLeak = "leak"
+
+	// defaultDebounce is how long a level has to hold before a change is accepted
+	defaultDebounce = 200 * time.Millisecond
+	// inputPoll is how often an input is sampled when there are no edges
+	inputPoll = 100 * time.Millisecond
+)
+
+// inputRoles lists the roles in the order they are recorded in the RRD, with the text for
+// the inactive and active states
+var inputRoles = []struct {
+	role, inactive, active string
+}{
+	{InputFlow, "no flow", "flowing"},
+	{InputRain, "dry", "raining"},
+	{InputCover, "open", "closed"},
+	{InputLeak, "dry", "leak detected"},
+}
+
+// InputConfig describes a switch wired to a GPIO
+type InputConfig struct {
+	Name       string  // shown in the UI, logs and HomeKit, empty uses the role
+	Role       string  // InputFlow, InputRain, InputCover or InputLeak
+	Gpio       uint8   // GPIO the switch is wired to
+	Pull       string  // "up", "down" or "float", empty uses up for a contact closing to ground
+	ActiveHigh bool    // the input is active when the pin is high, rather than pulled low
+	Debounce   float64 // milliseconds the level has to hold before a change is accepted, 0 uses 200
+}
+
+func (ic *InputConfig) pull() (Pull, error) {
+	switch strings.ToLower(ic.Pull) {
+	case "", "up":
+		return PullUp, nil
+	case "down":
+		return PullDown, nil
+	case "float":
+		return Float, nil
+	}
+	return Float, fmt.Errorf("unknown pull %q", ic.Pull)
+}
+
+// stateText describes the state of an input of the role, ex. "flowing"
+func stateText(role string, active bool) string {
+	for _, r := range inputRoles {
+		if r.role == role {
+			if active {
+				return r.active
+			}
+			return r.inactive
+		}
+	}
+	if active {
+		return "active"
+	}
+	return "inactive"
+}
+
+// DigitalInput is a debounced switch on a GPIO, shown in HomeKit as a contact sensor, or a
+// leak sensor for InputLeak
+type DigitalInput struct {
+	mtx        sync.Mutex
+	name       string
+	role       string
+	pin        PiPin
+	pull       Pull
+	activeHigh bool
+	debounce   time.Duration
+	active     bool
+	changed    time.Time
+	pending    bool      // the pin is at the other level, waiting out the debounce
+	since      time.Time // when the pin went to the other level
+	onChange   func(in *DigitalInput, active bool)
+	contact    *service.ContactSensor
+	leak       *service.LeakSensor
+	accessory  *accessory.Accessory
+	done       chan bool
+}
+
+// NewDigitalInput creates a DigitalInput from its configuration, onChange is called after
+// each debounced change of state
+func NewDigitalInput(ic *InputConfig, onChange func(in *DigitalInput, active bool)) (*DigitalInput, error) {
+	if ic.Gpio == 0 {
+		return nil, fmt.Errorf("no GPIO for the %s input", ic.Role)
+	}
+	return newDigitalInput(ic, NewGpio(ic.Gpio), onChange)
+}
+
+func newDigitalInput(ic *InputConfig, pin PiPin, onChange func(in *DigitalInput, active bool)) (*DigitalInput, error) {
+	known := false
+	for _, r := range inputRoles {
+		known = known || r.role == ic.Role
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown input role %q", ic.Role)
+	}
+	pull, err := ic.pull()
+	if err != nil {
+		return nil, err
+	}
+	name := ic.Name
+	if name == "" {
+		name = strings.Title(ic.Role)
+	}
+	in := DigitalInput{
+		name:       name,
+		role:       ic.Role,
+		pin:        pin,
+		pull:       pull,
+		activeHigh: ic.ActiveHigh,
+		debounce:   seconds(ic.Debounce/1000.0, defaultDebounce),
+		onChange:   onChange,
+		accessory:  accessory.New(AccessoryInfo(name, mftr), accessory.TypeSensor),
+		done:       make(chan bool),
+	}
+	if ic.Role == InputLeak {
+		in.leak = service.NewLeakSensor()
+		in.accessory.AddService(in.leak.Service)
+	} else {
+		in.contact = service.NewContactSensor()
+		in.accessory.AddService(in.contact.Service)
+	}
+	in.pin.InputEdge(pull, BothEdges)
+	in.active = in.level()
+	in.changed = time.Now()
+	in.publish()
+	return &in, nil
+}
+
+// level returns true if the pin is at the active level
+func (in *DigitalInput) level() bool {
+	return (in.pin.Read() == High) == in.activeHigh
+}
+
+// publish shows the state in HomeKit
+func (in *DigitalInput) publish() {
+	if in.leak != nil {
+		value := characteristic.LeakDetectedLeakNotDetected
+		if in.active {
+			value = characteristic.LeakDetectedLeakDetected
+		}
+		in.leak.LeakDetected.SetValue(value)
+		return
+	}
+	value := characteristic.ContactSensorStateContactNotDetected
+	if in.active {
+		value = characteristic.ContactSensorStateContactDetected
+	}
+	in.contact.ContactSensorState.SetValue(value)
+}
+
+// Name returns the name of the input
+func (in *DigitalInput) Name() string {
+	return in.name
+}
+
+// Role returns what the input is for
+func (in *DigitalInput) Role() string {
+	return in.role
+}
+
+// Accessory returns the Apple HomeKit accessory
+func (in *DigitalInput) Accessory() *accessory.Accessory {
+	return in.accessory
+}
+
+// Active returns the debounced state of the input
+func (in *DigitalInput) Active() bool {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+	return in.active
+}
+
+// Changed returns when the input last changed state
+func (in *DigitalInput) Changed() time.Time {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+	return in.changed
+}
+
+// String describes the state of the input, ex. "Flow Switch: flowing"
+func (in *DigitalInput) String() string {
+	return fmt.Sprintf("%s: %s", in.name, stateText(in.role, in.Active()))
+}
+
+// Sample reads the pin, accepting a change once the new level has held for the debounce time
+func (in *DigitalInput) Sample(now time.Time) {
+	level := in.level()
+	in.mtx.Lock()
+	if level == in.active {
+		in.pending = false
+		in.mtx.Unlock()
+		return
+	}
+	if !in.pending {
+		in.pending = true
+		in.since = now
+	}
+	if now.Sub(in.since) < in.debounce {
+		in.mtx.Unlock()
+		return
+	}
+	in.pending = false
+	in.active = level
+	in.changed = now
+	in.publish()
+	in.mtx.Unlock()
+	if in.onChange != nil {
+		in.onChange(in, level)
+	}
+}
+
+// Start samples the input in the background, on each edge and every inputPoll
+func (in *DigitalInput) Start() {
+	go func() {
+		for {
+			in.pin.WaitForEdge(inputPoll)
+			in.Sample(time.Now())
+			select {
+			case <-in.done:
+				return
+			default: // Required to not block
+			}
+		}
+	}()
+}
+
+// Stop ends the background sampling
+func (in *DigitalInput) Stop() {
+	in.done <- true
+}
+
+// Inputs holds the configured digital inputs
+type Inputs struct {
+	inputs []*DigitalInput
+}
+
+// NewInputs creates the inputs in the configuration, logging and skipping any that are invalid
+func NewInputs(configs []*InputConfig, onChange func(in *DigitalInput, active bool)) *Inputs {
+	inputs := Inputs{}
+	for _, ic := range configs {
+		in, err := NewDigitalInput(ic, onChange)
+		if err != nil {
+			Error("Bad input configuration, skipping it: %v", err)
+			continue
+		}
+		Info("Using GPIO(%d) for the %s input: %s", ic.Gpio, ic.Role, in)
+		inputs.inputs = append(inputs.inputs, in)
+	}
+	return &inputs
+}
+
+// All returns the inputs
+func (i *Inputs) All() []*DigitalInput {
+	return i.inputs
+}
+
+// Configured returns true if there is an input for the role
+func (i *Inputs) Configured(role string) bool {
+	for _, in := range i.inputs {
+		if in.Role() == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns true if any input for the role is active
+func (i *Inputs) Active(role string) bool {
+	for _, in := range i.inputs {
+		if in.Role() == role && in.Active() {
+			return true
+		}
+	}
+	return false
+}
+
+// Start samples the inputs in the background
+func (i *Inputs) Start() {
+	for _, in := range i.inputs {
+		in.Start()
+	}
+}
+
+// Stop ends the background sampling
+func (i *Inputs) Stop() {
+	for _, in := range i.inputs {
+		in.Stop()
+	}
+}
+
+// rrdValues formats the state of each role for the inputs RRD, "U" for roles without an input
+func (i *Inputs) rrdValues() string {
+	values := []string{}
+	for _, r := range inputRoles {
+		switch {
+		case !i.Configured(r.role):
+			values = append(values, "U")
+		case i.Active(r.role):
+			values = append(values, "1")
+		default:
+			values = append(values, "0")
+		}
+	}
+	return strings.Join(values, ":")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+	"github.com/stretchr/testify/assert"
+)
+
+// testInput creates an input on a TestPin that stays where it is put
+func testInput(t *testing.T, ic *InputConfig, state GpioState) (*DigitalInput, *TestPin) {
+	pin := &TestPin{state: state, pin: ic.Gpio, wake: make(chan bool)}
+	in, err := newDigitalInput(ic, pin, nil)
+	assert.NoError(t, err)
+	return in, pin
+}
+
+func TestDigitalInput(t *testing.T) {
+	now := time.Now()
+	in, pin := testInput(t, &InputConfig{Name: "Flow Switch", Role: InputFlow, Gpio: 6}, High)
+	assert.Equal(t, PullUp, pin.pull)
+	assert.Equal(t, BothEdges, pin.edge)
+	assert.False(t, in.Active(), "Pulled up, open contact")
+	assert.Equal(t, "Flow Switch: no flow", in.String())
+
+	changes := []bool{}
+	in.onChange = func(in *DigitalInput, active bool) { changes = append(changes, active) }
+
+	t.Run("Debounce", func(t *testing.T) {
+		pin.state = Low
+		in.Sample(now)
+		in.Sample(now.Add(100 * time.Millisecond))
+		assert.False(t, in.Active(), "Still bouncing")
+		pin.state = High
+		in.Sample(now.Add(150 * time.Millisecond))
+		pin.state = Low
+		in.Sample(now.Add(200 * time.Millisecond))
+		in.Sample(now.Add(350 * time.Millisecond))
+		assert.False(t, in.Active(), "The bounce restarted the debounce")
+		in.Sample(now.Add(400 * time.Millisecond))
+		assert.True(t, in.Active())
+		assert.Equal(t, now.Add(400*time.Millisecond), in.Changed())
+		assert.Equal(t, []bool{true}, changes)
+		assert.Equal(t, characteristic.ContactSensorStateContactDetected, in.contact.ContactSensorState.GetValue())
+		assert.Equal(t, "Flow Switch: flowing", in.String())
+	})
+
+	t.Run("Active High Leak", func(t *testing.T) {
+		leak, pin := testInput(t, &InputConfig{Role: InputLeak, Gpio: 7, Pull: "down", ActiveHigh: true,
+			Debounce: 1000}, Low)
+		assert.Equal(t, PullDown, pin.pull)
+		assert.Equal(t, "Leak", leak.Name())
+		assert.False(t, leak.Active())
+		pin.state = High
+		leak.Sample(now)
+		leak.Sample(now.Add(500 * time.Millisecond))
+		assert.False(t, leak.Active())
+		leak.Sample(now.Add(time.Second))
+		assert.True(t, leak.Active())
+		assert.Equal(t, characteristic.LeakDetectedLeakDetected, leak.leak.LeakDetected.GetValue())
+	})
+
+	t.Run("Bad Configs", func(t *testing.T) {
+		_, err := NewDigitalInput(&InputConfig{Role: InputRain}, nil)
+		assert.Error(t, err, "No GPIO")
+		_, err = newDigitalInput(&InputConfig{Role: "doorbell", Gpio: 6}, &TestPin{}, nil)
+		assert.Error(t, err)
+		_, err = newDigitalInput(&InputConfig{Role: InputRain, Gpio: 6, Pull: "sideways"}, &TestPin{}, nil)
+		assert.Error(t, err)
+
+		SetGpioProvider(NewTestPin)
+		inputs := NewInputs([]*InputConfig{{Role: InputRain, Gpio: 6}, {Role: "doorbell", Gpio: 7}}, nil)
+		assert.Len(t, inputs.All(), 1)
+	})
+}
+
+func TestInputsControl(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 25.0, 20.0, 33.0, OFF)
+	leak, leakPin := testInput(t, &InputConfig{Role: InputLeak, Gpio: 6}, High)
+	cover, coverPin := testInput(t, &InputConfig{Role: InputCover, Gpio: 7}, High)
+	rain, rainPin := testInput(t, &InputConfig{Role: InputRain, Gpio: 8}, High)
+	for _, in := range []*DigitalInput{leak, cover, rain} {
+		in.onChange = trp.ppc.inputChanged
+	}
+	trp.ppc.inputs = &Inputs{inputs: []*DigitalInput{leak, cover, rain}}
+	assert.Equal(t, "U:0:0:0", trp.ppc.inputs.rrdValues())
+	assert.Equal(t, map[string]bool{"Leak": false, "Cover": false, "Rain": false}, trp.ppc.StatusReport().Inputs)
+	now := time.Now()
+
+	t.Run("Cover", func(t *testing.T) {
+		coverPin.state = Low
+		cover.Sample(now)
+		cover.Sample(now.Add(time.Second))
+		assert.True(t, trp.ppc.coverClosed())
+		assert.Equal(t, PUMP, trp.ppc.sweepAllowed(SWEEP))
+		assert.Equal(t, SOLAR, trp.ppc.sweepAllowed(MIXING))
+		assert.Equal(t, OFF, trp.ppc.sweepAllowed(OFF))
+	})
+
+	t.Run("Rain", func(t *testing.T) {
+		assert.True(t, trp.ppc.solarPlausible())
+		rainPin.state = Low
+		rain.Sample(now)
+		rain.Sample(now.Add(time.Second))
+		assert.False(t, trp.ppc.solarPlausible())
+		assert.Equal(t, "U:1:1:0", trp.ppc.inputs.rrdValues())
+	})
+
+	t.Run("Leak", func(t *testing.T) {
+		trp.ppc.switches.SetState(PUMP, true, trp.ppc.config.cfg.RunTime)
+		assert.Equal(t, PUMP, trp.ppc.switches.State())
+		leakPin.state = Low
+		leak.Sample(now)
+		leak.Sample(now.Add(time.Second))
+		trp.ppc.RunPumpsIfNeeded()
+		assert.Equal(t, OFF, trp.ppc.switches.State(), "A manual run stops too")
+		trp.ppc.switches.SetState(SWEEP, true, trp.ppc.config.cfg.RunTime)
+		assert.Equal(t, OFF, trp.ppc.switches.State(), "Can't be started while leaking")
+		alerts := trp.ppc.alerts.Recent(1)
+		assert.Len(t, alerts, 1)
+		assert.Equal(t, "Leak", alerts[0].Source)
+	})
+}
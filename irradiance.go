@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// IrradianceADC is a pyranometer or light sensor read through an ADC
+	IrradianceADC = "adc"
+	// IrradianceClearSky is computed from the position of the sun at the site
+	IrradianceClearSky = "clearsky"
+	// IrradianceStation is the solar radiation uploaded by the local weather station
+	IrradianceStation = "station"
+
+	// defaultFullScale is the irradiance reported by a pyranometer at the ADC reference voltage
+	defaultFullScale = 2000.0
+	// defaultMinIrradiance is the least irradiance (W/m^2) at which solar heating is plausible
+	defaultMinIrradiance = 150.0
+)
+
+// IrradianceConfig describes where the solar irradiance comes from
+type IrradianceConfig struct {
+	Type      string        // IrradianceADC, IrradianceClearSky or IrradianceStation
+	ADC       *SensorConfig // SensorMCP3008 or SensorADS1115 with the channel of the pyranometer
+	FullScale float64       // IrradianceADC W/m^2 at the reference voltage, 0 uses 2000
+	Latitude  float64       // IrradianceClearSky site latitude in degrees, north is positive
+	Longitude float64       // IrradianceClearSky site longitude in degrees, east is positive
+}
+
+// IrradianceProvider reports the global horizontal irradiance in W/m^2
+type IrradianceProvider interface {
+	Name() string
+	Irradiance(now time.Time) (float64, error)
+}
+
+// ADCIrradiance reads a pyranometer (or a calibrated light sensor) with a voltage output
+// proportional to the irradiance
+type ADCIrradiance struct {
+	adc       ADC
+	channel   int
+	fullScale float64
+}
+
+// NewADCIrradiance creates an ADCIrradiance on a channel of an ADC
+func NewADCIrradiance(adc ADC, channel int, fullScale float64) *ADCIrradiance {
+	if fullScale <= 0.0 {
+		fullScale = defaultFullScale
+	}
+	return &ADCIrradiance{adc: adc, channel: channel, fullScale: fullScale}
+}
+
+// Name describes the ADCIrradiance
+func (p *ADCIrradiance) Name() string {
+	return fmt.Sprintf("Pyranometer(channel %d)", p.channel)
+}
+
+// Irradiance reads the median of several conversions
+func (p *ADCIrradiance) Irradiance(now time.Time) (float64, error) {
+	h := NewHistory(adcSamples)
+	var err error
+	for i := 0; i < adcSamples; i++ {
+		var ratio float64
+		ratio, err = p.adc.Read(p.channel)
+		if err == nil {
+			h.Push(ratio)
+		}
+	}
+	if h.Len() == 0 {
+		return 0.0, err
+	}
+	return math.Max(0.0, h.Median()*p.fullScale), nil
+}
+
+// ClearSkyIrradiance estimates the irradiance on a cloudless day with the Haurwitz model
+type ClearSkyIrradiance struct {
+	latitude  float64
+	longitude float64
+}
+
+// NewClearSkyIrradiance creates a ClearSkyIrradiance for the site coordinates
+func NewClearSkyIrradiance(latitude, longitude float64) *ClearSkyIrradiance {
+	return &ClearSkyIrradiance{latitude: latitude, longitude: longitude}
+}
+
+// Name describes the ClearSkyIrradiance
+func (p *ClearSkyIrradiance) Name() string {
+	return fmt.Sprintf("Clear sky(%0.3f, %0.3f)", p.latitude, p.longitude)
+}
+
+// Irradiance returns the clear sky irradiance at the given time
+func (p *ClearSkyIrradiance) Irradiance(now time.Time) (float64, error) {
+	cosZ := cosSolarZenith(p.latitude, p.longitude, now)
+	if cosZ <= 0.0 {
+		return 0.0, nil
+	}
+	return 1098.0 * cosZ * math.Exp(-0.057/cosZ), nil
+}
+
+// cosSolarZenith returns the cosine of the angle between the sun and straight up, using the
+// NOAA approximations for the declination and the equation of time.
+func cosSolarZenith(latitude, longitude float64, now time.Time) float64 {
+	t := now.UTC()
+	hour := float64(t.Hour()) + float64(t.Minute())/60.0 + float64(t.Second())/3600.0
+	g := 2.0 * math.Pi / 365.0 * (float64(t.YearDay()-1) + (hour-12.0)/24.0)
+	decl := 0.006918 - 0.399912*math.Cos(g) + 0.070257*math.Sin(g) - 0.006758*math.Cos(2*g) +
+		0.000907*math.Sin(2*g) - 0.002697*math.Cos(3*g) + 0.00148*math.Sin(3*g)
+	eqTime := 229.18 * (0.000075 + 0.001868*math.Cos(g) - 0.032077*math.Sin(g) -
+		0.014615*math.Cos(2*g) - 0.040849*math.Sin(2*g))
+	solarMinutes := hour*60.0 + eqTime + 4.0*longitude
+	hourAngle := (solarMinutes/4.0 - 180.0) * math.Pi / 180.0
+	lat := latitude * math.Pi / 180.0
+	return math.Sin(lat)*math.Sin(decl) + math.Cos(lat)*math.Cos(decl)*math.Cos(hourAngle)
+}
+
+// NewIrradianceProvider creates the IrradianceProvider described by the configuration
+func NewIrradianceProvider(ic *IrradianceConfig, station *WeatherStation) (IrradianceProvider, error) {
+	if ic == nil {
+		return nil, nil
+	}
+	switch ic.Type {
+	case IrradianceClearSky:
+		if ic.Latitude < -90.0 || ic.Latitude > 90.0 || ic.Longitude < -180.0 || ic.Longitude > 180.0 {
+			return nil, fmt.Errorf("invalid site coordinates(%0.3f, %0.3f)", ic.Latitude, ic.Longitude)
+		}
+		return NewClearSkyIrradiance(ic.Latitude, ic.Longitude), nil
+	case IrradianceStation:
+		if station == nil || !station.Configured() {
+			return nil, fmt.Errorf("no weather station is configured")
+		}
+		return &StationIrradiance{station: station}, nil
+	case IrradianceADC:
+		if ic.ADC == nil {
+			return nil, fmt.Errorf("no ADC configured for the pyranometer")
+		}
+		adc, err := openADC(ic.ADC)
+		if err != nil {
+			return nil, err
+		}
+		return NewADCIrradiance(adc, ic.ADC.Channel, ic.FullScale), nil
+	}
+	return nil, fmt.Errorf("unknown irradiance source %q", ic.Type)
+}
+
+// Irradiance keeps the last reading from an IrradianceProvider
+type Irradiance struct {
+	mtx      sync.Mutex
+	provider IrradianceProvider
+	value    float64
+	valid    bool
+}
+
+// NewIrradiance creates an Irradiance for the provider, which may be nil
+func NewIrradiance(p IrradianceProvider) *Irradiance {
+	return &Irradiance{provider: p}
+}
+
+// Update reads the provider
+func (ir *Irradiance) Update(now time.Time) error {
+	if ir.provider == nil {
+		return nil
+	}
+	value, err := ir.provider.Irradiance(now)
+	ir.mtx.Lock()
+	defer ir.mtx.Unlock()
+	ir.valid = err == nil
+	if err != nil {
+		return fmt.Errorf("%s: %w", ir.provider.Name(), err)
+	}
+	ir.value = value
+	return nil
+}
+
+// Value returns the last irradiance in W/m^2, false if there is no working provider
+func (ir *Irradiance) Value() (float64, bool) {
+	ir.mtx.Lock()
+	defer ir.mtx.Unlock()
+	return ir.value, ir.valid
+}
+
+func minIrradiance(cfg *PersistedConfig) float64 {
+	if cfg.MinIrradiance == 0.0 {
+		return defaultMinIrradiance
+	}
+	return cfg.MinIrradiance
+}
+
+// solarPlausible returns false when the irradiance is known and too low for the panels to
+// heat the water, or the weather station or rain sensor says it is raining, whatever the roof
+// thermometer says.
+func (ppc *PoolPumpController) solarPlausible() bool {
+	return sunPlausible(ppc.config.cfg, ppc.conditions(time.Now()))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIrradiance reports a fixed irradiance
+type fakeIrradiance struct {
+	value float64
+	err   error
+}
+
+func (f *fakeIrradiance) Name() string { return "fake" }
+func (f *fakeIrradiance) Irradiance(now time.Time) (float64, error) {
+	return f.value, f.err
+}
+
+func TestIrradianceProviders(t *testing.T) {
+	t.Run("ClearSky", func(t *testing.T) {
+		equator := NewClearSkyIrradiance(0.0, 0.0)
+		noon := time.Date(2021, time.March, 20, 12, 7, 0, 0, time.UTC)
+		v, err := equator.Irradiance(noon)
+		assert.NoError(t, err)
+		assert.InDelta(t, 1037.0, v, 10.0, "Sun overhead at the equinox")
+		v, _ = equator.Irradiance(noon.Add(12 * time.Hour))
+		assert.Equal(t, 0.0, v, "Night")
+
+		sanJose := NewClearSkyIrradiance(37.3, -121.9)
+		pst := time.FixedZone("PST", -8*3600)
+		winter, _ := sanJose.Irradiance(time.Date(2021, time.December, 21, 12, 0, 0, 0, pst))
+		summer, _ := sanJose.Irradiance(time.Date(2021, time.June, 21, 13, 0, 0, 0, pst))
+		assert.True(t, winter > 400.0 && winter < summer, "winter(%0.0f) summer(%0.0f)", winter, summer)
+		morning, _ := sanJose.Irradiance(time.Date(2021, time.June, 21, 7, 0, 0, 0, pst))
+		assert.True(t, morning > 0.0 && morning < summer/2)
+	})
+
+	t.Run("ADC", func(t *testing.T) {
+		bus := &fakeSPI{}
+		bus.values[1] = 256
+		p := NewADCIrradiance(NewMCP3008(bus), 1, 0.0)
+		v, err := p.Irradiance(time.Now())
+		assert.NoError(t, err)
+		assert.InDelta(t, 500.0, v, 1.0)
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		p, err := NewIrradianceProvider(nil, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, p)
+		p, err = NewIrradianceProvider(&IrradianceConfig{Type: IrradianceClearSky, Latitude: 37.3}, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, p)
+		_, err = NewIrradianceProvider(&IrradianceConfig{Type: IrradianceClearSky, Latitude: 97.3}, nil)
+		assert.Error(t, err)
+		_, err = NewIrradianceProvider(&IrradianceConfig{Type: IrradianceADC}, nil)
+		assert.Error(t, err)
+		_, err = NewIrradianceProvider(&IrradianceConfig{Type: "bogus"}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestSolarPlausible(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 15.0, 50.0, 33.0, OFF)
+	assert.True(t, trp.ppc.shouldWarm(), "No irradiance source")
+
+	sun := &fakeIrradiance{value: 80.0}
+	trp.ppc.irradiance = NewIrradiance(sun)
+	assert.NoError(t, trp.ppc.irradiance.Update(time.Now()))
+	assert.False(t, trp.ppc.shouldWarm(), "Roof is hot but there is no sun")
+
+	sun.value = 700.0
+	trp.ppc.irradiance.Update(time.Now())
+	assert.True(t, trp.ppc.shouldWarm())
+
+	sun.err = errors.New("broken")
+	assert.Error(t, trp.ppc.irradiance.Update(time.Now()))
+	_, ok := trp.ppc.irradiance.Value()
+	assert.False(t, ok)
+	assert.True(t, trp.ppc.shouldWarm(), "A broken source doesn't block solar")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// LoadShed tracks demand-response requests to suspend discretionary pump activity.  Requests
+// arrive from a dry contact on a GPIO (closed means shed) or through the web API.  Filtration
+// that was due while shedding is owed, and made up once the shed is over.
+type LoadShed struct {
+	mtx    sync.Mutex
+	pin    PiPin
+	until  time.Time
+	source string
+	owed   time.Duration
+	last   time.Time
+	wired  bool // the pin has been set up as an input
+}
+
+// NewLoadShed creates a LoadShed that can watch the given pin for a dry contact input.  The
+// pin is left alone until the contact is read.
+func NewLoadShed(pin PiPin) *LoadShed {
+	return &LoadShed{pin: pin}
+}
+
+// Request sheds load for the given duration, a duration <= 0 cancels any request.
+func (l *LoadShed) Request(d time.Duration, source string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if d <= 0 {
+		Log("Load shed cancelled by %s", source)
+		l.until = time.Time{}
+		return
+	}
+	l.until = time.Now().Add(d)
+	l.source = source
+	Log("Load shed requested by %s until %s", source, timeStr(l.until))
+}
+
+// Until returns the time the last requested shed period ends
+func (l *LoadShed) Until() time.Time {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.until
+}
+
+// Contact returns true if the dry contact input is closed.  The pin is set up as a pulled up
+// input the first time, so only call it once the contact is wired.
+func (l *LoadShed) Contact() bool {
+	l.mtx.Lock()
+	if !l.wired {
+		l.pin.InputEdge(PullUp, BothEdges)
+		l.wired = true
+	}
+	l.mtx.Unlock()
+	return l.pin.Read() == Low
+}
+
+// Active returns true if load should be shed now.  The dry contact is only consulted when
+// useContact is true, so an unwired input can't shed load.
+func (l *LoadShed) Active(now time.Time, useContact bool) bool {
+	if useContact && l.Contact() {
+		return true
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return now.Before(l.until)
+}
+
+// Owed returns the amount of filtration that needs to be made up
+func (l *LoadShed) Owed() time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.owed
+}
+
+// Account updates the filtration owed.  While shedding, the time that filtration was due is
+// added, up to limit.  Otherwise, the time spent running is subtracted.
+func (l *LoadShed) Account(now time.Time, shedding, due, running bool, limit time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	dt := time.Duration(0)
+	if !l.last.IsZero() {
+		dt = now.Sub(l.last)
+		if dt > time.Minute {
+			dt = time.Minute
+		}
+	}
+	l.last = now
+	if shedding && due {
+		l.owed += dt
+		if l.owed > limit {
+			l.owed = limit
+		}
+	} else if !shedding && running {
+		l.owed -= dt
+		if l.owed < 0 {
+			l.owed = 0
+		}
+	}
+}
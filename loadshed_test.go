@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadShed(t *testing.T) {
+	pin := &TestPin{state: High}
+	l := NewLoadShed(pin)
+	now := time.Now()
+
+	t.Run("Contact", func(t *testing.T) {
+		assert.False(t, l.Active(now, false))
+		assert.Equal(t, NoEdge, pin.edge, "Not set up until the contact is wired")
+		assert.False(t, l.Active(now, true))
+		assert.Equal(t, PullUp, pin.pull)
+		pin.state = Low
+		assert.True(t, l.Active(now, true))
+		assert.False(t, l.Active(now, false), "Contact should be ignored unless wired")
+		pin.state = High
+	})
+
+	t.Run("Request", func(t *testing.T) {
+		l.Request(time.Hour, "test")
+		assert.True(t, l.Active(time.Now(), false))
+		assert.False(t, l.Active(time.Now().Add(2*time.Hour), false))
+		l.Request(0, "test")
+		assert.False(t, l.Active(time.Now(), false))
+	})
+
+	t.Run("Account", func(t *testing.T) {
+		limit := 2 * time.Minute
+		l.Account(now, true, true, false, limit)
+		l.Account(now.Add(30*time.Second), true, true, false, limit)
+		assert.Equal(t, 30*time.Second, l.Owed())
+		l.Account(now.Add(60*time.Second), true, false, false, limit)
+		assert.Equal(t, 30*time.Second, l.Owed(), "Nothing owed when filtration isn't due")
+		for i := 2; i < 10; i++ {
+			l.Account(now.Add(time.Duration(i)*30*time.Second), true, true, false, limit)
+		}
+		assert.Equal(t, limit, l.Owed())
+		l.Account(now.Add(5*time.Minute), false, false, true, limit)
+		assert.Equal(t, time.Minute+30*time.Second, l.Owed())
+		l.Account(now.Add(10*time.Minute), false, false, true, limit)
+		assert.Equal(t, 30*time.Second, l.Owed(), "Long gaps count for at most a minute")
+	})
+}
+
+func TestRunPumpsLoadShed(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 15.0, 50.0, 33.0, OFF)
+	trp.ppc.loadShed.Request(time.Hour, "test")
+	trp.ppc.RunPumpsIfNeeded()
+	assert.Equal(t, OFF, trp.ppc.switches.State(), "Solar should not run while shedding load")
+
+	trp.setConditions(30.0, 15.0, -5.0, -5.0, OFF)
+	defer func() { trp.ppc.config.cfg.FreezeProtect = false }()
+	trp.ppc.config.cfg.FreezeProtect = true
+	trp.ppc.RunPumpsIfNeeded()
+	assert.Equal(t, PUMP, trp.ppc.switches.State(), "Freeze protection should run while shedding load")
+}
+
+func TestLoadShedInterruptsSweep(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 29.8, 20.0, 20.0, OFF)
+	y, m, d := time.Now().Date()
+	dawn := time.Date(y, m, d, 4, 0, 0, 0, time.Local)
+	trp.ppc.filtration.completed = dawn.Add(-72 * time.Hour)
+	assert.True(t, trp.ppc.filtrationDue(dawn))
+
+	trp.ppc.switches.SetState(SWEEP, false, 1.0)
+	trp.ppc.loadShed.Request(time.Hour, "test")
+	defer trp.ppc.loadShed.Request(0, "test")
+	trp.ppc.RunPumpsIfNeeded()
+	assert.Equal(t, OFF, trp.ppc.switches.State(), "Shedding stops the sweep")
+
+	runtime := DurationFromHours(trp.ppc.config.cfg.RunTime, 1.0)
+	start := time.Now()
+	for i := 1; i <= 10; i++ {
+		tick := time.Duration(i) * time.Minute
+		trp.ppc.loadShed.Account(start.Add(tick), true, trp.ppc.filtrationDue(dawn.Add(tick)), false, runtime)
+	}
+	assert.Equal(t, 10*time.Minute, trp.ppc.loadShed.Owed(), "Still due after the sweep was stopped")
+}
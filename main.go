@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/brutella/hc"
+	"github.com/brutella/hc/accessory"
 )
 
 func main() {
@@ -45,20 +46,34 @@ func main() {
 
 	server := NewServer(AnyHost, 443, ppc)
 	server.Start(*config.sslCertificate, *config.sslPrivateKey)
+	server.StartWeather(*config.weatherPort)
 
 	hcConfig := hc.Config{
 		Pin:         config.cfg.Pin,
 		StoragePath: *config.dataDirectory,
 	}
 
-	transport, err := hc.NewIPTransport(
-		hcConfig,
-		ppc.runningTemp.Accessory(),
+	accessories := []*accessory.Accessory{
 		ppc.pumpTemp.Accessory(),
 		ppc.roofTemp.Accessory(),
 		ppc.switches.pump.Accessory(),
 		ppc.switches.sweep.Accessory(),
-		ppc.switches.solar.Accessory())
+		ppc.switches.solar.Accessory(),
+		ppc.atTarget.Accessory(),
+	}
+	if ppc.airTemp != nil {
+		accessories = append(accessories, ppc.airTemp.Accessory())
+	}
+	if ppc.returnTemp != nil {
+		accessories = append(accessories, ppc.returnTemp.Accessory())
+	}
+	for _, in := range ppc.inputs.All() {
+		accessories = append(accessories, in.Accessory())
+	}
+	for _, remote := range config.remotes.All() {
+		accessories = append(accessories, remote.Accessory()) // includes the battery
+	}
+	transport, err := hc.NewIPTransport(hcConfig, ppc.runningTemp.Accessory(), accessories...)
 
 	if err != nil {
 		Fatal("Could not start IP Transport: %s", err.Error())
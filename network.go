@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+)
+
+const (
+	// defaultNetworkField is the JSON field holding the temperature
+	defaultNetworkField = "temperature"
+	// networkTimeout is the longest a request to a network source can take
+	networkTimeout = 10 * time.Second
+)
+
+// NetworkThermometer polls a URL for a JSON document holding a temperature, ex. a weather
+// station or another controller on the network.
+type NetworkThermometer struct {
+	name       string
+	url        string
+	field      string
+	fahrenheit bool
+	client     *http.Client
+	mutex      sync.Mutex
+	updated    time.Time
+	accessory  *accessory.Thermometer
+}
+
+// NewNetworkThermometer creates a NetworkThermometer.  field is a dotted path to the value in
+// the JSON document (ex. current.temperature_2m), empty uses "temperature".
+func NewNetworkThermometer(name, manufacturer, url, field string, fahrenheit bool) *NetworkThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -40.0, 85.0, 1.0)
+	if field == "" {
+		field = defaultNetworkField
+	}
+	return &NetworkThermometer{
+		name:       name,
+		url:        url,
+		field:      field,
+		fahrenheit: fahrenheit,
+		client:     &http.Client{Timeout: networkTimeout},
+		updated:    time.Now().Add(-24 * time.Hour),
+		accessory:  acc,
+	}
+}
+
+// Name returns the name of the NetworkThermometer
+func (t *NetworkThermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory related to the NetworkThermometer
+func (t *NetworkThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate is not supported for network sources
+func (t *NetworkThermometer) Calibrate(a float64) error {
+	return errors.New("not supported")
+}
+
+// Temperature returns the last temperature read from the NetworkThermometer
+func (t *NetworkThermometer) Temperature() float64 {
+	return t.accessory.TempSensor.CurrentTemperature.GetValue()
+}
+
+// Update fetches the document and reads the temperature from it
+func (t *NetworkThermometer) Update() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	resp, err := t.client.Get(t.url)
+	if err != nil {
+		return fmt.Errorf("%s thermometer: %w", t.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s thermometer: %s returned %s", t.name, t.url, resp.Status)
+	}
+	var doc interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("%s thermometer: %w", t.name, err)
+	}
+	temp, err := jsonNumber(doc, t.field)
+	if err != nil {
+		return fmt.Errorf("%s thermometer: %w", t.name, err)
+	}
+	if t.fahrenheit {
+		temp = (temp - 32.0) * 5.0 / 9.0
+	}
+	t.accessory.TempSensor.CurrentTemperature.SetValue(temp)
+	t.updated = time.Now()
+	return nil
+}
+
+// jsonNumber follows a dotted path through a decoded JSON document to a number
+func jsonNumber(doc interface{}, path string) (float64, error) {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return 0.0, fmt.Errorf("%s: not an object at %q", path, key)
+		}
+		if doc, ok = m[key]; !ok {
+			return 0.0, fmt.Errorf("%s: no field %q", path, key)
+		}
+	}
+	v, ok := doc.(float64)
+	if !ok {
+		return 0.0, fmt.Errorf("%s is not a number", path)
+	}
+	return v, nil
+}
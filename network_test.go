@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkThermometer(t *testing.T) {
+	body := `{"temperature": 18.5, "current": {"temp_f": 68.0, "name": "x"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	therm := NewNetworkThermometer("Air", mftr, server.URL, "", false)
+	assert.NoError(t, therm.Update())
+	assert.Equal(t, 18.5, therm.Temperature())
+
+	therm = NewNetworkThermometer("Air", mftr, server.URL, "current.temp_f", true)
+	assert.NoError(t, therm.Update())
+	assert.InDelta(t, 20.0, therm.Temperature(), 0.001)
+
+	for _, field := range []string{"current.name", "current.bogus", "temperature.value"} {
+		therm = NewNetworkThermometer("Air", mftr, server.URL, field, false)
+		assert.Error(t, therm.Update(), field)
+	}
+	therm = NewNetworkThermometer("Air", mftr, server.URL+"/missing", "", false)
+	assert.Error(t, therm.Update())
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// coldFrontDrop is how much colder tomorrow's high has to be than today's to pre-warm
+	coldFrontDrop = 6.0
+	// planAfternoon is the hour from which solar runs are counted towards filtration
+	planAfternoon = 12
+	// planEvening is the hour from which filtration the afternoon solar run didn't deliver
+	// is made up
+	planEvening = 18
+)
+
+// Plan is the day-ahead operation plan worked out from the forecast
+type Plan struct {
+	Day            time.Time
+	Hours          []ForecastHour
+	High           float64 // degrees celsius
+	Low            float64
+	SunnyHours     int  // hours with enough sun for solar heating
+	AfternoonHours int  // of the SunnyHours, those after noon
+	SkipSweep      bool // the afternoon solar run covers the filtration, skip the morning sweep
+	PreWarm        bool // a cold front is coming, heat to the top of the band while there is sun
+	Reasons        []string
+}
+
+// String summarizes the plan, ex. "skip the morning sweep, pre-warm"
+func (p Plan) String() string {
+	actions := []string{}
+	if p.SkipSweep {
+		actions = append(actions, "skip the morning sweep")
+	}
+	if p.PreWarm {
+		actions = append(actions, "pre-warm")
+	}
+	if len(actions) == 0 {
+		return "normal operation"
+	}
+	return strings.Join(actions, ", ")
+}
+
+// sunnyHour returns true if the forecast hour has enough sun for solar heating
+func sunnyHour(cfg *PersistedConfig, h ForecastHour) bool {
+	return h.Irradiance >= minIrradiance(cfg)
+}
+
+// makePlan works out the plan for the day from the forecast, nil if the forecast doesn't
+// cover the day.  water is the current pool temperature.
+func makePlan(f *Forecast, day time.Time, cfg *PersistedConfig, water float64) *Plan {
+	if f == nil {
+		return nil
+	}
+	hours := f.Day(day)
+	if len(hours) == 0 {
+		return nil
+	}
+	y, m, d := day.Date()
+	plan := Plan{Day: time.Date(y, m, d, 0, 0, 0, 0, day.Location()), Hours: hours,
+		High: hours[0].Temperature, Low: hours[0].Temperature}
+	for _, h := range hours {
+		if h.Temperature > plan.High {
+			plan.High = h.Temperature
+		}
+		if h.Temperature < plan.Low {
+			plan.Low = h.Temperature
+		}
+		if sunnyHour(cfg, h) {
+			plan.SunnyHours++
+			if h.Time.In(day.Location()).Hour() >= planAfternoon {
+				plan.AfternoonHours++
+			}
+		}
+	}
+	if cfg.SolarDisabled {
+		plan.Reasons = append(plan.Reasons, "solar is disabled")
+		return &plan
+	}
+
+	runtime := DurationFromHours(cfg.RunTime, 1.0)
+	switch {
+	case water >= cfg.Target-cfg.Tolerance:
+		plan.Reasons = append(plan.Reasons, "the pool is warm enough that solar won't run")
+	case time.Duration(plan.AfternoonHours)*time.Hour >= runtime:
+		plan.SkipSweep = true
+		plan.Reasons = append(plan.Reasons, fmt.Sprintf(
+			"%dh of afternoon sun will run solar, covering the %s of filtration",
+			plan.AfternoonHours, shortDuration(runtime)))
+	default:
+		plan.Reasons = append(plan.Reasons, fmt.Sprintf(
+			"%dh of afternoon sun won't cover the %s of filtration", plan.AfternoonHours, shortDuration(runtime)))
+	}
+
+	if next := f.Day(day.AddDate(0, 0, 1)); len(next) > 0 && plan.SunnyHours > 0 {
+		high := next[0].Temperature
+		for _, h := range next {
+			if h.Temperature > high {
+				high = h.Temperature
+			}
+		}
+		if plan.High-high >= coldFrontDrop {
+			plan.PreWarm = true
+			plan.Reasons = append(plan.Reasons, fmt.Sprintf(
+				"cold front, tomorrow's high of %0.1f°C is %0.1f°C below today's", high, plan.High-high))
+		}
+	}
+	return &plan
+}
+
+// UpdateForecast fetches the forecast, it is slow so it runs in its own go routine
+func (ppc *PoolPumpController) UpdateForecast() {
+	if err := ppc.forecaster.Update(time.Now()); err != nil {
+		Error("Could not update the forecast: %v", err)
+		return
+	}
+	if plan := ppc.Plan(time.Now()); plan != nil {
+		Info("Plan for %s: %s", plan.Day.Format(dayFormat), plan)
+	}
+}
+
+// Plan returns the plan for the day of t, nil without a forecast for it
+func (ppc *PoolPumpController) Plan(t time.Time) *Plan {
+	f, _ := ppc.forecaster.Latest()
+	return makePlan(f, t, ppc.config.cfg, ppc.runningTemp.Temperature())
+}
+
+// preWarming returns true while the plan calls for banking heat ahead of a cold front
+func (ppc *PoolPumpController) preWarming(now time.Time) bool {
+	return preWarmWanted(ppc.config.cfg, ppc.conditions(now), now)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakePlan(t *testing.T) {
+	midnight := time.Date(2021, time.June, 21, 0, 0, 0, 0, time.Local)
+	cfg := &PersistedConfig{Target: 30.0, Tolerance: 0.5, RunTime: 3.0}
+	f, err := parseForecast("test", testForecast(midnight, 30.0, 28.0), midnight)
+	assert.NoError(t, err)
+
+	plan := makePlan(f, midnight.Add(3*time.Hour), cfg, 27.0)
+	assert.Equal(t, midnight, plan.Day)
+	assert.Equal(t, 6, plan.SunnyHours)
+	assert.Equal(t, 4, plan.AfternoonHours)
+	assert.True(t, plan.SkipSweep)
+	assert.False(t, plan.PreWarm)
+	assert.Equal(t, "skip the morning sweep", plan.String())
+	assert.Equal(t, []string{"4h of afternoon sun will run solar, covering the 3h00m of filtration"}, plan.Reasons)
+
+	plan = makePlan(f, midnight, cfg, 30.5)
+	assert.False(t, plan.SkipSweep, "Solar won't run")
+	assert.False(t, makePlan(f, midnight, cfg, 29.8).SkipSweep, "Within the band, solar won't run")
+	assert.Equal(t, "normal operation", plan.String())
+
+	cfg.RunTime = 6.0
+	assert.False(t, makePlan(f, midnight, cfg, 27.0).SkipSweep, "Not enough sun")
+	cfg.RunTime = 3.0
+
+	f, _ = parseForecast("test", testForecast(midnight, 30.0, 20.0), midnight)
+	plan = makePlan(f, midnight, cfg, 27.0)
+	assert.True(t, plan.PreWarm)
+	assert.Equal(t, "skip the morning sweep, pre-warm", plan.String())
+	assert.False(t, makePlan(f, midnight.AddDate(0, 0, 1), cfg, 27.0).PreWarm, "No forecast past tomorrow")
+	assert.Nil(t, makePlan(f, midnight.AddDate(0, 0, 2), cfg, 27.0))
+	assert.Nil(t, makePlan(nil, midnight, cfg, 27.0))
+
+	cfg.SolarDisabled = true
+	plan = makePlan(f, midnight, cfg, 27.0)
+	assert.False(t, plan.SkipSweep || plan.PreWarm)
+}
+
+func TestControllerPlan(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 29.8, 50.0, 33.0, OFF)
+	trp.ppc.runningTemp = &trp.pumpTemp
+	now := time.Now()
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	dawn := midnight.Add(4 * time.Hour)
+
+	trp.ppc.filtration.completed = dawn.Add(-48 * time.Hour)
+	assert.True(t, trp.ppc.filtrationDue(dawn), "No forecast")
+	assert.False(t, trp.ppc.shouldWarm(), "Within the band")
+
+	f, _ := parseForecast("test", testForecast(midnight, 30.0, 20.0), now)
+	trp.ppc.forecaster.forecast = f
+	runtime := trp.ppc.config.cfg.RunTime
+	defer func() { trp.ppc.config.cfg.RunTime = runtime }()
+	trp.ppc.config.cfg.RunTime = 3.0
+	assert.True(t, trp.ppc.filtrationDue(dawn), "Within the band, solar won't run")
+	assert.True(t, trp.ppc.shouldWarm(), "Pre-warm to the top of the band")
+	trp.pumpTemp.temp = 30.6
+	assert.False(t, trp.ppc.shouldWarm())
+
+	trp.pumpTemp.temp = 28.0
+	evening := midnight.Add(planEvening * time.Hour)
+	assert.False(t, trp.ppc.filtrationDue(evening), "Not deferred yet")
+	assert.False(t, trp.ppc.filtrationDue(dawn), "Solar does the filtration")
+	assert.True(t, trp.ppc.filtrationDue(evening), "Solar fell short, make it up")
+	assert.False(t, trp.ppc.filtrationDue(evening.Add(-3*time.Hour)), "Still the afternoon")
+	trp.ppc.filtration.completed = evening
+	assert.False(t, trp.ppc.filtrationDue(evening.Add(time.Hour)), "Made up")
+
+	h := Handler{ppc: trp.ppc}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/plan", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "cold front, tomorrow's high of 19.5°C is 10.0°C below today's")
+	assert.Contains(t, w.Body.String(), "<td>sun</td>")
+}
@@ -10,14 +10,17 @@ const (
 
 	// Do not use GPIO4 for thermistors
 
-	roofGpio     = 14
-	waterGpio    = 15
-	buttonGpio   = 18
-	solarLedGpio = 21
-	solarFwdGpio = 22
-	solarRevGpio = 23
-	pumpGpio     = 24
-	sweepGpio    = 25
+	roofGpio      = 14
+	waterGpio     = 15
+	buttonGpio    = 18
+	solarLedGpio  = 21
+	solarFwdGpio  = 22
+	solarRevGpio  = 23
+	pumpGpio      = 24
+	sweepGpio     = 25
+	loadShedGpio  = 16
+	referenceGpio = 17
+	returnGpio    = 27
 
 	solarMotorTime = 30 * time.Second
 )
@@ -25,15 +28,46 @@ const (
 // The PoolPumpController manages the relays that control the pumps based on
 // data from temperature probes and the weather.
 type PoolPumpController struct {
-	config      *Config
-	switches    *Switches
-	pumpTemp    Thermometer
-	runningTemp Thermometer
-	roofTemp    Thermometer
-	button      *Button
-	tempRrd     *Rrd
-	pumpRrd     *Rrd
-	done        chan bool
+	config       *Config
+	switches     *Switches
+	pumpTemp     Thermometer
+	runningTemp  Thermometer
+	roofTemp     Thermometer
+	airTemp      Thermometer // nil unless an air sensor is configured
+	returnTemp   Thermometer // nil unless the solar return line probe is wired
+	poolTemp     Thermometer // nil unless there is a probe in the pool
+	samplers     []*SampledThermometer
+	pumpHealth   *SensorHealth
+	roofHealth   *SensorHealth
+	airHealth    *SensorHealth
+	returnHealth *SensorHealth
+	poolHealth   *SensorHealth
+	irradiance   *Irradiance
+	forecaster   *Forecaster
+	inputs       *Inputs
+	trend        *TimeHistory
+	atTarget     *TargetNotifier
+	button       *Button
+	tempRrd      *Rrd
+	pumpRrd      *Rrd
+	energyRrd    *Rrd
+	rawRrd       *Rrd
+	heatRrd      *Rrd
+	inputsRrd    *Rrd
+	flowRrd      *Rrd
+	weatherRrd   *Rrd
+	energy       *EnergyMeter
+	heat         *HeatMeter
+	flowMeter    *FlowMeter
+	shadow       *Shadow
+	advisor      *TuningAdvisor
+	solarWatch   *SolarWatchdog
+	flowWatch    *FlowWatchdog
+	alerts       *Alerts
+	loadShed     *LoadShed
+	filtration   *Filtration
+	reference    *ReferenceChannel
+	done         chan bool
 }
 
 // RunningWaterThermometer creates a thermometer that remembers the temperature of the water when the
@@ -45,19 +79,102 @@ func RunningWaterThermometer(t Thermometer, s *Switches) *SelectiveThermometer {
 	})
 }
 
+// poolWater returns the temperature of the pool and whether it can be trusted right now.  A
+// probe in the pool always can, the probe at the pump only while the water is moving.
+func (ppc *PoolPumpController) poolWater() (float64, bool) {
+	if f, ok := ppc.runningTemp.(*FallbackThermometer); ok && f.UsingPrimary() && ppc.poolHealth.OK() {
+		return ppc.poolTemp.Temperature(), true
+	}
+	return ppc.pumpTemp.Temperature(), ppc.switches.State() > OFF && ppc.pumpHealth.OK()
+}
+
 // NewPoolPumpController creates a new pump controller
 func NewPoolPumpController(config *Config) *PoolPumpController {
+	// The pump and roof have a default GPIO, so creating their thermometers can't fail
+	pumpSampler, _ := NewRoleSampler(config, RolePump, "Pump", waterGpio)
+	roofSampler, _ := NewRoleSampler(config, RoleRoof, "Roof", roofGpio)
+	pumpTemp := NewCalibratedThermometer(pumpSampler, mftr, config.probeCalibration(RolePump))
+	roofTemp := NewCalibratedThermometer(roofSampler, mftr, config.probeCalibration(RoleRoof))
 	ppc := PoolPumpController{
-		config:   config,
-		switches: NewSwitches(mftr),
-		pumpTemp: NewGpioThermometer("Pump", mftr, waterGpio),
-		roofTemp: NewGpioThermometer("Roof", mftr, roofGpio),
-		tempRrd:  NewRrd(*config.dataDirectory + "/temperature.rrd"),
-		pumpRrd:  NewRrd(*config.dataDirectory + "/pumpstatus.rrd"),
-		done:     make(chan bool),
+		config:       config,
+		switches:     NewSwitches(mftr),
+		pumpTemp:     pumpTemp,
+		roofTemp:     roofTemp,
+		samplers:     []*SampledThermometer{pumpSampler, roofSampler},
+		pumpHealth:   NewSensorHealth("Pump"),
+		roofHealth:   NewSensorHealth("Roof"),
+		airHealth:    NewSensorHealth("Air"),
+		returnHealth: NewSensorHealth("Return"),
+		poolHealth:   NewSensorHealth("Pool"),
+		tempRrd:      NewRrd(*config.dataDirectory + "/temperature.rrd"),
+		pumpRrd:      NewRrd(*config.dataDirectory + "/pumpstatus.rrd"),
+		energyRrd:    NewRrd(*config.dataDirectory + "/energy.rrd"),
+		rawRrd:       NewRrd(*config.dataDirectory + "/rawtemp.rrd"),
+		heatRrd:      NewRrd(*config.dataDirectory + "/heatgain.rrd"),
+		weatherRrd:   NewRrd(*config.dataDirectory + "/weather.rrd"),
+		inputsRrd:    NewRrd(*config.dataDirectory + "/inputs.rrd"),
+		flowRrd:      NewRrd(*config.dataDirectory + "/flow.rrd"),
+		shadow:       NewShadow(),
+		trend:        NewTimeHistory(trendWindow),
+		atTarget:     NewTargetNotifier("Pool At Target", mftr),
+		alerts:       NewAlerts(),
+		done:         make(chan bool),
+	}
+	pumpTemp.accessory.TempSensor.AddCharacteristic(ppc.pumpHealth.StatusFault().Characteristic)
+	roofTemp.accessory.TempSensor.AddCharacteristic(ppc.roofHealth.StatusFault().Characteristic)
+	if airSampler := OptionalRoleSampler(config, RoleAir, "Air"); airSampler != nil {
+		airTemp := NewCalibratedThermometer(airSampler, mftr, config.probeCalibration(RoleAir))
+		airTemp.accessory.TempSensor.AddCharacteristic(ppc.airHealth.StatusFault().Characteristic)
+		ppc.airTemp = airTemp
+		ppc.samplers = append(ppc.samplers, airSampler)
+	}
+	if config.cfg.ReturnProbe || config.sensorConfig(RoleReturn) != nil {
+		returnSampler, _ := NewRoleSampler(config, RoleReturn, "Return", returnGpio) // has a default GPIO
+		returnTemp := NewCalibratedThermometer(returnSampler, mftr, config.probeCalibration(RoleReturn))
+		returnTemp.accessory.TempSensor.AddCharacteristic(ppc.returnHealth.StatusFault().Characteristic)
+		ppc.returnTemp = returnTemp
+		ppc.samplers = append(ppc.samplers, returnSampler)
+	}
+	irradiance, err := NewIrradianceProvider(config.cfg.Irradiance, config.station)
+	if err != nil {
+		Error("Bad irradiance source, not using one: %v", err)
+	}
+	ppc.irradiance = NewIrradiance(irradiance)
+	forecast, err := NewForecastProvider(config.cfg.Forecast)
+	if err != nil {
+		Error("Bad forecast source, not planning: %v", err)
+	}
+	ppc.forecaster = NewForecaster(forecast)
+	ppc.solarWatch = NewSolarWatchdog()
+	ppc.flowWatch = NewFlowWatchdog()
+	ppc.switches.interlock = ppc.interlocked
+	ppc.switches.pump.accessory.Switch.AddCharacteristic(ppc.flowWatch.StatusFault().Characteristic)
+	ppc.loadShed = NewLoadShed(NewGpio(loadShedGpio))
+	ppc.filtration = NewFiltration(time.Now())
+	ppc.inputs = NewInputs(config.cfg.Inputs, ppc.inputChanged)
+	ppc.reference = NewReferenceChannel(NewGpio(referenceGpio))
+	ppc.energy = NewEnergyMeter(config.cfg, *config.dataDirectory+"/energy.json")
+	ppc.heat = NewHeatMeter(*config.dataDirectory + "/heat.json")
+	ppc.flowMeter, err = NewFlowMeter(config.cfg.FlowMeter, *config.dataDirectory+"/flow.json")
+	if err != nil {
+		Error("Bad flow meter configuration, not using it: %v", err)
 	}
+	solarCause := func() string { return CauseSolar }
+	ppc.energy.Track(ppc.switches.pump, ppc.energy.PumpWatts, ppc.switches.Cause)
+	ppc.energy.Track(ppc.switches.sweep, ppc.energy.SweepWatts, ppc.switches.Cause)
+	ppc.energy.Track(ppc.switches.solar.fwdRelay, ppc.energy.ValveWatts, solarCause)
+	ppc.energy.Track(ppc.switches.solar.revRelay, ppc.energy.ValveWatts, solarCause)
+	ppc.advisor = NewTuningAdvisor(ppc.tempRrd, ppc.pumpRrd)
 	ppc.SyncAdjustments()
-	ppc.runningTemp = RunningWaterThermometer(ppc.pumpTemp, ppc.switches)
+	running := RunningWaterThermometer(ppc.pumpTemp, ppc.switches)
+	ppc.runningTemp = running
+	if poolSampler := OptionalRoleSampler(config, RolePool, "Pool Probe"); poolSampler != nil {
+		// A probe in the pool measures it directly, the water at the pump is only used
+		// while the probe is out of touch
+		ppc.poolTemp = NewCalibratedThermometer(poolSampler, mftr, config.probeCalibration(RolePool))
+		ppc.samplers = append(ppc.samplers, poolSampler)
+		ppc.runningTemp = NewFallbackThermometer("Pool", mftr, ppc.poolTemp, running)
+	}
 	return &ppc
 }
 
@@ -76,6 +193,20 @@ func (ppc *PoolPumpController) Update() error {
 	if err != nil {
 		return fmt.Errorf("running temp update failed: %w", err)
 	}
+	if ppc.airTemp != nil {
+		// The air temperature is optional, the controller falls back to the roof without it
+		if err = ppc.airTemp.Update(); err != nil {
+			Info("Air temp update failed: %v", err)
+		}
+	}
+	if ppc.returnTemp != nil {
+		if err = ppc.returnTemp.Update(); err != nil {
+			Info("Return temp update failed: %v", err)
+		}
+	}
+	if err = ppc.irradiance.Update(time.Now()); err != nil {
+		Info("Irradiance update failed: %v", err)
+	}
 	if ppc.config.cfg.ButtonDisabled {
 		ppc.button.Disable()
 	} else {
@@ -84,97 +215,239 @@ func (ppc *PoolPumpController) Update() error {
 	return nil
 }
 
+// coolingHelps returns true when the water is above the target band and the roof is cold
+// enough that running water through the panels would bring it back down.
+func coolingHelps(cfg *PersistedConfig, water, roof float64) bool {
+	if cfg.SolarDisabled {
+		return false
+	}
+	return water > (cfg.Target+cfg.Tolerance) && water > (roof+cfg.DeltaT)
+}
+
+// warmingHelps returns true when the water is below the target band and the roof is hot
+// enough that running water through the panels would bring it up.
+func warmingHelps(cfg *PersistedConfig, water, roof float64) bool {
+	if cfg.SolarDisabled {
+		return false
+	}
+	return water < (cfg.Target-cfg.Tolerance) && water < (roof-cfg.DeltaT)
+}
+
+// solarState picks between SOLAR and MIXING.  When the water is far from the target the
+// sweep is run as well to mix the water at depth.
+func solarState(cfg *PersistedConfig, water float64) State {
+	if water < cfg.Target-cfg.DeltaT || water > cfg.Target+cfg.Tolerance {
+		return MIXING
+	}
+	return SOLAR
+}
+
 // A return value of 'True' indicates that the pool is too hot and the roof is cold
 // (probably at night), running the pumps with solar on would help bring the water
 // down to the target temperature.
 func (ppc *PoolPumpController) shouldCool() bool {
-	if ppc.config.cfg.SolarDisabled {
-		return false
-	}
-	return ppc.pumpTemp.Temperature() > (ppc.config.cfg.Target+ppc.config.cfg.Tolerance) &&
-		ppc.pumpTemp.Temperature() > (ppc.roofTemp.Temperature()+ppc.config.cfg.DeltaT)
+	return coolingWanted(ppc.config.cfg, ppc.conditions(time.Now()))
 }
 
 // A return value of 'True' indicates that the pool is too cool and the roof is hot, running
 // the pumps with solar on would help bring the water up to the target temperature.
 func (ppc *PoolPumpController) shouldWarm() bool {
-	if ppc.config.cfg.SolarDisabled {
-		Debug("shouldWarm: disabled(%t)", ppc.config.cfg.SolarDisabled)
-		return false
+	now := time.Now()
+	return warmingWanted(ppc.config.cfg, ppc.conditions(now), now)
+}
+
+// airTemperature returns the outdoor air temperature, if an air sensor is configured and healthy
+func (ppc *PoolPumpController) airTemperature() (float64, bool) {
+	if ppc.airTemp == nil || !ppc.airHealth.OK() {
+		return 0.0, false
+	}
+	return ppc.airTemp.Temperature(), true
+}
+
+// coldAir returns true when the air is cold enough that the sweep should run with solar
+// to mix the water
+func (ppc *PoolPumpController) coldAir() bool {
+	return airCold(ppc.config.cfg, ppc.conditions(time.Now()))
+}
+
+func coldAirTemp(cfg *PersistedConfig) float64 {
+	if cfg.ColdAirTemp == 0.0 {
+		return defaultColdAirTemp
+	}
+	return cfg.ColdAirTemp
+}
+
+func freezeTemp(cfg *PersistedConfig) float64 {
+	if cfg.FreezeTemp == 0.0 {
+		return defaultFreezeTemp
 	}
+	return cfg.FreezeTemp
+}
+
+// freezeReference returns the temperature used to decide on freeze protection
+func (ppc *PoolPumpController) freezeReference() (string, float64, bool) {
+	return freezeReading(ppc.conditions(time.Now()))
+}
+
+// shouldFreezeProtect returns true when it is cold enough outside that the water needs to
+// keep moving to protect the pipes
+func (ppc *PoolPumpController) shouldFreezeProtect() bool {
+	return freezeWanted(ppc.config.cfg, ppc.conditions(time.Now()), ppc.switches.State())
+}
+
+func dailyFrequency(cfg *PersistedConfig) time.Duration {
+	return DurationFromHours((cfg.DailyFrequency-0.25)*24.0, 12.0)
+}
 
-	waterCold := ppc.pumpTemp.Temperature() < (ppc.config.cfg.Target - ppc.config.cfg.Tolerance)
-	roofHot := ppc.pumpTemp.Temperature() < (ppc.roofTemp.Temperature() - ppc.config.cfg.DeltaT)
-	warm := waterCold && roofHot
-	if warm {
-		Info("ShouldWarm: %t waterCold(%t) roofHot(%t)", warm, waterCold, roofHot)
-		Info("Temp(%0.3f) < %0.3f {Target(%0.3f) - Tolerance(%0.3f)} : WaterCold(%t)",
-			ppc.pumpTemp.Temperature(),
-			ppc.config.cfg.Target-ppc.config.cfg.Tolerance,
-			ppc.config.cfg.Target,
-			ppc.config.cfg.Tolerance,
-			waterCold)
-		Info("Temp(%0.3f) < %0.3f {Roof(%0.3f) - DeltaT(%0.3f)} : RoofHot(%t)",
-			ppc.pumpTemp.Temperature(),
-			ppc.roofTemp.Temperature()-ppc.config.cfg.DeltaT,
-			ppc.roofTemp.Temperature(),
-			ppc.config.cfg.DeltaT,
-			roofHot)
-	}
-	return warm
-}
-
-// RunPumpsIfNeeded - If the water is not within the tolerance limit of the target, and the roof
-// temperature would help get the temperature to be closer to the target, the pumps will be
-// turned on.  If the outdoor temperature is low or the pool is very cold, the sweep will also be
-// run to help mix the water as it approaches the target.
+// filtrationDue returns true when the daily filtration run should be happening, and records
+// when the morning run is left to an afternoon solar run
+func (ppc *PoolPumpController) filtrationDue(now time.Time) bool {
+	due, deferring := filtrationWanted(ppc.config.cfg, ppc.conditions(now), now)
+	if deferring && ppc.filtration.Defer(now) {
+		Info("Leaving the filtration to the afternoon solar run")
+	}
+	return due
+}
+
+// conditions gathers what the automatic pump decision is made from
+func (ppc *PoolPumpController) conditions(now time.Time) *Conditions {
+	c := Conditions{
+		Water:     ppc.pumpTemp.Temperature(),
+		Roof:      ppc.roofTemp.Temperature(),
+		Pool:      ppc.runningTemp.Temperature(),
+		RoofOK:    ppc.roofHealth.OK(),
+		Healthy:   ppc.sensorsHealthy(),
+		Leak:      ppc.inputs.Active(InputLeak),
+		Cover:     ppc.coverClosed(),
+		Raining:   ppc.inputs.Active(InputRain),
+		Trend:     ppc.PoolTrend(),
+		Shedding:  ppc.loadShed.Active(now, ppc.config.cfg.LoadShedInput),
+		Owed:      ppc.loadShed.Owed(),
+		Manual:    ppc.switches.ManualState(ppc.config.cfg.RunTime),
+		Started:   ppc.switches.GetStartTime(),
+		Completed: ppc.filtration.Completed(),
+		Deferred:  ppc.filtration.Deferred(now),
+		Ran:       ppc.filtration.Ran(now),
+	}
+	c.Air, c.AirOK = ppc.airTemperature()
+	if obs, ok := ppc.config.station.Last(now); ok && obs.Raining() {
+		c.Raining = true
+	}
+	c.Irradiance, c.IrradianceOK = ppc.irradiance.Value()
+	c.Forecast, _ = ppc.forecaster.Latest()
+	c.SolarFault, _ = ppc.solarWatch.Fault()
+	c.FlowBlocked, c.FlowReason = ppc.flowWatch.Blocked(now)
+	return &c
+}
+
+// interlocked returns true, with the reason, while the pumps are not allowed to start
+func (ppc *PoolPumpController) interlocked() (bool, string) {
+	if ppc.inputs.Active(InputLeak) {
+		return true, "leak detected"
+	}
+	return ppc.flowWatch.Blocked(time.Now())
+}
+
+// RunPumpsIfNeeded - makes the automatic pump decision from the current conditions and
+// applies it to the switches.  The run time and the filtration missed while shedding load
+// are kept track of first, so the decision sees them.
 func (ppc *PoolPumpController) RunPumpsIfNeeded() {
+	ppc.runPumps(time.Now())
+}
+
+func (ppc *PoolPumpController) runPumps(now time.Time) {
 	state := ppc.switches.State()
-	if ppc.switches.ManualState(ppc.config.cfg.RunTime) {
+	cfg := ppc.config.cfg
+	runtime := DurationFromHours(cfg.RunTime, 1.0)
+	filtered := ppc.filtration.Account(now, state > OFF, runtime)
+	c := ppc.conditions(now)
+	c.Filtered = filtered
+
+	due, deferring := filtrationWanted(cfg, c, now)
+	if deferring && ppc.filtration.Defer(now) {
+		Info("Leaving the filtration to the afternoon solar run")
+	}
+	ppc.loadShed.Account(now, c.Shedding, due, state > OFF, runtime)
+	c.Owed = ppc.loadShed.Owed()
+
+	d := decide(cfg, c, state, now)
+	if d.State == state {
 		return
 	}
-	if state == DISABLED && !ppc.config.cfg.Disabled && !ppc.config.cfg.SolarDisabled {
-		ppc.switches.setSwitches(false, false, false, false, OFF)
+	if d.Reason != "" {
+		Log("%s", d.Reason)
+	}
+	if d.State <= OFF {
+		ppc.switches.setSwitches(false, false, false, false, d.State)
 		return
 	}
-	if ppc.config.cfg.Disabled {
-		if state > DISABLED {
-			ppc.switches.setSwitches(false, false, false, false, DISABLED)
-		}
+	ppc.switches.SetState(d.State, false, cfg.RunTime)
+}
+
+// coverClosed returns true while a cover switch says the pool is covered
+func (ppc *PoolPumpController) coverClosed() bool {
+	return ppc.inputs.Active(InputCover)
+}
+
+// sweepAllowed drops the sweep from a state while the cover is closed, it would tangle in it
+func (ppc *PoolPumpController) sweepAllowed(state State) State {
+	return withoutSweep(ppc.conditions(time.Now()), state)
+}
+
+// inputChanged is called when a digital input changes state
+func (ppc *PoolPumpController) inputChanged(in *DigitalInput, active bool) {
+	Log("Input %s", in)
+	if in.Role() == InputLeak && active {
+		ppc.alerts.Raise(in.Name(), "leak detected, the pumps are stopped")
+	}
+}
+
+// RunShadow evaluates the shadow strategy against the same conditions used by
+// RunPumpsIfNeeded.  It never changes the state of the switches.
+func (ppc *PoolPumpController) RunShadow() {
+	sc := ppc.config.cfg.Shadow
+	if sc == nil || !sc.Enabled {
 		return
 	}
+	now := time.Now()
+	ppc.shadow.Evaluate(sc, ppc.config.cfg, ppc.switches.State(), ppc.conditions(now), ppc.filtration, now)
+}
 
-	if ppc.shouldCool() || ppc.shouldWarm() {
-		// Wide deltaT between target and temp or when it's cold, run sweep
-		if state == MIXING {
-			return
-		}
-		Info("ShouldCool(%t) - ShouldWarm(%t)", ppc.shouldCool(), ppc.shouldWarm())
-		if ppc.pumpTemp.Temperature() < ppc.config.cfg.Target-ppc.config.cfg.DeltaT ||
-			ppc.pumpTemp.Temperature() > ppc.config.cfg.Target+ppc.config.cfg.Tolerance {
-			ppc.switches.SetState(MIXING, false, ppc.config.cfg.RunTime)
-		} else {
-			// Just push water through the panels
-			ppc.switches.SetState(SOLAR, false, ppc.config.cfg.RunTime)
-		}
+// CheckSolar verifies that the water is responding while it runs through the panels.  If it
+// isn't, an alert is raised and solar is taken out of the flow until the fault is acknowledged.
+func (ppc *PoolPumpController) CheckSolar() {
+	state := ppc.switches.State()
+	fault, reason := ppc.solarWatch.Check(ppc.config.cfg, state,
+		ppc.pumpTemp.Temperature(), ppc.roofTemp.Temperature(), time.Now())
+	if !fault {
 		return
 	}
+	ppc.alerts.Raise("Solar", "Solar fault, %s", reason)
+	manual := ppc.switches.ManualState(ppc.config.cfg.RunTime)
+	if state == MIXING {
+		ppc.switches.SetState(SWEEP, manual, ppc.config.cfg.RunTime)
+	} else {
+		ppc.switches.SetState(PUMP, manual, ppc.config.cfg.RunTime)
+	}
+}
 
-	// If the pumps havent run in a day, wait til 4AM then start them
-	freqHours := DurationFromHours((ppc.config.cfg.DailyFrequency-0.25)*24.0, 12.0)
-	runtime := DurationFromHours(ppc.config.cfg.RunTime, 1.0)
-	if time.Since(ppc.switches.GetStopTime()) > freqHours && time.Now().Hour() < 6 { // run in the early morning
-		Log("Daily running SWEEP: %s", freqHours.String())
-		ppc.switches.SetState(SWEEP, false, ppc.config.cfg.RunTime) // Clean pool
-		if time.Since(ppc.switches.GetStartTime()) > runtime {
-			ppc.switches.StopAll(false) // End daily
-		}
+// CheckFlow verifies the flow switch closes while the pump runs.  Without flow the pump and
+// the sweep booster, which needs the pump's flow, are stopped.
+func (ppc *PoolPumpController) CheckFlow() {
+	if !ppc.inputs.Configured(InputFlow) {
 		return
 	}
-	// If there is no reason to turn on the pumps and it's not manual, turn off
-	if state > OFF && ppc.switches.GetStartTime().Add(time.Hour).Before(time.Now()) {
-		ppc.switches.StopAll(false)
+	state := ppc.switches.State()
+	action, reason := ppc.flowWatch.Check(ppc.config.cfg, state > OFF, ppc.inputs.Active(InputFlow), time.Now())
+	switch action {
+	case flowRetry:
+		ppc.alerts.Raise("Flow", "Stopping the pump, %s", reason)
+	case flowFault:
+		ppc.alerts.Raise("Flow", "Flow fault, %s", reason)
+	default:
+		return
 	}
+	ppc.switches.StopAll(false)
 }
 
 // Runs calls PoolPumpController.Update() and PoolPumpController.RunPumpsIfNeeded()
@@ -182,22 +455,49 @@ func (ppc *PoolPumpController) RunPumpsIfNeeded() {
 func (ppc *PoolPumpController) runLoop() {
 	interval := time.Second * 5
 	postStatus := time.Now()
+	runTuning := time.Now().Add(time.Hour)
+	runReference := time.Now()
+	runForecast := time.Now()
 	keepRunning := true
 	for keepRunning {
 		if postStatus.Before(time.Now()) {
 			postStatus = time.Now().Add(5 * time.Minute)
 			Info(ppc.Status())
 		}
+		if runTuning.Before(time.Now()) {
+			runTuning = time.Now().Add(24 * time.Hour)
+			go ppc.advisor.Run(ppc.config.cfg)
+		}
+		if runForecast.Before(time.Now()) {
+			runForecast = time.Now().Add(forecastRefresh)
+			go ppc.UpdateForecast()
+		}
+		if runReference.Before(time.Now()) {
+			runReference = time.Now().Add(referenceInterval)
+			ppc.CheckReference()
+		}
 		ppc.SyncAdjustments()
 		select {
 		case <-ppc.done:
 			ppc.button.Stop()
+			ppc.inputs.Stop()
+			if ppc.flowMeter != nil {
+				ppc.flowMeter.Stop()
+			}
 			// Turn off the pumps, and don't let them turn back on
 			ppc.switches.Disable()
 			keepRunning = false
 		case <-time.After(interval):
 			ppc.Update()
+			ppc.CheckHealth()
+			ppc.RecordTrend(time.Now())
+			ppc.CheckTarget()
+			ppc.UpdateFlow()
+			ppc.UpdateHeat()
 			ppc.RunPumpsIfNeeded()
+			ppc.CheckSolar()
+			ppc.CheckFlow()
+			ppc.RunShadow()
 			ppc.UpdateRrd()
 			Debug(ppc.Status())
 		}
@@ -224,11 +524,18 @@ func (ppc *PoolPumpController) Start() error {
 	ppc.createRrds()
 
 	// Start go routines
+	for _, s := range ppc.samplers {
+		s.Start()
+	}
 	err := ppc.Update()
 	if err != nil {
 		return err
 	}
 	ppc.button.Start()
+	ppc.inputs.Start()
+	if ppc.flowMeter != nil {
+		ppc.flowMeter.Start()
+	}
 	go ppc.runLoop()
 	return nil
 }
@@ -237,33 +544,63 @@ func (ppc *PoolPumpController) Start() error {
 func (ppc *PoolPumpController) Stop() {
 	ppc.switches.StopAll(true)
 	ppc.done <- true
+	for _, s := range ppc.samplers {
+		s.Stop()
+	}
+	ppc.heat.Save()
+	if ppc.flowMeter != nil {
+		ppc.flowMeter.Save()
+	}
 }
 
-// PersistCalibration saves the callibration data
+// PersistCalibration saves the callibration data.  The members of a composite thermometer
+// each keep their own adjustment, by GPIO.
 func (ppc *PoolPumpController) PersistCalibration() {
-	t, ok := ppc.pumpTemp.(*GpioThermometer)
-	if ok {
-		ppc.config.cfg.PumpAdjustment = t.adjust
-	}
-	t, ok = ppc.roofTemp.(*GpioThermometer)
-	if ok {
-		ppc.config.cfg.RoofAdjustment = t.adjust
-	}
+	factor := ppc.reference.Factor()
+	persistAdjustments(ppc.config.cfg, ppc.pumpTemp, &ppc.config.cfg.PumpAdjustment, factor)
+	persistAdjustments(ppc.config.cfg, ppc.roofTemp, &ppc.config.cfg.RoofAdjustment, factor)
 	err := ppc.config.Save()
 	if err != nil {
 		Error("Could not persist config: %v", err)
 	}
 }
 
-// SyncAdjustments syncrhonizes the adjustments to temperature sensors
-func (ppc *PoolPumpController) SyncAdjustments() {
-	t, ok := ppc.pumpTemp.(*GpioThermometer)
-	if ok {
-		t.adjust = ppc.config.cfg.PumpAdjustment
+// persistAdjustments stores the adjustment of a single probe in role, or the adjustment of each
+// member of a composite in the config's ProbeAdjustments
+func persistAdjustments(cfg *PersistedConfig, t Thermometer, role *float64, factor float64) {
+	thermometers := gpioThermometers(t)
+	switch len(thermometers) {
+	case 0:
+	case 1:
+		*role = thermometers[0].adjust / factor
+	default:
+		if cfg.ProbeAdjustments == nil {
+			cfg.ProbeAdjustments = map[uint8]float64{}
+		}
+		for _, g := range thermometers {
+			cfg.ProbeAdjustments[g.pin.Pin()] = g.adjust / factor
+		}
 	}
-	t, ok = ppc.roofTemp.(*GpioThermometer)
-	if ok {
-		t.adjust = ppc.config.cfg.RoofAdjustment
+}
+
+// SyncAdjustments syncrhonizes the adjustments to temperature sensors, corrected for the
+// drift measured on the reference channel
+func (ppc *PoolPumpController) SyncAdjustments() {
+	factor := ppc.reference.Factor()
+	syncAdjustments(ppc.config.cfg, ppc.pumpTemp, ppc.config.cfg.PumpAdjustment, factor)
+	syncAdjustments(ppc.config.cfg, ppc.roofTemp, ppc.config.cfg.RoofAdjustment, factor)
+}
+
+// syncAdjustments sets the adjustment of a single probe from role.  Members of a composite use
+// their own adjustment, falling back to role until they have been calibrated.
+func syncAdjustments(cfg *PersistedConfig, t Thermometer, role float64, factor float64) {
+	thermometers := gpioThermometers(t)
+	for _, g := range thermometers {
+		adjust := role
+		if stored, ok := cfg.ProbeAdjustments[g.pin.Pin()]; ok && len(thermometers) > 1 {
+			adjust = stored
+		}
+		g.adjust = adjust * factor
 	}
 }
 
@@ -271,10 +608,113 @@ func (ppc *PoolPumpController) SyncAdjustments() {
 func (ppc *PoolPumpController) Status() string {
 	return fmt.Sprintf(
 		"Status(%s) Button(%s) Solar(%s) Pump(%s) Sweep(%s) Manual(%t) Target(%0.1f) "+
-			"Pool(%0.1f) Pump(%0.1f) Roof(%0.1f)",
+			"Pool(%0.1f) Pump(%0.1f) Roof(%0.1f) Trend(%s)",
 		ppc.switches.State(), ppc.button.pin.Read(), ppc.switches.solar.Status(),
 		ppc.switches.pump.Status(), ppc.switches.sweep.Status(),
 		ppc.switches.ManualState(ppc.config.cfg.RunTime), ppc.config.cfg.Target,
 		ppc.runningTemp.Temperature(), ppc.pumpTemp.Temperature(),
-		ppc.roofTemp.Temperature())
+		ppc.roofTemp.Temperature(), ppc.PoolTrend()) + ppc.airStatus() + ppc.returnStatus() + ppc.irradianceStatus()
+}
+
+// StatusReport is the state of the system reported by the JSON API, temperatures are celsius
+type StatusReport struct {
+	Time       time.Time
+	State      string
+	Solar      string
+	Manual     bool
+	Target     float64
+	Pool       float64
+	Pump       float64
+	Roof       float64
+	Air        *float64        `json:",omitempty"`
+	Return     *float64        `json:",omitempty"`
+	Irradiance *float64        `json:",omitempty"`
+	Weather    *Observation    `json:",omitempty"`
+	Inputs     map[string]bool `json:",omitempty"` // name -> active
+	FlowFault  string          `json:",omitempty"`
+	FlowGPM    *float64        `json:",omitempty"` // measured by the flow meter
+	Gallons    *float64        `json:",omitempty"` // filtered over the last day
+	Turnovers  *float64        `json:",omitempty"`
+	HeatGain   float64
+	Trend      Trend
+	TrendText  string
+	ETA        ETA
+	ETAText    string
+}
+
+// StatusReport returns the current state of the system
+func (ppc *PoolPumpController) StatusReport() StatusReport {
+	now := time.Now()
+	trend := ppc.PoolTrend()
+	eta := ppc.ETA(now)
+	report := StatusReport{
+		Time:      now,
+		State:     ppc.switches.State().String(),
+		Solar:     ppc.switches.solar.Status(),
+		Manual:    ppc.switches.ManualState(ppc.config.cfg.RunTime),
+		Target:    ppc.config.cfg.Target,
+		Pool:      ppc.runningTemp.Temperature(),
+		Pump:      ppc.pumpTemp.Temperature(),
+		Roof:      ppc.roofTemp.Temperature(),
+		HeatGain:  ppc.heat.Watts(),
+		Trend:     trend,
+		TrendText: trend.String(),
+		ETA:       eta,
+		ETAText:   eta.String(),
+	}
+	if ppc.airTemp != nil {
+		air := ppc.airTemp.Temperature()
+		report.Air = &air
+	}
+	if ppc.returnTemp != nil {
+		ret := ppc.returnTemp.Temperature()
+		report.Return = &ret
+	}
+	if value, ok := ppc.irradiance.Value(); ok {
+		report.Irradiance = &value
+	}
+	if obs, ok := ppc.config.station.Last(now); ok {
+		report.Weather = &obs
+	}
+	for _, in := range ppc.inputs.All() {
+		if report.Inputs == nil {
+			report.Inputs = map[string]bool{}
+		}
+		report.Inputs[in.Name()] = in.Active()
+	}
+	if fault, reason := ppc.flowWatch.Fault(); fault {
+		report.FlowFault = reason
+	}
+	if ppc.flowMeter != nil {
+		gpm := ppc.flowMeter.GPM()
+		gallons, turnovers := ppc.Turnover(now)
+		report.FlowGPM = &gpm
+		report.Gallons = &gallons
+		if ppc.config.cfg.PoolGallons > 0.0 {
+			report.Turnovers = &turnovers
+		}
+	}
+	return report
+}
+
+func (ppc *PoolPumpController) airStatus() string {
+	if ppc.airTemp == nil {
+		return ""
+	}
+	return fmt.Sprintf(" Air(%0.1f)", ppc.airTemp.Temperature())
+}
+
+func (ppc *PoolPumpController) returnStatus() string {
+	if ppc.returnTemp == nil {
+		return ""
+	}
+	return fmt.Sprintf(" Return(%0.1f) Gain(%0.0fW)", ppc.returnTemp.Temperature(), ppc.heat.Watts())
+}
+
+func (ppc *PoolPumpController) irradianceStatus() string {
+	value, ok := ppc.irradiance.Value()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" Irradiance(%0.0f)", value)
 }
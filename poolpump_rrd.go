@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
 )
 
 func (r *Rrd) addTemp(name, title string, colorid, which int) {
@@ -19,7 +21,7 @@ func (r *Rrd) addTemp(name, title string, colorid, which int) {
 
 func (ppc *PoolPumpController) createRrds() error {
 	ppc.tempRrd.addTemp("pump", "Pump", 8, 1)
-	ppc.tempRrd.addTemp("weather", "Weather", 1, 2)
+	ppc.tempRrd.addTemp("weather", "Air", 1, 2)
 	ppc.tempRrd.addTemp("roof", "Roof", 2, 3)
 	ppc.tempRrd.addTemp("solar", "SolRad w/sqm", 4, 4)
 	ppc.tempRrd.addTemp("pool", "Pool", 0, 5)
@@ -27,7 +29,19 @@ func (ppc *PoolPumpController) createRrds() error {
 	ppc.tempRrd.AddStandardRRAs()
 	ppc.tempRrd.Creator().Create(*ppc.config.forceRrd)
 
+	rc := ppc.rawRrd.Creator()
+	rc.DS("pump", "GAUGE", "30", "-273", "1000")
+	rc.DS("roof", "GAUGE", "30", "-273", "1000")
+	ppc.rawRrd.AddStandardRRAs()
+	rc.Create(*ppc.config.forceRrd) // fails if already exists
+
 	tg := ppc.tempRrd.grapher
+	tg.Def("r1", ppc.rawRrd.path, "pump", "AVERAGE")
+	tg.CDef("rf1", "9,5,/,r1,*,32,+")
+	tg.Line(1.0, "rf1", colorStr(9), "Pump Raw")
+	tg.Def("r3", ppc.rawRrd.path, "roof", "AVERAGE")
+	tg.CDef("rf3", "9,5,/,r3,*,32,+")
+	tg.Line(1.0, "rf3", colorStr(3), "Roof Raw")
 	tg.SetTitle("Temperatures and Solar Radiation")
 	tg.SetVLabel("Degrees Farenheit")
 	tg.SetRightAxis(1, 0.0)
@@ -57,32 +71,199 @@ func (ppc *PoolPumpController) createRrds() error {
 	pg.Line(2.0, "t2", colorStr(2), "Solar Status")
 	pg.Def("t3", ppc.pumpRrd.path, "manual", "AVERAGE")
 	pg.Line(2.0, "t3", colorStr(6), "Manual Operation")
+
+	ec := ppc.energyRrd.Creator()
+	ec.DS("power", "GAUGE", "30", "0", "10000")
+	ppc.energyRrd.AddStandardRRAs()
+	ec.Create(*ppc.config.forceRrd) // fails if already exists
+
+	eg := ppc.energyRrd.grapher
+	eg.SetTitle("Power Usage")
+	eg.SetVLabel("Watts")
+	eg.SetLowerLimit(0.0)
+	eg.SetRightAxis(1, 0.0)
+	eg.SetRightAxisLabel("Watts")
+	eg.SetSize(640, 200) // Config?
+	eg.SetImageFormat("PNG")
+
+	eg.Def("e1", ppc.energyRrd.path, "power", "AVERAGE")
+	eg.Area("e1", colorStr(2), "Power")
+
+	hc := ppc.heatRrd.Creator()
+	hc.DS("gain", "GAUGE", "30", "-100000", "100000")
+	ppc.heatRrd.AddStandardRRAs()
+	hc.Create(*ppc.config.forceRrd) // fails if already exists
+
+	hg := ppc.heatRrd.grapher
+	hg.SetTitle("Solar Heat Gain")
+	hg.SetVLabel("Watts")
+	hg.SetRightAxis(1, 0.0)
+	hg.SetRightAxisLabel("Watts")
+	hg.SetSize(640, 200) // Config?
+	hg.SetImageFormat("PNG")
+
+	hg.Def("h1", ppc.heatRrd.path, "gain", "AVERAGE")
+	hg.Area("h1", colorStr(1), "Heat Gain")
+
+	wc := ppc.weatherRrd.Creator()
+	wc.DS("temp", "GAUGE", "300", "-273", "1000")
+	wc.DS("solar", "GAUGE", "300", "0", "2000")
+	wc.DS("uv", "GAUGE", "300", "0", "20")
+	wc.DS("rain", "GAUGE", "300", "0", "1000")
+	wc.DS("wind", "GAUGE", "300", "0", "100")
+	wc.DS("gust", "GAUGE", "300", "0", "100")
+	ppc.weatherRrd.AddStandardRRAs()
+	wc.Create(*ppc.config.forceRrd) // fails if already exists
+
+	wg := ppc.weatherRrd.grapher
+	wg.SetTitle("Weather Station")
+	wg.SetVLabel("Degrees Farenheit, MPH, UV")
+	wg.SetRightAxis(1, 0.0)
+	wg.SetRightAxisLabel("dekawatts/sqm, mm/h")
+	wg.SetSize(640, 200) // Config?
+	wg.SetImageFormat("PNG")
+
+	wg.Def("w1", ppc.weatherRrd.path, "temp", "AVERAGE")
+	wg.CDef("wf1", "9,5,/,w1,*,32,+")
+	wg.Line(2.0, "wf1", colorStr(1), "Air")
+	wg.Def("w2", ppc.weatherRrd.path, "solar", "AVERAGE")
+	wg.CDef("wf2", "w2,10,/")
+	wg.Line(2.0, "wf2", colorStr(4), "SolRad")
+	wg.Def("w3", ppc.weatherRrd.path, "uv", "AVERAGE")
+	wg.Line(1.0, "w3", colorStr(5), "UV")
+	wg.Def("w4", ppc.weatherRrd.path, "rain", "AVERAGE")
+	wg.Area("w4", colorStr(0), "Rain")
+	wg.Def("w5", ppc.weatherRrd.path, "wind", "AVERAGE")
+	wg.CDef("wf5", "w5,2.23694,*")
+	wg.Line(1.0, "wf5", colorStr(7), "Wind")
+	wg.Def("w6", ppc.weatherRrd.path, "gust", "AVERAGE")
+	wg.CDef("wf6", "w6,2.23694,*")
+	wg.Line(1.0, "wf6", colorStr(3), "Gust")
+
+	fc := ppc.flowRrd.Creator()
+	fc.DS("flow", "GAUGE", "30", "0", "1000")
+	ppc.flowRrd.AddStandardRRAs()
+	fc.Create(*ppc.config.forceRrd) // fails if already exists
+
+	fg := ppc.flowRrd.grapher
+	fg.SetTitle("Flow")
+	fg.SetVLabel("GPM")
+	fg.SetLowerLimit(0.0)
+	fg.SetRightAxis(1, 0.0)
+	fg.SetRightAxisLabel("GPM")
+	fg.SetSize(640, 200) // Config?
+	fg.SetImageFormat("PNG")
+
+	fg.Def("g1", ppc.flowRrd.path, "flow", "AVERAGE")
+	fg.Area("g1", colorStr(18), "Flow")
+
+	ic := ppc.inputsRrd.Creator()
+	for _, r := range inputRoles {
+		ic.DS(r.role, "GAUGE", "30", "0", "1")
+	}
+	ppc.inputsRrd.AddStandardRRAs()
+	ic.Create(*ppc.config.forceRrd) // fails if already exists
+
+	ig := ppc.inputsRrd.grapher
+	ig.SetTitle("Digital Inputs")
+	ig.SetVLabel("Active")
+	ig.SetUpperLimit(5.0)
+	ig.SetRightAxis(1, 0.0)
+	ig.SetRightAxisLabel("Active")
+	ig.SetSize(640, 200) // Config?
+	ig.SetImageFormat("PNG")
+	for i, r := range inputRoles {
+		// Offset each role so the lines don't overlap
+		vname := fmt.Sprintf("i%d", i)
+		cname := fmt.Sprintf("if%d", i)
+		ig.Def(vname, ppc.inputsRrd.path, r.role, "AVERAGE")
+		ig.CDef(cname, fmt.Sprintf("%s,%d,+", vname, i+1))
+		ig.Line(2.0, cname, colorStr(i), strings.Title(r.role))
+	}
 	return nil
 }
 
 // UpdateRrd writes updates to RRD files and generates cached graphs
 func (ppc *PoolPumpController) UpdateRrd() {
-	update := fmt.Sprintf("N:%f:%f:%f:%f:%f:%f",
-		ppc.pumpTemp.Temperature(), 0.0, ppc.roofTemp.Temperature(),
-		0.0, ppc.runningTemp.Temperature(), ppc.config.cfg.Target)
+	air := "U" // unknown without a working air sensor
+	if temp, ok := ppc.airTemperature(); ok {
+		air = fmt.Sprintf("%f", temp)
+	}
+	solar := "U"
+	if value, ok := ppc.irradiance.Value(); ok {
+		solar = fmt.Sprintf("%f", value)
+	}
+	update := fmt.Sprintf("N:%f:%s:%f:%s:%f:%f",
+		ppc.pumpTemp.Temperature(), air, ppc.roofTemp.Temperature(),
+		solar, ppc.runningTemp.Temperature(), ppc.config.cfg.Target)
 	Debug("Updating TempRrd: %s", update)
 	err := ppc.tempRrd.Updater().Update(update)
 	if err != nil {
 		Error("Could not create PumpRrd: %s", err.Error())
 	}
 
-	solar := 0.01
+	update = fmt.Sprintf("N:%f:%f", rawTemperature(ppc.pumpTemp), rawTemperature(ppc.roofTemp))
+	Debug("Updating RawRrd: %s", update)
+	err = ppc.rawRrd.Updater().Update(update)
+	if err != nil {
+		Error("Could not update RawRrd: %s", err.Error())
+	}
+
+	valve := 0.01
 	if ppc.switches.solar.isOn() {
-		solar = 1.03
+		valve = 1.03
 	}
 	manual := 0.02
 	if ppc.switches.ManualState(ppc.config.cfg.RunTime) {
 		manual = 1.06
 	}
-	update = fmt.Sprintf("N:%d.001:%0.3f:%0.3f", ppc.switches.State(), solar, manual)
+	update = fmt.Sprintf("N:%d.001:%0.3f:%0.3f", ppc.switches.State(), valve, manual)
 	Debug("Updating PumpRrd: %s", update)
 	err = ppc.pumpRrd.Updater().Update(update)
 	if err != nil {
 		Error("Could not create PumpRrd: %s", err.Error())
 	}
+
+	update = fmt.Sprintf("N:%0.1f", ppc.energy.Power())
+	Debug("Updating EnergyRrd: %s", update)
+	err = ppc.energyRrd.Updater().Update(update)
+	if err != nil {
+		Error("Could not update EnergyRrd: %s", err.Error())
+	}
+
+	if ppc.returnTemp != nil {
+		update = fmt.Sprintf("N:%0.1f", ppc.heat.Watts())
+		Debug("Updating HeatRrd: %s", update)
+		err = ppc.heatRrd.Updater().Update(update)
+		if err != nil {
+			Error("Could not update HeatRrd: %s", err.Error())
+		}
+	}
+
+	if ppc.flowMeter != nil {
+		update = fmt.Sprintf("N:%0.2f", ppc.flowMeter.GPM())
+		Debug("Updating FlowRrd: %s", update)
+		err = ppc.flowRrd.Updater().Update(update)
+		if err != nil {
+			Error("Could not update FlowRrd: %s", err.Error())
+		}
+	}
+
+	if len(ppc.inputs.All()) > 0 {
+		update = "N:" + ppc.inputs.rrdValues()
+		Debug("Updating InputsRrd: %s", update)
+		err = ppc.inputsRrd.Updater().Update(update)
+		if err != nil {
+			Error("Could not update InputsRrd: %s", err.Error())
+		}
+	}
+
+	if ppc.config.station.Configured() {
+		update = "N:" + stationRrdValues(ppc.config.station.Last(time.Now()))
+		Debug("Updating WeatherRrd: %s", update)
+		err = ppc.weatherRrd.Updater().Update(update)
+		if err != nil {
+			Error("Could not update WeatherRrd: %s", err.Error())
+		}
+	}
 }
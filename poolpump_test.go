@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/brutella/hc/accessory"
+	"github.com/stretchr/testify/assert"
 )
 
 type FakeThermometer struct {
@@ -141,3 +142,40 @@ func TestRunPumpsIfNeeded(t *testing.T) {
 	})
 
 }
+
+func TestAirTemperature(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 20.0, 5.0, 0.0, OFF)
+	_, ok := trp.ppc.airTemperature()
+	assert.False(t, ok, "No air sensor configured")
+	defer func() { trp.ppc.config.cfg.FreezeProtect = false }()
+	trp.ppc.config.cfg.FreezeProtect = true
+	assert.False(t, trp.ppc.shouldFreezeProtect(), "Roof is above freezing")
+
+	air := &FakeThermometer{name: "air", temp: -2.0}
+	trp.ppc.airTemp = air
+	assert.True(t, trp.ppc.shouldFreezeProtect(), "Air is below freezing")
+	trp.ppc.config.cfg.FreezeProtect = false
+	assert.False(t, trp.ppc.shouldFreezeProtect(), "Not enabled")
+	trp.ppc.config.cfg.FreezeProtect = true
+	name, temp, _ := trp.ppc.freezeReference()
+	assert.Equal(t, "Air", name)
+	assert.Equal(t, -2.0, temp)
+	assert.True(t, trp.ppc.coldAir())
+
+	air.temp = 150.0
+	trp.ppc.CheckHealth()
+	assert.False(t, trp.ppc.airHealth.OK())
+	name, _, _ = trp.ppc.freezeReference()
+	assert.Equal(t, "Roof", name, "Falls back to the roof when the air sensor is unhealthy")
+	assert.False(t, trp.ppc.coldAir())
+
+	air.temp = 20.0
+	trp.ppc.CheckHealth()
+	assert.False(t, trp.ppc.shouldFreezeProtect())
+	assert.False(t, trp.ppc.coldAir())
+	trp.ppc.config.cfg.ColdAirTemp = 25.0
+	assert.True(t, trp.ppc.coldAir())
+	trp.ppc.config.cfg.ColdAirTemp = 0.0
+}
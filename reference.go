@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// referenceInterval is how often the reference resistor is measured
+	referenceInterval = time.Hour
+	// maxDriftSamples is the number of reference measurements kept for display
+	maxDriftSamples = 200
+	// maxDrift is the largest believable drift, anything more is a wiring problem
+	maxDrift = 0.2
+)
+
+// DriftSample is a single measurement of the reference resistor
+type DriftSample struct {
+	Time   time.Time
+	Adjust float64 // adjustment needed to read the reference resistor correctly
+	Factor float64 // Adjust relative to the baseline
+}
+
+// ReferenceChannel measures a precision resistor on a spare GPIO with the same discharge timing
+// as the thermometers.  Changes in the adjustment needed to read it correctly are capacitor and
+// temperature drift, which is corrected in every GpioThermometer.
+type ReferenceChannel struct {
+	mtx     sync.Mutex
+	therm   *GpioThermometer
+	factor  float64
+	history []DriftSample
+	running bool // a measurement is in progress
+}
+
+// NewReferenceChannel creates a ReferenceChannel for a resistor wired to the given pin
+func NewReferenceChannel(pin PiPin) *ReferenceChannel {
+	return &ReferenceChannel{
+		therm:  newGpioThermometer("Reference", mftr, pin),
+		factor: 1.0,
+	}
+}
+
+// Factor returns the current drift, as a multiplier for the thermometer adjustments
+func (rc *ReferenceChannel) Factor() float64 {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	return rc.factor
+}
+
+// History returns the recent drift measurements
+func (rc *ReferenceChannel) History() []DriftSample {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	return append([]DriftSample(nil), rc.history...)
+}
+
+// begin marks a measurement as started, it returns false if one is already running
+func (rc *ReferenceChannel) begin() bool {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	if rc.running {
+		return false
+	}
+	rc.running = true
+	return true
+}
+
+// end marks the measurement as finished
+func (rc *ReferenceChannel) end() {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	rc.running = false
+}
+
+// Running returns true while a measurement is in progress
+func (rc *ReferenceChannel) Running() bool {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	return rc.running
+}
+
+// Measure reads the reference resistor and updates the drift factor.  The first measurement
+// after the reference is configured becomes the baseline stored in cfg.
+func (rc *ReferenceChannel) Measure(cfg *PersistedConfig, now time.Time) error {
+	if cfg.ReferenceOhms <= 0.0 {
+		rc.mtx.Lock()
+		rc.factor = 1.0
+		rc.mtx.Unlock()
+		return nil
+	}
+	if err := rc.therm.Calibrate(cfg.ReferenceOhms); err != nil {
+		return fmt.Errorf("reference measurement failed: %w", err)
+	}
+	return rc.record(cfg, rc.therm.adjust, now)
+}
+
+// record updates the drift factor from the adjustment measured on the reference resistor
+func (rc *ReferenceChannel) record(cfg *PersistedConfig, adjust float64, now time.Time) error {
+	if cfg.ReferenceBaseline == 0.0 {
+		Log("Reference baseline set to %0.4f", adjust)
+		cfg.ReferenceBaseline = adjust
+	}
+	factor := adjust / cfg.ReferenceBaseline
+	if math.Abs(factor-1.0) > maxDrift {
+		return fmt.Errorf("reference drift(%0.3f) is implausible, check the reference resistor", factor)
+	}
+
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	Info("Reference drift: adjust(%0.4f) baseline(%0.4f) factor(%0.4f) change(%0.4f)",
+		adjust, cfg.ReferenceBaseline, factor, factor-rc.factor)
+	rc.factor = factor
+	rc.history = append(rc.history, DriftSample{Time: now, Adjust: adjust, Factor: factor})
+	if len(rc.history) > maxDriftSamples {
+		rc.history = rc.history[len(rc.history)-maxDriftSamples:]
+	}
+	return nil
+}
+
+// CheckReference starts measuring the reference resistor in the background, the discharge
+// timing takes too long to hold up the control loop.  The new drift is picked up through
+// Factor once the measurement is done.
+func (ppc *PoolPumpController) CheckReference() {
+	if !ppc.reference.begin() {
+		return
+	}
+	go func() {
+		defer ppc.reference.end()
+		ppc.measureReference()
+	}()
+}
+
+// measureReference measures the reference resistor, saving the baseline if it was just set
+func (ppc *PoolPumpController) measureReference() {
+	cfg := ppc.config.cfg
+	baseline := cfg.ReferenceBaseline
+	if err := ppc.reference.Measure(cfg, time.Now()); err != nil {
+		Error("%v", err)
+		return
+	}
+	if baseline != cfg.ReferenceBaseline {
+		if err := ppc.config.Save(); err != nil {
+			Error("Could not persist config: %v", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferenceChannel(t *testing.T) {
+	rc := NewReferenceChannel(&TestPin{sleepTime: 5 * time.Millisecond})
+	cfg := &PersistedConfig{}
+	now := time.Now()
+
+	t.Run("NotWired", func(t *testing.T) {
+		assert.NoError(t, rc.Measure(cfg, now))
+		assert.Equal(t, 1.0, rc.Factor())
+		assert.Empty(t, rc.History())
+	})
+
+	t.Run("Baseline", func(t *testing.T) {
+		cfg.ReferenceOhms = 10000.0
+		assert.NoError(t, rc.record(cfg, 2.0, now))
+		assert.Equal(t, 2.0, cfg.ReferenceBaseline)
+		assert.Equal(t, 1.0, rc.Factor())
+		assert.Len(t, rc.History(), 1)
+	})
+
+	t.Run("Drift", func(t *testing.T) {
+		assert.NoError(t, rc.record(cfg, 1.9, now.Add(time.Hour)))
+		assert.InDelta(t, 0.95, rc.Factor(), 0.0001)
+		history := rc.History()
+		assert.Len(t, history, 2)
+		assert.Equal(t, DriftSample{Time: now.Add(time.Hour), Adjust: 1.9, Factor: 0.95}, history[1])
+	})
+
+	t.Run("Implausible", func(t *testing.T) {
+		assert.Error(t, rc.record(cfg, 1.5, now.Add(2*time.Hour)))
+		assert.InDelta(t, 0.95, rc.Factor(), 0.0001, "Implausible measurements are ignored")
+		assert.Len(t, rc.History(), 2)
+	})
+
+	t.Run("Measure", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping timing test")
+		}
+		cfg := &PersistedConfig{ReferenceOhms: 10000.0}
+		if err := rc.Measure(cfg, now); err != nil {
+			t.Skipf("Timing too noisy on this machine: %v", err)
+		}
+		assert.InDelta(t, 0.2, cfg.ReferenceBaseline, 0.05, "1ms expected, ~5ms measured")
+	})
+}
+
+func TestReferenceAdjustments(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	g := newGpioThermometer("Pump", mftr, &TestPin{})
+	trp.ppc.pumpTemp = g
+	trp.ppc.config.cfg.PumpAdjustment = 2.0
+	trp.ppc.reference.factor = 0.9
+
+	trp.ppc.SyncAdjustments()
+	assert.InDelta(t, 1.8, g.adjust, 0.0001)
+
+	g.adjust = 1.89
+	trp.ppc.PersistCalibration()
+	assert.InDelta(t, 2.1, trp.ppc.config.cfg.PumpAdjustment, 0.0001, "Stored without drift")
+	trp.ppc.config.cfg.PumpAdjustment = defaultPumpAdjustment
+	trp.ppc.config.Save()
+}
+
+func TestCheckReference(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	cfg := trp.ppc.config.cfg
+	defer func() {
+		cfg.ReferenceOhms, cfg.ReferenceBaseline = 0.0, 0.0
+		trp.ppc.config.Save()
+	}()
+	cfg.ReferenceOhms = 10000.0
+	sleep := 20 * time.Millisecond
+	trp.ppc.reference = NewReferenceChannel(&TestPin{sleepTime: sleep})
+
+	start := time.Now()
+	trp.ppc.CheckReference()
+	assert.True(t, time.Since(start) < sleep, "The control loop isn't held up")
+	assert.True(t, trp.ppc.reference.Running())
+	trp.ppc.CheckReference() // one measurement at a time
+	assert.Eventually(t, func() bool { return !trp.ppc.reference.Running() }, 10*time.Second, 10*time.Millisecond)
+}
@@ -16,6 +16,8 @@ type Relay struct {
 	stopTime  time.Time
 	accessory *accessory.Switch
 	enabled   bool
+	on        bool
+	usage     func(start, stop time.Time) // receives each period the relay was on
 }
 
 // SolarValve controls two relays at the same time.
@@ -88,11 +90,26 @@ func (r *Relay) String() string {
 		r.Name(), r.pin, timeStr(r.startTime), timeStr(r.stopTime), r.accessory)
 }
 
+// OnUsage registers a callback that receives each period the relay was on.  A period ends
+// when the relay is turned off, or turned on again while already on.
+func (r *Relay) OnUsage(usage func(start, stop time.Time)) {
+	r.usage = usage
+}
+
+func (r *Relay) reportUsage(now time.Time) {
+	if r.on && r.usage != nil {
+		r.usage(r.startTime, now)
+	}
+}
+
 // TurnOn flips the output to HIGH voltage (>1V)
 func (r *Relay) TurnOn() {
 	Trace("TurnOn %s", r.name)
+	now := time.Now()
+	r.reportUsage(now)
 	r.pin.Output(High)
-	r.startTime = time.Now()
+	r.on = true
+	r.startTime = now
 	if r.accessory != nil {
 		r.accessory.Switch.On.SetValue(true)
 	}
@@ -101,8 +118,11 @@ func (r *Relay) TurnOn() {
 // TurnOff flips the output to LOW voltage (<1V)
 func (r *Relay) TurnOff() {
 	Trace("TurnOff %s", r.name)
+	now := time.Now()
+	r.reportUsage(now)
 	r.pin.Output(Low)
-	r.stopTime = time.Now()
+	r.on = false
+	r.stopTime = now
 	if r.accessory != nil {
 		r.accessory.Switch.On.SetValue(false)
 	}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+	"github.com/brutella/hc/characteristic"
+	"github.com/brutella/hc/service"
+)
+
+const (
+	// defaultRemoteStale is how long a pushed reading is used, wireless probes sleep between
+	// readings to save their batteries
+	defaultRemoteStale = 10 * time.Minute
+	// remoteMaxSkew is how far in the future a reading's timestamp can be
+	remoteMaxSkew = time.Minute
+	// lowBattery is the battery percentage reported as low to HomeKit
+	lowBattery = 20.0
+)
+
+// RemoteReading is a reading pushed by a networked sensor
+type RemoteReading struct {
+	ID        string   `json:"id"`
+	Value     float64  `json:"value"`               // degrees celsius
+	Timestamp int64    `json:"timestamp,omitempty"` // unix seconds, 0 uses the time received
+	Battery   *float64 `json:"battery,omitempty"`   // percent
+}
+
+// RemoteThermometer is a Thermometer whose readings are pushed over the network, ex. by a
+// floating wireless probe.  Readings older than the staleness timeout fail to update.
+type RemoteThermometer struct {
+	name      string
+	id        string
+	stale     time.Duration
+	mtx       sync.Mutex
+	value     float64
+	updated   time.Time
+	battery   float64 // percent, negative if never reported
+	accessory *accessory.Thermometer
+	power     *service.BatteryService
+}
+
+// NewRemoteThermometer creates a RemoteThermometer for the sensor id, stale of 0 uses 10 minutes
+func NewRemoteThermometer(name, manufacturer, id string, stale time.Duration) *RemoteThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -20.0, 100.0, 1.0)
+	power := service.NewBatteryService()
+	power.ChargingState.SetValue(characteristic.ChargingStateNotChargeable)
+	acc.AddService(power.Service)
+	if stale <= 0 {
+		stale = defaultRemoteStale
+	}
+	return &RemoteThermometer{
+		name:      name,
+		id:        id,
+		stale:     stale,
+		battery:   -1.0,
+		accessory: acc,
+		power:     power,
+	}
+}
+
+// ID returns the id the sensor reports with
+func (t *RemoteThermometer) ID() string {
+	return t.id
+}
+
+// Name returns the name of the RemoteThermometer
+func (t *RemoteThermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory related to the RemoteThermometer
+func (t *RemoteThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate is not supported, the probe reports temperatures directly
+func (t *RemoteThermometer) Calibrate(a float64) error {
+	return errors.New("not supported")
+}
+
+// Temperature returns the last temperature pushed to the RemoteThermometer
+func (t *RemoteThermometer) Temperature() float64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.value
+}
+
+// Battery returns the last battery percentage reported, false if the sensor never sent one
+func (t *RemoteThermometer) Battery() (float64, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.battery, t.battery >= 0.0
+}
+
+// Updated returns the time of the last reading
+func (t *RemoteThermometer) Updated() time.Time {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.updated
+}
+
+// Push records a reading from the sensor
+func (t *RemoteThermometer) Push(r RemoteReading, now time.Time) error {
+	ts := now
+	if r.Timestamp != 0 {
+		ts = time.Unix(r.Timestamp, 0)
+	}
+	if ts.After(now.Add(remoteMaxSkew)) {
+		return fmt.Errorf("timestamp %s is in the future", ts.Format(time.RFC3339))
+	}
+	if r.Value < -40.0 || r.Value > 125.0 {
+		return fmt.Errorf("temperature %0.1f is out of range", r.Value)
+	}
+	if r.Battery != nil && (*r.Battery < 0.0 || *r.Battery > 100.0) {
+		return fmt.Errorf("battery %0.0f%% is out of range", *r.Battery)
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if ts.Before(t.updated) {
+		return fmt.Errorf("reading from %s is older than the last one", ts.Format(time.RFC3339))
+	}
+	t.value = r.Value
+	t.updated = ts
+	t.accessory.TempSensor.CurrentTemperature.SetValue(r.Value)
+	if r.Battery != nil {
+		t.battery = *r.Battery
+		t.power.BatteryLevel.SetValue(int(*r.Battery))
+		if t.battery < lowBattery {
+			t.power.StatusLowBattery.SetValue(characteristic.StatusLowBatteryBatteryLevelLow)
+		} else {
+			t.power.StatusLowBattery.SetValue(characteristic.StatusLowBatteryBatteryLevelNormal)
+		}
+	}
+	return nil
+}
+
+// Update fails if there is no recent reading
+func (t *RemoteThermometer) Update() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.updated.IsZero() {
+		return fmt.Errorf("%s thermometer(%s) has not reported", t.name, t.id)
+	}
+	if age := time.Since(t.updated); age > t.stale {
+		return fmt.Errorf("%s thermometer(%s) last reported %s ago", t.name, t.id, age.Round(time.Second))
+	}
+	return nil
+}
+
+// RemoteSensors holds the RemoteThermometers by the id they report with
+type RemoteSensors struct {
+	mtx     sync.Mutex
+	sensors map[string]*RemoteThermometer
+}
+
+// NewRemoteSensors creates an empty RemoteSensors
+func NewRemoteSensors() *RemoteSensors {
+	return &RemoteSensors{sensors: map[string]*RemoteThermometer{}}
+}
+
+// Add registers a RemoteThermometer
+func (rs *RemoteSensors) Add(t *RemoteThermometer) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	rs.sensors[t.ID()] = t
+}
+
+// Get returns the RemoteThermometer for an id
+func (rs *RemoteSensors) Get(id string) (*RemoteThermometer, bool) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	t, ok := rs.sensors[id]
+	return t, ok
+}
+
+// All returns the RemoteThermometers
+func (rs *RemoteSensors) All() []*RemoteThermometer {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	out := []*RemoteThermometer{}
+	for _, t := range rs.sensors {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Push delivers a reading to the sensor it came from
+func (rs *RemoteSensors) Push(r RemoteReading, now time.Time) error {
+	t, ok := rs.Get(r.ID)
+	if !ok {
+		return fmt.Errorf("unknown sensor %q", r.ID)
+	}
+	return t.Push(r, now)
+}
+
+// FallbackThermometer uses a primary Thermometer while it updates successfully, and a
+// fallback when it doesn't.  A floating probe can be the pool temperature, with the water
+// at the pump used while it is out of touch.
+type FallbackThermometer struct {
+	mtx         sync.Mutex
+	name        string
+	primary     Thermometer
+	fallback    Thermometer
+	usePrimary  bool
+	accessory   *accessory.Thermometer
+	temperature float64
+}
+
+// NewFallbackThermometer creates a FallbackThermometer
+func NewFallbackThermometer(name, manufacturer string, primary, fallback Thermometer) *FallbackThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -20.0, 100.0, 1.0)
+	return &FallbackThermometer{
+		name:       name,
+		primary:    primary,
+		fallback:   fallback,
+		usePrimary: true,
+		accessory:  acc,
+	}
+}
+
+// Unwrap returns the primary Thermometer
+func (t *FallbackThermometer) Unwrap() Thermometer {
+	return t.primary
+}
+
+// Name returns the name of the FallbackThermometer
+func (t *FallbackThermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory
+func (t *FallbackThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate passes a resistance calibration on to the primary Thermometer
+func (t *FallbackThermometer) Calibrate(ohms float64) error {
+	return t.primary.Calibrate(ohms)
+}
+
+// Temperature returns the temperature of the Thermometer in use
+func (t *FallbackThermometer) Temperature() float64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.temperature
+}
+
+// UsingPrimary returns true while the primary Thermometer is in use
+func (t *FallbackThermometer) UsingPrimary() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.usePrimary
+}
+
+// Update updates the primary Thermometer, switching to the fallback if that fails
+func (t *FallbackThermometer) Update() error {
+	current := t.primary
+	err := t.primary.Update()
+	if err != nil {
+		current = t.fallback
+		if ferr := t.fallback.Update(); ferr != nil {
+			return fmt.Errorf("%v, fallback: %w", err, ferr)
+		}
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if usePrimary := err == nil; usePrimary != t.usePrimary {
+		t.usePrimary = usePrimary
+		Info("%s using %s: %v", t.name, current.Name(), err)
+	}
+	t.temperature = current.Temperature()
+	t.accessory.TempSensor.CurrentTemperature.SetValue(t.temperature)
+	return nil
+}
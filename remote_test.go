@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brutella/hc/characteristic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteThermometer(t *testing.T) {
+	now := time.Now()
+	r := NewRemoteThermometer("Float", mftr, "float", time.Minute)
+	assert.Error(t, r.Update(), "Never reported")
+
+	t.Run("Push", func(t *testing.T) {
+		battery := 87.0
+		assert.NoError(t, r.Push(RemoteReading{ID: "float", Value: 27.4, Battery: &battery}, now))
+		assert.NoError(t, r.Update())
+		assert.Equal(t, 27.4, r.Temperature())
+		level, ok := r.Battery()
+		assert.True(t, ok)
+		assert.Equal(t, 87.0, level)
+		assert.Equal(t, characteristic.StatusLowBatteryBatteryLevelNormal, r.power.StatusLowBattery.GetValue())
+	})
+
+	t.Run("Rejects Bad Readings", func(t *testing.T) {
+		battery := 120.0
+		assert.Error(t, r.Push(RemoteReading{Value: 27.0, Timestamp: now.Add(time.Hour).Unix()}, now))
+		assert.Error(t, r.Push(RemoteReading{Value: 150.0}, now))
+		assert.Error(t, r.Push(RemoteReading{Value: 27.0, Battery: &battery}, now))
+		assert.Error(t, r.Push(RemoteReading{Value: 27.0, Timestamp: now.Add(-time.Hour).Unix()}, now), "Older")
+		assert.Equal(t, 27.4, r.Temperature())
+	})
+
+	t.Run("Low Battery", func(t *testing.T) {
+		battery := 12.0
+		assert.NoError(t, r.Push(RemoteReading{Value: 27.5, Battery: &battery}, now.Add(time.Second)))
+		assert.Equal(t, characteristic.StatusLowBatteryBatteryLevelLow, r.power.StatusLowBattery.GetValue())
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		old := NewRemoteThermometer("Float", mftr, "float", time.Minute)
+		assert.NoError(t, old.Push(RemoteReading{Value: 27.0, Timestamp: now.Add(-2 * time.Minute).Unix()}, now))
+		assert.Error(t, old.Update())
+		_, ok := old.Battery()
+		assert.False(t, ok)
+	})
+}
+
+func TestRemoteSensors(t *testing.T) {
+	rs := NewRemoteSensors()
+	rs.Add(NewRemoteThermometer("Float", mftr, "float", 0))
+	assert.Len(t, rs.All(), 1)
+	assert.NoError(t, rs.Push(RemoteReading{ID: "float", Value: 26.0}, time.Now()))
+	assert.EqualError(t, rs.Push(RemoteReading{ID: "other", Value: 26.0}, time.Now()), `unknown sensor "other"`)
+	r, ok := rs.Get("float")
+	assert.True(t, ok)
+	assert.Equal(t, defaultRemoteStale, r.stale)
+	assert.Equal(t, 26.0, r.Temperature())
+}
+
+func TestFallbackThermometer(t *testing.T) {
+	primary := &FakeThermometer{name: "Float", temp: 27.0}
+	fallback := &FakeThermometer{name: "Pump", temp: 25.0}
+	f := NewFallbackThermometer("Pool", mftr, primary, fallback)
+	assert.NoError(t, f.Update())
+	assert.True(t, f.UsingPrimary())
+	assert.Equal(t, 27.0, f.Temperature())
+	assert.Equal(t, primary, f.Unwrap())
+
+	primary.updateError = errors.New("stale")
+	assert.NoError(t, f.Update())
+	assert.False(t, f.UsingPrimary())
+	assert.Equal(t, 25.0, f.Temperature())
+
+	fallback.updateError = errors.New("broken")
+	assert.Error(t, f.Update())
+
+	primary.updateError = nil
+	assert.NoError(t, f.Update())
+	assert.True(t, f.UsingPrimary())
+}
+
+func TestRemotePoolProbe(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := NewConfig(flag.NewFlagSet("TestRemotePoolProbe", flag.ContinueOnError), []string{"-data_dir", dir})
+	c.cfg.Sensors = map[string]*SensorConfig{
+		RolePool: {Type: SensorRemote, Device: "float", Stale: 300},
+	}
+	ppc := NewPoolPumpController(c)
+	assert.NotNil(t, ppc.poolTemp)
+	remote, ok := c.remotes.Get("float")
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Minute, remote.stale)
+	_, ok = ppc.runningTemp.(*FallbackThermometer)
+	assert.True(t, ok)
+
+	h := Handler{ppc: ppc}
+	post := func(body, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/sensor", strings.NewReader(body))
+		req.SetBasicAuth("admin", password)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, 401, post(`{"id": "float", "value": 27.4}`, "wrong").Code)
+	assert.Equal(t, 400, post(`{"id": "float", "value": `, defaultPin).Code)
+	assert.Equal(t, 400, post(`{"id": "float", "value": 200}`, defaultPin).Code)
+	assert.Equal(t, 404, post(`{"id": "other", "value": 27.4}`, defaultPin).Code)
+	w := post(`{"id": "float", "value": 27.4, "battery": 90}`, defaultPin)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 27.4, remote.Temperature())
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/sensor", nil)
+	req.SetBasicAuth("admin", defaultPin)
+	h.ServeHTTP(w, req)
+	assert.Equal(t, 405, w.Code)
+
+	sampler, ok := asSampledThermometer(ppc.poolTemp)
+	assert.True(t, ok)
+	sampler.Sample()
+	assert.NoError(t, ppc.runningTemp.Update())
+	water, ok := ppc.poolWater()
+	assert.True(t, ok, "Pool probe is trusted with the pumps off")
+	assert.Equal(t, 27.4, water)
+}
@@ -47,6 +47,12 @@ func (r *Rrd) Grapher() *rrd.Grapher {
 	return r.grapher
 }
 
+// Fetch reads the averaged values recorded between start and end.  The caller must call
+// FreeValues on the result.
+func (r *Rrd) Fetch(start, end time.Time, step time.Duration) (rrd.FetchResult, error) {
+	return rrd.Fetch(r.path, "AVERAGE", start, end, step)
+}
+
 // SaveGraph creates and saves the graph
 func (r *Rrd) SaveGraph(start, end time.Time) error {
 	_, err := r.grapher.SaveGraph(r.path, start, end)
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+)
+
+const (
+	// defaultSampleInterval is the time between samples of a thermometer
+	defaultSampleInterval = 10 * time.Second
+	// defaultSampleJitter is the most random time added to the interval, so probes sharing
+	// hardware don't line up
+	defaultSampleJitter = 2 * time.Second
+	// defaultSampleTimeout is the longest a sample can take before it is reported as failed
+	defaultSampleTimeout = 5 * time.Second
+)
+
+// Reading is a temperature published by a SampledThermometer
+type Reading struct {
+	Value float64
+	Time  time.Time
+}
+
+// SampledThermometer updates a Thermometer in its own goroutine and publishes timestamped
+// readings.  Temperature and Update never block on the hardware, so a slow or failing
+// probe can't stall the control loop or the web server.
+type SampledThermometer struct {
+	mtx         sync.Mutex
+	thermometer Thermometer
+	interval    time.Duration
+	jitter      time.Duration
+	timeout     time.Duration
+	last        Reading
+	err         error
+	busy        bool
+	stop        chan bool
+}
+
+// seconds converts a configured number of seconds to a Duration, 0 uses the default
+func seconds(s float64, def time.Duration) time.Duration {
+	if s <= 0.0 {
+		return def
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// NewSampledThermometer creates a SampledThermometer using the intervals in the SensorConfig,
+// which may be nil.  Call Start to begin sampling.
+func NewSampledThermometer(t Thermometer, sc *SensorConfig) *SampledThermometer {
+	if sc == nil {
+		sc = &SensorConfig{}
+	}
+	return &SampledThermometer{
+		thermometer: t,
+		interval:    seconds(sc.Interval, defaultSampleInterval),
+		jitter:      seconds(sc.Jitter, defaultSampleJitter),
+		timeout:     seconds(sc.Timeout, defaultSampleTimeout),
+		err:         fmt.Errorf("%s has not been sampled", t.Name()),
+		stop:        make(chan bool),
+	}
+}
+
+// Start takes a first sample, waiting up to the timeout, then continues sampling in the background
+func (s *SampledThermometer) Start() {
+	s.Sample()
+	go s.run()
+}
+
+// Stop ends sampling
+func (s *SampledThermometer) Stop() {
+	close(s.stop)
+}
+
+func (s *SampledThermometer) run() {
+	for {
+		wait := s.interval
+		if s.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(s.jitter)))
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(wait):
+			s.Sample()
+		}
+	}
+}
+
+// Sample updates the underlying Thermometer, waiting no longer than the timeout.  A sample
+// that times out keeps running and publishes its reading when it finishes, but no new sample
+// is started until it does.
+func (s *SampledThermometer) Sample() {
+	s.mtx.Lock()
+	if s.busy {
+		s.err = fmt.Errorf("%s is still busy with the previous sample", s.Name())
+		s.mtx.Unlock()
+		return
+	}
+	s.busy = true
+	s.mtx.Unlock()
+
+	done := make(chan bool, 1)
+	go func() {
+		err := s.thermometer.Update()
+		s.publish(err, time.Now())
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(s.timeout):
+		Info("%s sample timed out after %s", s.Name(), s.timeout)
+		s.mtx.Lock()
+		s.err = fmt.Errorf("%s sample timed out after %s", s.Name(), s.timeout)
+		s.mtx.Unlock()
+	}
+}
+
+func (s *SampledThermometer) publish(err error, now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.busy = false
+	s.err = err
+	if err == nil {
+		s.last = Reading{Value: s.thermometer.Temperature(), Time: now}
+	}
+}
+
+// Last returns the most recent successful reading, the Time is zero if there hasn't been one
+func (s *SampledThermometer) Last() Reading {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.last
+}
+
+// Unwrap returns the underlying Thermometer
+func (s *SampledThermometer) Unwrap() Thermometer {
+	return s.thermometer
+}
+
+// Name returns the name of the underlying Thermometer
+func (s *SampledThermometer) Name() string {
+	return s.thermometer.Name()
+}
+
+// Temperature returns the most recent reading
+func (s *SampledThermometer) Temperature() float64 {
+	return s.Last().Value
+}
+
+// Update returns the result of the most recent sample without blocking
+func (s *SampledThermometer) Update() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// Calibrate passes a resistance calibration on to the underlying Thermometer
+func (s *SampledThermometer) Calibrate(ohms float64) error {
+	return s.thermometer.Calibrate(ohms)
+}
+
+// Accessory returns the Apple HomeKit accessory of the underlying Thermometer
+func (s *SampledThermometer) Accessory() *accessory.Accessory {
+	return s.thermometer.Accessory()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowThermometer blocks in Update until released
+type slowThermometer struct {
+	FakeThermometer
+	release chan bool
+}
+
+func (t *slowThermometer) Update() error {
+	<-t.release
+	return t.updateError
+}
+
+func TestSampledThermometer(t *testing.T) {
+	t.Run("Publishes", func(t *testing.T) {
+		fake := &FakeThermometer{name: "fake", temp: 21.5}
+		s := NewSampledThermometer(fake, nil)
+		assert.Error(t, s.Update(), "Not sampled yet")
+		assert.True(t, s.Last().Time.IsZero())
+
+		before := time.Now()
+		s.Sample()
+		assert.NoError(t, s.Update())
+		assert.Equal(t, 21.5, s.Temperature())
+		assert.False(t, s.Last().Time.Before(before))
+
+		fake.temp = 30.0
+		fake.updateError = errors.New("broken")
+		s.Sample()
+		assert.Error(t, s.Update())
+		assert.Equal(t, 21.5, s.Temperature(), "Failed samples aren't published")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		slow := &slowThermometer{FakeThermometer{name: "slow", temp: 18.0}, make(chan bool)}
+		s := NewSampledThermometer(slow, &SensorConfig{Timeout: 0.05})
+		start := time.Now()
+		s.Sample()
+		assert.True(t, time.Since(start) < time.Second, "Sample shouldn't block on the probe")
+		assert.Error(t, s.Update())
+
+		s.Sample()
+		assert.Contains(t, s.Update().Error(), "busy")
+
+		slow.release <- true
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, s.Update(), "Late readings are still published")
+		assert.Equal(t, 18.0, s.Temperature())
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		fake := &FakeThermometer{name: "fake", temp: 10.0}
+		s := NewSampledThermometer(fake, &SensorConfig{Interval: 0.01, Jitter: 0.005})
+		s.Start()
+		defer s.Stop()
+		assert.Equal(t, 10.0, s.Temperature(), "Start takes the first sample")
+		first := s.Last().Time
+		fake.temp = 12.0
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, 12.0, s.Temperature())
+		assert.True(t, s.Last().Time.After(first))
+	})
+
+	t.Run("Unwrap", func(t *testing.T) {
+		g := newGpioThermometer("Test", mftr, &TestPin{})
+		found, ok := asGpioThermometer(NewCalibratedThermometer(NewSampledThermometer(g, nil), mftr, nil))
+		assert.True(t, ok)
+		assert.Equal(t, g, found)
+	})
+}
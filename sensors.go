@@ -0,0 +1,209 @@
+package main
+
+import "fmt"
+
+const (
+	// SensorGpio is a thermistor timed with a capacitor on a GPIO (the default)
+	SensorGpio = "gpio"
+	// SensorDS18B20 is a DS18B20 1-Wire thermometer
+	SensorDS18B20 = "ds18b20"
+	// SensorMCP3008 is a thermistor divider read through an SPI MCP3008 ADC
+	SensorMCP3008 = "mcp3008"
+	// SensorADS1115 is a thermistor divider read through an I2C ADS1115 ADC
+	SensorADS1115 = "ads1115"
+	// SensorBME280 is a Bosch BME280 (or BMP280) environmental sensor on I2C
+	SensorBME280 = "bme280"
+	// SensorNetwork is a temperature polled from a URL returning JSON
+	SensorNetwork = "network"
+	// SensorRemote is a wireless probe pushing its readings to /sensor
+	SensorRemote = "remote"
+	// SensorStation is the outdoor temperature uploaded by the local weather station
+	SensorStation = "station"
+	// SensorComposite combines several redundant sensors
+	SensorComposite = "composite"
+
+	// RolePump is the thermometer near the pump, measuring the pool water
+	RolePump = "pump"
+	// RoleRoof is the thermometer on the roof next to the solar panels
+	RoleRoof = "roof"
+	// RoleAir is the thermometer measuring the air temperature
+	RoleAir = "air"
+	// RoleReturn is the thermometer on the line returning from the solar panels
+	RoleReturn = "return"
+	// RolePool is a thermometer in the pool itself, ex. a floating wireless probe
+	RolePool = "pool"
+)
+
+// SensorConfig describes the thermometer used for a particular role (pump, roof, air, ...)
+type SensorConfig struct {
+	Type       string  // SensorGpio, SensorDS18B20, SensorMCP3008, SensorADS1115, SensorBME280, ...
+	Gpio       uint8   // GPIO for SensorGpio, 0 uses the default for the role (none for air, pool, or redundant members)
+	Device     string  // 1-Wire device id for SensorDS18B20 (ex. 28-0316a2795eff), sensor id for SensorRemote
+	Bus        string  // SPI or I2C bus for the ADC and BME280 sensors, empty uses the first one
+	Address    uint16  // I2C address, 0 uses 0x48 for SensorADS1115 and 0x76 for SensorBME280
+	Channel    int     // ADC channel the divider is wired to
+	SeriesOhms float64 // fixed resistor in the divider, 0 uses 10k
+	Vref       float64 // supply voltage of the divider for SensorADS1115, 0 uses 3.3v
+	Interval   float64 // seconds between samples, 0 uses 10
+	Jitter     float64 // most seconds randomly added to the interval, 0 uses 2
+	Timeout    float64 // seconds before a sample is reported as failed, 0 uses 5
+	URL        string  // address polled by SensorNetwork
+	Field      string  // dotted path to the temperature in the SensorNetwork JSON, empty uses temperature
+	Fahrenheit bool    // the SensorNetwork temperature is in fahrenheit
+	Stale      float64 // seconds a SensorRemote reading is used, 0 uses 600
+
+	Thermistor *ThermistorConfig // probe curve for the thermistor sensors, nil uses the legacy curve
+	Filter     *FilterConfig     // smoothing applied to the readings, nil uses none
+
+	Members   []*SensorConfig // sensors combined by SensorComposite
+	Policy    string          // PolicyMean, PolicyMedian (default), PolicyVote for SensorComposite
+	Tolerance float64         // degrees a member can differ before it disagrees, 0 uses 1
+}
+
+// sensorConfig returns the SensorConfig for a role, or nil if the role isn't configured
+func (c *Config) sensorConfig(role string) *SensorConfig {
+	if c.cfg.Sensors == nil {
+		return nil
+	}
+	return c.cfg.Sensors[role]
+}
+
+// NewThermometer creates the Thermometer configured for a role.  Roles without a
+// configuration use a GpioThermometer on defaultGpio.  A defaultGpio of 0 means the role has
+// no default pin, so a GpioThermometer needs one configured.
+func NewThermometer(c *Config, role, name string, defaultGpio uint8) (Thermometer, error) {
+	return newThermometer(c, c.sensorConfig(role), role, name, defaultGpio)
+}
+
+func newThermometer(c *Config, sc *SensorConfig, role, name string, defaultGpio uint8) (Thermometer, error) {
+	if sc == nil {
+		return newRoleGpioThermometer(role, name, defaultGpio, LegacyModel{})
+	}
+	model, err := NewThermistorModel(sc.Thermistor)
+	if err != nil {
+		Error("Bad thermistor for %s, using the legacy curve: %v", role, err)
+		model = LegacyModel{}
+	}
+	switch sc.Type {
+	case SensorComposite:
+		// Redundant probes each need their own pin, sharing the default would read it twice
+		memberGpio := defaultGpio
+		if len(sc.Members) > 1 {
+			memberGpio = 0
+		}
+		members := []Thermometer{}
+		pins := map[uint8]bool{}
+		for i, m := range sc.Members {
+			t, err := newThermometer(c, m, role, fmt.Sprintf("%s %d", name, i+1), memberGpio)
+			if err == nil {
+				err = claimPins(pins, t)
+			}
+			if err != nil {
+				Error("Leaving member %d out of the %s thermometer: %v", i+1, role, err)
+				continue
+			}
+			members = append(members, t)
+		}
+		if len(members) > 0 {
+			Info("Using %d sensors (%s) for the %s thermometer", len(members), sc.Policy, role)
+			return NewCompositeThermometer(name, mftr, sc.Policy, sc.Tolerance, members), nil
+		}
+		Error("Composite sensor for %s has no members, using GPIO", role)
+	case SensorDS18B20:
+		Info("Using DS18B20(%s) for the %s thermometer", sc.Device, role)
+		return NewDS18B20Thermometer(name, mftr, *c.w1Directory, sc.Device), nil
+	case SensorBME280:
+		c, err := openBME280(sc)
+		if err == nil {
+			Info("Using BME280 for the %s thermometer", role)
+			return NewBME280Thermometer(name, mftr, c), nil
+		}
+		Error("Could not open BME280 for %s, using GPIO: %v", role, err)
+	case SensorNetwork:
+		Info("Using %s for the %s thermometer", sc.URL, role)
+		return NewNetworkThermometer(name, mftr, sc.URL, sc.Field, sc.Fahrenheit), nil
+	case SensorRemote:
+		Info("Using remote sensor %q for the %s thermometer", sc.Device, role)
+		t := NewRemoteThermometer(name, mftr, sc.Device, seconds(sc.Stale, defaultRemoteStale))
+		c.remotes.Add(t)
+		return t, nil
+	case SensorStation:
+		Info("Using the weather station for the %s thermometer", role)
+		return NewStationThermometer(name, mftr, c.station), nil
+	case SensorMCP3008, SensorADS1115:
+		adc, err := openADC(sc)
+		if err == nil {
+			Info("Using %s channel %d for the %s thermometer", sc.Type, sc.Channel, role)
+			t := NewADCThermometer(name, mftr, adc, sc.Channel, sc.SeriesOhms)
+			t.SetModel(model)
+			return t, nil
+		}
+		Error("Could not open %s for %s, using GPIO: %v", sc.Type, role, err)
+	case SensorGpio, "":
+	default:
+		Error("Unknown sensor type %q for %s, using GPIO", sc.Type, role)
+	}
+	gpio := defaultGpio
+	if sc.Gpio != 0 {
+		gpio = sc.Gpio
+	}
+	return newRoleGpioThermometer(role, name, gpio, model)
+}
+
+// claimPins records the GPIOs read by a composite member, it returns an error if another
+// member already reads one of them
+func claimPins(pins map[uint8]bool, t Thermometer) error {
+	for _, g := range gpioThermometers(t) {
+		if pins[g.pin.Pin()] {
+			return fmt.Errorf("GPIO %d is already read by another member", g.pin.Pin())
+		}
+	}
+	for _, g := range gpioThermometers(t) {
+		pins[g.pin.Pin()] = true
+	}
+	return nil
+}
+
+// newRoleGpioThermometer creates a GpioThermometer for a role, which needs a GPIO
+func newRoleGpioThermometer(role, name string, gpio uint8, model ThermistorModel) (Thermometer, error) {
+	if gpio == 0 {
+		return nil, fmt.Errorf("no GPIO for the %s thermometer", role)
+	}
+	t := NewGpioThermometer(name, mftr, gpio)
+	t.SetModel(model)
+	return t, nil
+}
+
+// NewRoleSampler creates the configured Thermometer for a role, with its filter, and a
+// SampledThermometer to read it in the background.
+func NewRoleSampler(c *Config, role, name string, defaultGpio uint8) (*SampledThermometer, error) {
+	sc := c.sensorConfig(role)
+	t, err := NewThermometer(c, role, name, defaultGpio)
+	if err != nil {
+		return nil, err
+	}
+	var fc *FilterConfig
+	if sc != nil {
+		fc = sc.Filter
+	}
+	f, err := NewFilter(fc)
+	if err != nil {
+		Error("Bad filter for %s, using none: %v", role, err)
+		f, _ = NewFilter(nil)
+	}
+	return NewSampledThermometer(NewFilteredThermometer(t, f), sc), nil
+}
+
+// OptionalRoleSampler creates the sampled Thermometer for a role that has no default pin.  It
+// returns nil when the role isn't configured, or is configured without enough to use it.
+func OptionalRoleSampler(c *Config, role, name string) *SampledThermometer {
+	if c.sensorConfig(role) == nil {
+		return nil
+	}
+	s, err := NewRoleSampler(c, role, name, 0)
+	if err != nil {
+		Error("Not using a %s thermometer: %v", role, err)
+		return nil
+	}
+	return s
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	qrcode "github.com/skip2/go-qrcode"
@@ -42,6 +45,7 @@ type Server struct {
 	host    HostType
 	handler *Handler
 	server  http.Server
+	weather *http.Server // plain HTTP for weather station uploads, nil unless started
 	done    chan bool
 }
 
@@ -80,11 +84,37 @@ func (s *Server) Start(cert, key string) {
 	Info("Starting HTTPS on %s:%d", s.host, s.port)
 }
 
+// StartWeather listens for weather station uploads over plain HTTP, which is all most
+// stations can do.  Only the upload paths are served on the port.
+func (s *Server) StartWeather(port int) {
+	if port <= 0 {
+		return
+	}
+	addr := fmt.Sprintf("%s:%d", s.host, port)
+	s.weather = &http.Server{
+		Addr:     addr,
+		Handler:  stationHandler{s.handler},
+		ErrorLog: NewLogger(),
+	}
+	go func() {
+		err := s.weather.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			Error("Error from weather station server: %s", err.Error())
+		}
+	}()
+	Info("Starting HTTP for weather stations on %s", addr)
+}
+
 // Stop takes down the server
 func (s *Server) Stop() {
 	interval := time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
+	if s.weather != nil {
+		if err := s.weather.Shutdown(ctx); err != nil {
+			Info("WeatherServerShutdown: %s", err.Error())
+		}
+	}
 	err := s.server.Shutdown(ctx)
 	if err != nil {
 		Info("HttpServerShutdown: %s", err.Error())
@@ -104,8 +134,32 @@ const (
 	PumpImage = 0
 	// TempImage is the temperature data graph
 	TempImage = 1
+	// EnergyImage is the power usage graph
+	EnergyImage = 2
+	// HeatImage is the solar heat gain graph
+	HeatImage = 3
+	// WeatherImage is the weather station graph
+	WeatherImage = 4
+	// InputsImage is the digital inputs graph
+	InputsImage = 5
+	// FlowImage is the flow meter graph
+	FlowImage = 6
 )
 
+// stationHandler only serves the weather station uploads
+type stationHandler struct {
+	h *Handler
+}
+
+func (s stationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case ecowittPath, "/data/report", wundergroundPath:
+		s.h.weatherHandler(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	Debug("Received: %s", r.URL)
@@ -125,6 +179,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "/temps":
 		h.graphHandler(w, r, TempImage)
 		return
+	case "/power":
+		h.graphHandler(w, r, EnergyImage)
+		return
+	case "/heat":
+		h.graphHandler(w, r, HeatImage)
+		return
+	case "/energy":
+		h.energyHandler(w, r)
+		return
 	case "/config":
 		h.configHandler(w, r)
 		return
@@ -134,6 +197,42 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "/calibrate":
 		h.calibrateHandler(w, r)
 		return
+	case "/calibratePoint":
+		h.calibratePointHandler(w, r)
+		return
+	case "/shadow":
+		h.shadowHandler(w, r)
+		return
+	case "/tuning":
+		h.tuningHandler(w, r)
+		return
+	case "/solarAck":
+		h.solarAckHandler(w, r)
+		return
+	case "/flowAck":
+		h.flowAckHandler(w, r)
+		return
+	case "/loadshed":
+		h.loadShedHandler(w, r)
+		return
+	case "/plan":
+		h.planHandler(w, r)
+		return
+	case "/status.json":
+		h.statusJSONHandler(w, r)
+		return
+	case "/sensor":
+		h.sensorHandler(w, r)
+		return
+	case "/weather":
+		h.graphHandler(w, r, WeatherImage)
+		return
+	case "/inputs":
+		h.graphHandler(w, r, InputsImage)
+		return
+	case "/flow":
+		h.graphHandler(w, r, FlowImage)
+		return
 	default:
 		http.Error(w, "Unknown request type", 404)
 	}
@@ -205,6 +304,21 @@ func (h *Handler) graphHandler(w http.ResponseWriter, r *http.Request, which int
 	} else if which == TempImage {
 		h.ppc.tempRrd.Grapher().SetSize(uint(width), uint(height))
 		_, graph, err = h.ppc.tempRrd.Grapher().Graph(start, end)
+	} else if which == EnergyImage {
+		h.ppc.energyRrd.Grapher().SetSize(uint(width), uint(height))
+		_, graph, err = h.ppc.energyRrd.Grapher().Graph(start, end)
+	} else if which == HeatImage {
+		h.ppc.heatRrd.Grapher().SetSize(uint(width), uint(height))
+		_, graph, err = h.ppc.heatRrd.Grapher().Graph(start, end)
+	} else if which == WeatherImage {
+		h.ppc.weatherRrd.Grapher().SetSize(uint(width), uint(height))
+		_, graph, err = h.ppc.weatherRrd.Grapher().Graph(start, end)
+	} else if which == InputsImage {
+		h.ppc.inputsRrd.Grapher().SetSize(uint(width), uint(height))
+		_, graph, err = h.ppc.inputsRrd.Grapher().Graph(start, end)
+	} else if which == FlowImage {
+		h.ppc.flowRrd.Grapher().SetSize(uint(width), uint(height))
+		_, graph, err = h.ppc.flowRrd.Grapher().Graph(start, end)
 	} else {
 		http.Error(w, "Unknown Graph", 404)
 		return
@@ -255,6 +369,10 @@ func nav() string {
 	out += "<table cellspacing=5><tr><td><a href=/>graphs</a></td><td>&nbsp;</td>\n"
 	out += "<td><a href=/pair>homekit</a></td><td>&nbsp;</td>\n"
 	out += "<td><a href=/calibrate>calibrate</a></td><td>&nbsp;</td>\n"
+	out += "<td><a href=/energy>energy</a></td><td>&nbsp;</td>\n"
+	out += "<td><a href=/shadow>shadow</a></td><td>&nbsp;</td>\n"
+	out += "<td><a href=/tuning>tuning</a></td><td>&nbsp;</td>\n"
+	out += "<td><a href=/plan>plan</a></td><td>&nbsp;</td>\n"
 	out += "<td><a href=/config>config</a></td></tr></table></font>\n"
 	return out
 }
@@ -284,7 +402,55 @@ func (h *Handler) rootHandler(w http.ResponseWriter, r *http.Request) {
 	html += "<td align=left nowrap><font face=helvetica color=#444444 size=-1>"
 	html += fmt.Sprintf("Target: %0.1f F<br>", toFarenheit(h.ppc.config.cfg.Target))
 	html += fmt.Sprintf("Pool: %0.1f F<br>", toFarenheit(h.ppc.runningTemp.Temperature()))
+	if trend := h.ppc.PoolTrend(); trend.Valid {
+		html += fmt.Sprintf("Trend: %s<br>", trend)
+	}
+	html += fmt.Sprintf("ETA: %s<br>", h.ppc.ETA(time.Now()))
+	if plan := h.ppc.Plan(time.Now()); plan != nil {
+		html += fmt.Sprintf("Plan: <a href=/plan>%s</a><br>", plan)
+	}
 	html += fmt.Sprintf("Roof: %0.1f F<br>", toFarenheit(h.ppc.roofTemp.Temperature()))
+	if h.ppc.airTemp != nil {
+		html += fmt.Sprintf("Air: %0.1f F<br>", toFarenheit(h.ppc.airTemp.Temperature()))
+	}
+	if h.ppc.returnTemp != nil {
+		html += fmt.Sprintf("Return: %0.1f F<br>", toFarenheit(h.ppc.returnTemp.Temperature()))
+	}
+	if value, ok := h.ppc.irradiance.Value(); ok {
+		html += fmt.Sprintf("Irradiance: %0.0f W/m&sup2;<br>", value)
+	}
+	if obs, ok := h.ppc.config.station.Last(time.Now()); ok && obs.Raining() {
+		html += fmt.Sprintf("Raining: %0.1f mm/h<br>", *obs.RainRate)
+	}
+	for _, t := range []Thermometer{h.ppc.pumpTemp, h.ppc.roofTemp} {
+		if f, ok := asFilteredThermometer(t); ok {
+			if _, none := f.filter.(*passFilter); !none {
+				html += fmt.Sprintf("%s Raw: %0.1f F<br>", t.Name(), toFarenheit(rawTemperature(t)))
+			}
+		}
+	}
+	for _, t := range []Thermometer{h.ppc.pumpTemp, h.ppc.roofTemp} {
+		if c, ok := asCompositeThermometer(t); ok {
+			if d := c.Disagreeing(); len(d) > 0 {
+				html += fmt.Sprintf("<font color=#ff7f0e>%s Disagreeing: %s</font><br>",
+					c.Name(), strings.Join(d, ", "))
+			}
+		}
+	}
+	if f, ok := h.ppc.runningTemp.(*FallbackThermometer); ok && !f.UsingPrimary() {
+		html += "<font color=#ff7f0e>Pool Probe offline, using the pump</font><br>"
+	}
+	for _, remote := range h.ppc.config.remotes.All() {
+		if battery, ok := remote.Battery(); ok && battery < lowBattery {
+			html += fmt.Sprintf("<font color=#ff7f0e>%s Battery: %0.0f%%</font><br>", remote.Name(), battery)
+		}
+	}
+	for _, sh := range []*SensorHealth{h.ppc.pumpHealth, h.ppc.roofHealth, h.ppc.airHealth,
+		h.ppc.returnHealth, h.ppc.poolHealth} {
+		if state, detail := sh.State(); state != HealthOK {
+			html += fmt.Sprintf("<font color=#d62728>%s Probe %s: %s</font><br>", sh.name, state, detail)
+		}
+	}
 	html += "</font></td></tr>\n"
 	html += indent(1) + "<tr><td colspan=2><br></td></tr>"
 	html += indent(1) + "<tr>"
@@ -292,12 +458,62 @@ func (h *Handler) rootHandler(w http.ResponseWriter, r *http.Request) {
 	html += "<td align=left nowrap><font face=helvetica color=#444444 size=-1>"
 	html += fmt.Sprintf("Pump: %s<br>", h.ppc.switches.State())
 	html += fmt.Sprintf("Solar: %s<br>", h.ppc.switches.solar.Status())
+	if watts := h.ppc.heat.Watts(); watts != 0.0 {
+		html += fmt.Sprintf("Heat Gain: %0.0f W<br>", watts)
+	}
+	if fault, reason := h.ppc.solarWatch.Fault(); fault {
+		html += "<font color=#d62728>Solar Fault: " + reason + "</font>" +
+			"<form action=/solarAck method=POST><input type=submit value=Acknowledge></form>"
+	}
+	if fault, reason := h.ppc.flowWatch.Fault(); fault {
+		html += "<font color=#d62728>Flow Fault: " + reason + "</font>" +
+			"<form action=/flowAck method=POST><input type=submit value=Acknowledge></form>"
+	} else if blocked, reason := h.ppc.flowWatch.Blocked(time.Now()); blocked {
+		html += "<font color=#d62728>Pump Held Off: " + reason + "</font><br>"
+	}
+	if h.ppc.loadShed.Active(time.Now(), h.ppc.config.cfg.LoadShedInput) {
+		html += "Load Shed: Active<br>"
+	}
+	if owed := h.ppc.loadShed.Owed(); owed > 0 {
+		html += fmt.Sprintf("Filtration Owed: %s<br>", owed.Round(time.Minute))
+	}
 	html += fmt.Sprintf("Mode: %s", modeStr)
 	html += "</font></td></tr>\n"
 	html += indent(1) + "<tr><td align=center><font size=-1 color=#aaaaaa>" +
 		"4=SolarMixing, 3=SolarHeating, 2=Cleaning, 1=PumpRunning, 0=Off, " +
 		"-1=Disabled</font></td><td></td></tr>\n"
 	html += "<tr><td colspan=2><br></td></tr>\n"
+	if h.ppc.flowMeter != nil {
+		gallons, turnovers := h.ppc.Turnover(time.Now())
+		html += indent(1) + "<tr><td>" + image("flow", 640, 200, scale) + "</td>"
+		html += "<td align=left nowrap><font face=helvetica color=#444444 size=-1>"
+		html += fmt.Sprintf("Flow: %0.1f GPM<br>Filtered: %0.0f gal", h.ppc.flowMeter.GPM(), gallons)
+		if turnovers > 0.0 {
+			html += fmt.Sprintf(" (%0.2f turnovers)", turnovers)
+		}
+		html += "</font></td></tr>\n"
+		html += "<tr><td colspan=2><br></td></tr>\n"
+	}
+	if inputs := h.ppc.inputs.All(); len(inputs) > 0 {
+		html += indent(1) + "<tr><td>" + image("inputs", 640, 200, scale) + "</td>"
+		html += "<td align=left nowrap><font face=helvetica color=#444444 size=-1>"
+		for _, in := range inputs {
+			html += in.String() + "<br>"
+		}
+		html += "</font></td></tr>\n"
+		html += "<tr><td colspan=2><br></td></tr>\n"
+	}
+	if h.ppc.config.station.Configured() {
+		html += indent(1) + "<tr><td>" + image("weather", 640, 200, scale) + "</td>"
+		html += "<td align=left nowrap><font face=helvetica color=#444444 size=-1>"
+		html += stationSummary(h.ppc.config.station.Last(time.Now()))
+		html += "</font></td></tr>\n"
+		html += "<tr><td colspan=2><br></td></tr>\n"
+	}
+	for _, a := range h.ppc.alerts.Recent(5) {
+		html += indent(1) + fmt.Sprintf("<tr><td align=left><font face=helvetica color=#444444 size=-1>"+
+			"%.19s %s: %s</font></td><td></td></tr>\n", a.Time.String(), a.Source, a.Message)
+	}
 	html += indent(1) + "<tr><td align=center>" +
 		fmt.Sprintf("Updated: %.19s", time.Now().String()) +
 		"</td><td></td></tr>\n"
@@ -319,8 +535,106 @@ func (h *Handler) calibrateHandler(w http.ResponseWriter, r *http.Request) {
 	html += "<tr><td align=right><font face=helvetica color=#444444 size=-1>Roof Resistor Value</td>"
 	html += "<td><input name=roof_res value=10000 size=5></font> ohms</td></tr>\n"
 	html += "<tr><td colspan=2 align=center><input type=submit name=submit value=Run Calibration></td></tr>\n"
-	html += "<tr><td colspan=2 align=center>" + nav() + "</td></tr>\n"
-	html += "</form></table></font></center></body></html>"
+	html += "</form></table><br>\n"
+	html += h.referenceCalibration()
+	html += h.driftHistory()
+	html += nav()
+	html += "</font></center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+// referenceCalibration shows the reference calibration of each probe, with forms to record
+// points, fit them, and roll back.
+func (h *Handler) referenceCalibration() string {
+	html := `<font face=helvetica color=#444444 size=-1><h3>Reference Calibration</h3>
+	Place each probe alongside a reference thermometer at several temperatures (ice bath,
+	pool, hot water) and record a point at each, then fit the calibration.</font><br>`
+	for _, role := range []string{RolePump, RoleRoof} {
+		ct, ok := asCalibratedThermometer(h.ppc.roleThermometer(role))
+		if !ok {
+			continue
+		}
+		pc := ct.Calibration()
+		html += "<table border=0 cellpadding=3>\n"
+		html += fmt.Sprintf("<tr><th colspan=3>%s Probe</th></tr>\n", ct.Name())
+		html += fmt.Sprintf("<tr><td align=right>Reading:</td><td colspan=2>%0.2f&deg;C raw, %0.2f&deg;C corrected</td></tr>\n",
+			ct.Raw(), ct.Temperature())
+		if pc != nil && pc.Gain != 0.0 {
+			html += fmt.Sprintf("<tr><td align=right>Fit:</td><td colspan=2>Gain(%0.4f) Offset(%0.3f) "+
+				"Residual(%0.3f&deg;C) on %.19s</td></tr>\n", pc.Gain, pc.Offset, pc.Residual, pc.Fitted.String())
+		}
+		if saved := h.ppc.config.probeCalibration(role); saved != nil {
+			html += "<tr><th>Time</th><th>Raw</th><th>Reference</th></tr>\n"
+			for _, p := range saved.Points {
+				html += fmt.Sprintf("<tr><td>%.19s</td><td>%0.2f&deg;C</td><td>%0.2f&deg;C</td></tr>\n",
+					p.Time.String(), p.Raw, p.Reference)
+			}
+		}
+		html += "<form action=/calibratePoint method=POST><input type=hidden name=role value=" + role + ">\n"
+		html += "<tr><td colspan=3 align=center><input name=reference size=5>&deg;C "
+		html += "<input type=submit name=action value=add> "
+		html += "<input type=submit name=action value=fit> "
+		html += "<input type=submit name=action value=clear> "
+		if pc != nil && pc.Previous != nil {
+			html += "<input type=submit name=action value=rollback>"
+		}
+		html += "</td></tr></form></table><br>\n"
+	}
+	return html
+}
+
+// driftHistory shows the recent measurements of the reference resistor
+func (h *Handler) driftHistory() string {
+	if h.ppc.config.cfg.ReferenceOhms <= 0.0 {
+		return ""
+	}
+	html := "<font face=helvetica color=#444444 size=-1><h3>Reference Drift</h3>\n"
+	html += fmt.Sprintf("Current correction: %0.4f<br>\n", h.ppc.reference.Factor())
+	html += "<table border=0 cellpadding=3>\n"
+	html += "<tr><th>Time</th><th>Adjustment</th><th>Factor</th></tr>\n"
+	history := h.ppc.reference.History()
+	for i := len(history) - 1; i >= 0 && i >= len(history)-24; i-- {
+		d := history[i]
+		html += fmt.Sprintf("<tr><td>%.19s</td><td>%0.4f</td><td>%0.4f</td></tr>\n",
+			d.Time.String(), d.Adjust, d.Factor)
+	}
+	html += "</table></font><br>\n"
+	return html
+}
+
+func (h *Handler) calibratePointHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Basic")
+	if !h.Authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	role := getFormValue(r, "role", "")
+	var err error
+	switch getFormValue(r, "action", "") {
+	case "add":
+		var ref float64
+		ref, err = strconv.ParseFloat(getFormValue(r, "reference", ""), 64)
+		if err == nil {
+			_, err = h.ppc.AddCalibrationPoint(role, ref)
+		}
+	case "fit":
+		_, err = h.ppc.FitCalibration(role)
+	case "clear":
+		err = h.ppc.ClearCalibrationPoints(role)
+	case "rollback":
+		err = h.ppc.RollbackCalibration(role)
+	default:
+		err = fmt.Errorf("unknown action")
+	}
+	html := "<html><head><title>Thermometer Calibration</title></head><body><center>"
+	if err != nil {
+		html += "<h2>Calibration failed</h2><br>(" + err.Error() + ")<p>Redirecting...."
+		h.setRefresh(w, &http.Request{RequestURI: "/calibrate"}, 10)
+	} else {
+		html += "<h2>Success</h2> Redirecting..."
+		h.setRefresh(w, &http.Request{RequestURI: "/calibrate"}, 2)
+	}
+	html += "</center></body></html>"
 	h.writeResponse(w, []byte(html), "text/html")
 }
 
@@ -366,13 +680,11 @@ func (h *Handler) runCalibrationHandler(w http.ResponseWriter, r *http.Request)
 			h.setRefresh(w, &success, 10)
 			h.ppc.PersistCalibration()
 			html += "<h2>Success</h2><br>"
-			p, ok := h.ppc.pumpTemp.(*GpioThermometer)
-			if ok {
-				html += fmt.Sprintf("<br>Pool Value: %0.3f", p.adjust)
+			for _, p := range gpioThermometers(h.ppc.pumpTemp) {
+				html += fmt.Sprintf("<br>%s Value: %0.3f", p.Name(), p.adjust)
 			}
-			p, ok = h.ppc.roofTemp.(*GpioThermometer)
-			if ok {
-				html += fmt.Sprintf("<br>Roof Value: %0.3f", p.adjust)
+			for _, p := range gpioThermometers(h.ppc.roofTemp) {
+				html += fmt.Sprintf("<br>%s Value: %0.3f", p.Name(), p.adjust)
 			}
 		} else {
 			html += "<p>Redirecting...."
@@ -482,6 +794,87 @@ func (h *Handler) processForm(r *http.Request, c *Config) {
 	if processFloatUpdate(r, "run_time", &c.cfg.RunTime) {
 		foundone = true
 	}
+	if processFloatUpdate(r, "solar_check", &c.cfg.SolarCheckMinutes) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "solar_change", &c.cfg.SolarMinChange) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "flow_grace", &c.cfg.FlowGraceSeconds) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "flow_retries", &c.cfg.FlowRetries) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "flow_backoff", &c.cfg.FlowRetryMinutes) {
+		foundone = true
+	}
+	if processBoolUpdate(r, "freeze_protect", &c.cfg.FreezeProtect) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "freeze_temp", &c.cfg.FreezeTemp) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "cold_air_temp", &c.cfg.ColdAirTemp) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "min_irradiance", &c.cfg.MinIrradiance) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "coast_minutes", &c.cfg.CoastMinutes) {
+		foundone = true
+	}
+	if processBoolUpdate(r, "loadshed_input", &c.cfg.LoadShedInput) {
+		foundone = true
+	}
+	if processBoolUpdate(r, "return_probe", &c.cfg.ReturnProbe) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "flow_gpm", &c.cfg.FlowGPM) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "pool_gallons", &c.cfg.PoolGallons) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "reference_ohms", &c.cfg.ReferenceOhms) {
+		c.cfg.ReferenceBaseline = 0.0
+		foundone = true
+	}
+	if processFloatUpdate(r, "pump_watts", &c.cfg.PumpWatts) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "sweep_watts", &c.cfg.SweepWatts) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "valve_watts", &c.cfg.ValveWatts) {
+		foundone = true
+	}
+	if processFloatUpdate(r, "kwh_cost", &c.cfg.CostPerKWh) {
+		foundone = true
+	}
+	// Only store shadow settings once they differ from the defaults
+	shadow := ShadowConfig{}
+	if c.cfg.Shadow != nil {
+		shadow = *c.cfg.Shadow
+	}
+	shadowChanged := false
+	if processBoolUpdate(r, "shadow_enabled", &shadow.Enabled) {
+		shadowChanged = true
+	}
+	if processFloatUpdate(r, "shadow_target", &shadow.Target) {
+		shadowChanged = true
+	}
+	if processFloatUpdate(r, "shadow_tolerance", &shadow.Tolerance) {
+		shadowChanged = true
+	}
+	if processFloatUpdate(r, "shadow_mindelta", &shadow.DeltaT) {
+		shadowChanged = true
+	}
+	if shadowChanged {
+		c.cfg.Shadow = &shadow
+		h.ppc.shadow.Reset()
+		foundone = true
+	}
 	if foundone {
 		c.Save()
 	}
@@ -530,16 +923,55 @@ func (h *Handler) configHandler(w http.ResponseWriter, r *http.Request) {
 	html += "<tr><th align=left>Temperature Sensor Adjustment:</th><td colspan=3></td></tr>\n"
 	html += h.configRow("Pump Tuning", "adj_pump", fmt.Sprintf("%0.2f", c.cfg.PumpAdjustment), "")
 	html += h.configRow("Roof Tuning", "adj_roof", fmt.Sprintf("%0.2f", c.cfg.RoofAdjustment), "")
+	html += h.configRow("Reference Resistor", "reference_ohms", fmt.Sprintf("%0.0f ohms", c.cfg.ReferenceOhms), "")
+	html += h.configBoolRow("Return Line Probe Wired (restart)", "return_probe", c.cfg.ReturnProbe)
 	html += "<tr><td colspan=3><br></td></tr>\n"
 
 	html += "<tr><th align=left>Solar Settings:</th><td colspan=3></td></tr>\n"
 	html += h.configRow("Target", "target", fmt.Sprintf("%0.2f&deg;C", c.cfg.Target), "")
 	html += h.configRow("Tolerance", "tolerance", fmt.Sprintf("%0.2f&deg;C", c.cfg.Tolerance), "")
 	html += h.configRow("MinDelta", "mindelta", fmt.Sprintf("%0.2f&deg;C", c.cfg.DeltaT), "")
+	html += h.configRow("Solar Flow Rate", "flow_gpm", fmt.Sprintf("%0.1f GPM", c.cfg.FlowGPM), "")
+	html += h.configRow("Pool Volume", "pool_gallons", fmt.Sprintf("%0.0f gallons", c.cfg.PoolGallons), "")
+	html += h.configRow("Min Irradiance", "min_irradiance",
+		fmt.Sprintf("%0.0f W/m&sup2;", minIrradiance(c.cfg)), "")
+	html += h.configRow("Coast In Period", "coast_minutes",
+		fmt.Sprintf("%0.0f minutes", coastMinutes(c.cfg)), "")
+	html += h.configRow("Solar Check Period", "solar_check",
+		fmt.Sprintf("%0.0f minutes", solarCheckPeriod(c.cfg).Minutes()), "")
+	html += h.configRow("Solar Min Change", "solar_change",
+		fmt.Sprintf("%0.2f&deg;C", solarMinChange(c.cfg)), "")
+	html += h.configRow("Flow Grace Period", "flow_grace",
+		fmt.Sprintf("%0.0f seconds", flowGrace(c.cfg).Seconds()), "")
+	html += h.configRow("Flow Retries", "flow_retries", fmt.Sprintf("%d", flowRetries(c.cfg)), "")
+	html += h.configRow("Flow Retry Backoff", "flow_backoff",
+		fmt.Sprintf("%0.0f minutes", flowBackoff(c.cfg, 1).Minutes()), "")
 
 	html += "<tr><td colspan=3><br></td></tr>\n"
 	html += h.configRow("Daily Run Frequency", "daily_freq", fmt.Sprintf("%0.2f Days", c.cfg.DailyFrequency), "")
 	html += h.configRow("Run period", "run_time", fmt.Sprintf("%0.2f hours", c.cfg.RunTime), "")
+	html += h.configBoolRow("Freeze Protection Enabled", "freeze_protect", c.cfg.FreezeProtect)
+	html += h.configRow("Freeze Protection", "freeze_temp", fmt.Sprintf("%0.2f&deg;C", freezeTemp(c.cfg)), "")
+	html += h.configRow("Cold Air Sweep", "cold_air_temp", fmt.Sprintf("%0.2f&deg;C", coldAirTemp(c.cfg)), "")
+	html += h.configBoolRow("Load Shed Contact Wired", "loadshed_input", c.cfg.LoadShedInput)
+
+	html += "<tr><td colspan=3><br></td></tr>\n"
+	html += "<tr><th align=left>Energy Settings:</th><td colspan=3></td></tr>\n"
+	html += h.configRow("Pump Power", "pump_watts", fmt.Sprintf("%0.0f W", h.ppc.energy.PumpWatts()), "")
+	html += h.configRow("Sweep Power", "sweep_watts", fmt.Sprintf("%0.0f W", h.ppc.energy.SweepWatts()), "")
+	html += h.configRow("Valve Motor Power", "valve_watts", fmt.Sprintf("%0.0f W", h.ppc.energy.ValveWatts()), "")
+	html += h.configRow("Electricity Cost", "kwh_cost", fmt.Sprintf("%0.3f per kWh", c.cfg.CostPerKWh), "")
+
+	shadow := c.cfg.Shadow
+	if shadow == nil {
+		shadow = &ShadowConfig{}
+	}
+	html += "<tr><td colspan=3><br></td></tr>\n"
+	html += "<tr><th align=left>Shadow Settings:</th><td colspan=3>(0 uses the live value)</td></tr>\n"
+	html += h.configBoolRow("Shadow Enabled", "shadow_enabled", shadow.Enabled)
+	html += h.configRow("Target", "shadow_target", fmt.Sprintf("%0.2f&deg;C", shadow.Target), "")
+	html += h.configRow("Tolerance", "shadow_tolerance", fmt.Sprintf("%0.2f&deg;C", shadow.Tolerance), "")
+	html += h.configRow("MinDelta", "shadow_mindelta", fmt.Sprintf("%0.2f&deg;C", shadow.DeltaT), "")
 
 	html += "<tr><td colspan=3><br></td></tr>\n"
 	html += "<tr><th align=left>Debug Settings:</th><td colspan=3></td></tr>\n"
@@ -555,3 +987,387 @@ func (h *Handler) configHandler(w http.ResponseWriter, r *http.Request) {
 
 	h.writeResponse(w, []byte(html), "text/html")
 }
+
+func hours(d time.Duration) string {
+	return fmt.Sprintf("%0.2f hours", d.Hours())
+}
+
+func (h *Handler) shadowHandler(w http.ResponseWriter, r *http.Request) {
+	h.setRefresh(w, r, 60)
+	live := h.ppc.config.cfg
+	sc := live.Shadow
+	if sc == nil {
+		sc = &ShadowConfig{}
+	}
+	candidate := sc.candidate(live)
+	report := h.ppc.shadow.Report()
+
+	html := "<html><head><title>Shadow Mode</title></head><body><center>"
+	html += "<font face=helvetica color=#444444 size=-1>\n"
+	if !sc.Enabled {
+		html += "<h3>Shadow mode is disabled, enable it on the <a href=/config>config</a> page.</h3>\n"
+	}
+	html += "<table border=0 cellpadding=3>\n"
+	html += "<tr><th></th><th>Live</th><th>Shadow</th></tr>\n"
+	html += fmt.Sprintf("<tr><td align=right>Target:</td><td>%0.2f&deg;C</td><td>%0.2f&deg;C</td></tr>\n",
+		live.Target, candidate.Target)
+	html += fmt.Sprintf("<tr><td align=right>Tolerance:</td><td>%0.2f&deg;C</td><td>%0.2f&deg;C</td></tr>\n",
+		live.Tolerance, candidate.Tolerance)
+	html += fmt.Sprintf("<tr><td align=right>MinDelta:</td><td>%0.2f&deg;C</td><td>%0.2f&deg;C</td></tr>\n",
+		live.DeltaT, candidate.DeltaT)
+	html += fmt.Sprintf("<tr><td align=right>State:</td><td>%s</td><td>%s</td></tr>\n",
+		report.Live, report.Shadow)
+	html += fmt.Sprintf("<tr><td align=right>Pump Runtime:</td><td>%s</td><td>%s</td></tr>\n",
+		hours(report.LiveRun), hours(report.ShadowRun))
+	html += fmt.Sprintf("<tr><td align=right>Solar Runtime:</td><td>%s</td><td>%s</td></tr>\n",
+		hours(report.LiveSolar), hours(report.ShadowSolar))
+	html += fmt.Sprintf("<tr><td colspan=3 align=center>Since %.19s</td></tr>\n", report.Since.String())
+	html += "</table><br>\n"
+
+	html += "<table border=0 cellpadding=3>\n"
+	html += "<tr><th>Time</th><th>Live</th><th>Shadow</th><th>Water</th><th>Roof</th></tr>\n"
+	for i := len(report.Divergences) - 1; i >= 0; i-- {
+		d := report.Divergences[i]
+		html += fmt.Sprintf("<tr><td>%.19s</td><td>%s</td><td>%s</td><td>%0.1f F</td><td>%0.1f F</td></tr>\n",
+			d.Time.String(), d.Live, d.Shadow, toFarenheit(d.Water), toFarenheit(d.Roof))
+	}
+	if len(report.Divergences) == 0 {
+		html += "<tr><td colspan=5 align=center>No divergences recorded</td></tr>\n"
+	}
+	html += "</table></font>\n"
+	html += nav()
+	html += "</center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+func (h *Handler) tuningHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := h.ppc.config.cfg
+	rec, err := h.ppc.advisor.Last()
+
+	apply := getFormValue(r, "apply", "") == "true"
+	refresh := getFormValue(r, "refresh", "") == "true"
+	if apply || refresh {
+		w.Header().Set("WWW-Authenticate", "Basic")
+		if !h.Authenticate(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST to change the tuning", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	html := "<html><head><title>Tuning Advisor</title></head><body><center>"
+	html += "<font face=helvetica color=#444444 size=-1>\n"
+	if apply {
+		if rec != nil {
+			Log("Applying tuning recommendation: DeltaT(%0.2f -> %0.2f) Tolerance(%0.2f -> %0.2f)",
+				cfg.DeltaT, rec.Best.DeltaT, cfg.Tolerance, rec.Best.Tolerance)
+			cfg.DeltaT = rec.Best.DeltaT
+			cfg.Tolerance = rec.Best.Tolerance
+			h.ppc.config.Save()
+			html += "<h3>Recommendation applied</h3>\n"
+		}
+	}
+	if refresh {
+		go h.ppc.advisor.Run(cfg)
+		html += "<h3>Analysis started, reload in a minute for the results.</h3>\n"
+	}
+	if err != nil {
+		html += "<h3>Last analysis failed: " + err.Error() + "</h3>\n"
+	}
+	if rec == nil {
+		html += "No analysis available yet.<br>\n"
+	} else {
+		html += fmt.Sprintf("Analyzed %d samples from %.19s to %.19s<br>\n",
+			rec.Samples, rec.From.String(), rec.To.String())
+		html += "<table border=0 cellpadding=3>\n"
+		html += "<tr><th></th><th>Current</th><th>Recommended</th></tr>\n"
+		html += fmt.Sprintf("<tr><td align=right>MinDelta:</td><td>%0.2f&deg;C</td><td>%0.2f&deg;C</td></tr>\n",
+			cfg.DeltaT, rec.Best.DeltaT)
+		html += fmt.Sprintf("<tr><td align=right>Tolerance:</td><td>%0.2f&deg;C</td><td>%0.2f&deg;C</td></tr>\n",
+			cfg.Tolerance, rec.Best.Tolerance)
+		html += fmt.Sprintf("<tr><td align=right>Pump Hours:</td><td>%0.1f</td><td>%0.1f</td></tr>\n",
+			rec.Current.PumpHours, rec.Best.PumpHours)
+		html += fmt.Sprintf("<tr><td align=right>In Band (&plusmn;%0.1f&deg;C):</td><td>%0.0f%%</td><td>%0.0f%%</td></tr>\n",
+			advisorBand, 100.0*rec.Current.InBand, 100.0*rec.Best.InBand)
+		html += "</table>\n"
+		html += "<form action=/tuning method=POST><input type=hidden name=apply value=true>" +
+			"<input type=submit value=\"Apply Recommendation\"></form>\n"
+
+		html += "<table border=0 cellpadding=3>\n"
+		html += "<tr><th>Roof - Water</th><th>Solar Hours</th><th>Heat Gain</th></tr>\n"
+		for _, b := range rec.Buckets {
+			html += fmt.Sprintf("<tr><td>%0.0f to %0.0f&deg;C</td><td>%0.1f</td><td>%0.2f&deg;C/h</td></tr>\n",
+				b.MinDiff, b.MaxDiff, b.Hours, b.Rate)
+		}
+		html += fmt.Sprintf("<tr><td>Pumps off</td><td></td><td>%0.2f&deg;C/h</td></tr>\n", rec.Passive)
+		html += "</table>\n"
+	}
+	html += "<form action=/tuning method=POST><input type=hidden name=refresh value=true>" +
+		"<input type=submit value=\"Run analysis now\"></form></font>\n"
+	html += nav()
+	html += "</center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+// planHandler shows the day-ahead plan for today and tomorrow with the forecast behind it
+func (h *Handler) planHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := h.ppc.config.cfg
+	now := time.Now()
+	html := "<html><head><title>Day-Ahead Plan</title></head><body><center>"
+	html += "<font face=helvetica color=#444444 size=-1>\n"
+	forecast, err := h.ppc.forecaster.Latest()
+	if err != nil {
+		html += "<h3>Last forecast update failed: " + err.Error() + "</h3>\n"
+	}
+	if forecast == nil {
+		html += "No forecast available.<br>\n"
+	} else {
+		html += fmt.Sprintf("Forecast from %s at %.19s<br>\n", forecast.Source, forecast.Fetched.String())
+	}
+	for _, day := range []time.Time{now, now.AddDate(0, 0, 1)} {
+		plan := makePlan(forecast, day, cfg, h.ppc.runningTemp.Temperature())
+		if plan == nil {
+			continue
+		}
+		html += fmt.Sprintf("<h3>%s: %s</h3>\n", plan.Day.Format("Monday Jan 2"), plan)
+		for _, reason := range plan.Reasons {
+			html += reason + "<br>\n"
+		}
+		html += fmt.Sprintf("High %0.1f F, Low %0.1f F, %dh of sun<br>\n",
+			toFarenheit(plan.High), toFarenheit(plan.Low), plan.SunnyHours)
+		html += "<table border=0 cellpadding=3>\n"
+		html += "<tr><th>Hour</th><th>Temperature</th><th>Clouds</th><th>Irradiance</th><th>Solar</th></tr>\n"
+		for _, hour := range plan.Hours {
+			solar := ""
+			if sunnyHour(cfg, hour) {
+				solar = "sun"
+			}
+			html += fmt.Sprintf("<tr><td>%s</td><td>%0.1f F</td><td>%0.0f%%</td><td>%0.0f W/m&sup2;</td>"+
+				"<td>%s</td></tr>\n", hour.Time.In(now.Location()).Format("15:04"),
+				toFarenheit(hour.Temperature), hour.CloudCover, hour.Irradiance, solar)
+		}
+		html += "</table>\n"
+	}
+	html += "</font>\n"
+	html += nav()
+	html += "</center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+func (h *Handler) solarAckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Basic")
+	if !h.Authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.ppc.solarWatch.Acknowledge()
+	h.setRefresh(w, &http.Request{RequestURI: "/"}, 2)
+	html := "<html><head><title>Solar Fault</title></head><body><center>"
+	html += "<h2>Solar fault acknowledged</h2> Redirecting...</center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+func (h *Handler) flowAckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Basic")
+	if !h.Authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.ppc.flowWatch.Acknowledge()
+	h.setRefresh(w, &http.Request{RequestURI: "/"}, 2)
+	html := "<html><head><title>Flow Fault</title></head><body><center>"
+	html += "<h2>Flow fault acknowledged</h2> Redirecting...</center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+func (h *Handler) energyHandler(w http.ResponseWriter, r *http.Request) {
+	scale := getscale(r)
+	h.setRefresh(w, r, 60)
+	now := time.Now()
+	reports := []EnergyReport{
+		h.ppc.energy.Report("Today", 1, now),
+		h.ppc.energy.Report("Week", 7, now),
+		h.ppc.energy.Report("Month", 30, now),
+	}
+
+	html := "<html><head><title>Energy Usage</title></head><body><center>"
+	html += image("power", 640, 200, scale) + "<br>\n"
+	html += "<font face=helvetica color=#444444 size=-1>\n"
+	html += fmt.Sprintf("Current Power: %0.0f W<br>\n", h.ppc.energy.Power())
+	html += "<table border=0 cellpadding=3>\n<tr><th></th>"
+	for _, report := range reports {
+		html += "<th>" + report.Name + "</th>"
+	}
+	html += "</tr>\n"
+	for _, cause := range reports[len(reports)-1].Causes() {
+		html += "<tr><td align=right>" + cause + ":</td>"
+		for _, report := range reports {
+			html += fmt.Sprintf("<td>%0.2f kWh</td>", report.KWh[cause])
+		}
+		html += "</tr>\n"
+	}
+	html += "<tr><td align=right>Total:</td>"
+	for _, report := range reports {
+		html += fmt.Sprintf("<td>%0.2f kWh</td>", report.Total)
+	}
+	html += "</tr>\n<tr><td align=right>Cost:</td>"
+	for _, report := range reports {
+		html += fmt.Sprintf("<td>%0.2f</td>", report.Cost)
+	}
+	html += "</tr>\n</table></font>\n"
+	if h.ppc.returnTemp != nil {
+		html += h.heatTable(now, scale)
+	}
+	html += nav()
+	html += "</center></body></html>"
+	h.writeResponse(w, []byte(html), "text/html")
+}
+
+// statusJSONHandler reports the state of the system as JSON
+func (h *Handler) statusJSONHandler(w http.ResponseWriter, r *http.Request) {
+	buf, err := json.MarshalIndent(h.ppc.StatusReport(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeResponse(w, buf, "application/json")
+}
+
+// sensorHandler accepts readings pushed by networked sensors.  POST a JSON RemoteReading, ex.
+// {"id": "float", "value": 27.4, "timestamp": 1625097600, "battery": 87}
+func (h *Handler) sensorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Basic")
+	if !h.Authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a reading", http.StatusMethodNotAllowed)
+		return
+	}
+	var reading RemoteReading
+	if err := json.NewDecoder(r.Body).Decode(&reading); err != nil {
+		http.Error(w, "Could not parse reading: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	remote, ok := h.ppc.config.remotes.Get(reading.ID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown sensor %q", reading.ID), http.StatusNotFound)
+		return
+	}
+	if err := remote.Push(reading, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	Debug("Reading from %s(%s): %0.2f", remote.Name(), reading.ID, reading.Value)
+	h.writeResponse(w, []byte("ok\n"), "text/plain")
+}
+
+// weatherHandler receives Ecowitt and Weather Underground uploads from the local weather station
+func (h *Handler) weatherHandler(w http.ResponseWriter, r *http.Request) {
+	protocol := ProtocolEcowitt
+	if r.URL.Path == wundergroundPath {
+		protocol = ProtocolWunderground
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Could not parse upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	station := h.ppc.config.station
+	if !station.Configured() {
+		http.Error(w, "No weather station configured", http.StatusNotFound)
+		return
+	}
+	if err := station.Accept(protocol, r.Form, time.Now()); err != nil {
+		Error("Rejected %s upload from %s: %v", protocol, r.RemoteAddr, err)
+		code := http.StatusBadRequest
+		if errors.Is(err, errStationCredentials) {
+			code = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	Debug("Weather station %s upload from %s", protocol, r.RemoteAddr)
+	h.writeResponse(w, []byte("success\n"), "text/plain")
+}
+
+// stationSummary describes the last weather station upload
+func stationSummary(obs Observation, ok bool) string {
+	if !ok {
+		return "<font color=#ff7f0e>Weather Station: no recent upload</font><br>"
+	}
+	html := ""
+	if obs.Temperature != nil {
+		html += fmt.Sprintf("Outdoor: %0.1f F<br>", toFarenheit(*obs.Temperature))
+	}
+	if obs.Humidity != nil {
+		html += fmt.Sprintf("Humidity: %0.0f%%<br>", *obs.Humidity)
+	}
+	if obs.SolarRadiation != nil {
+		html += fmt.Sprintf("Solar Radiation: %0.0f W/m&sup2;<br>", *obs.SolarRadiation)
+	}
+	if obs.UV != nil {
+		html += fmt.Sprintf("UV Index: %0.0f<br>", *obs.UV)
+	}
+	if obs.DailyRain != nil {
+		html += fmt.Sprintf("Rain Today: %0.1f mm<br>", *obs.DailyRain)
+	}
+	if obs.WindSpeed != nil {
+		html += fmt.Sprintf("Wind: %0.0f mph", *obs.WindSpeed/mpsPerMile)
+		if obs.WindGust != nil {
+			html += fmt.Sprintf(", gusting %0.0f", *obs.WindGust/mpsPerMile)
+		}
+		html += "<br>"
+	}
+	return html + fmt.Sprintf("Updated: %s", obs.Time.Local().Format("15:04:05"))
+}
+
+// heatTable shows the heat added by the solar panels, measured on the return line
+func (h *Handler) heatTable(now time.Time, scale string) string {
+	watts := h.ppc.heat.Watts()
+	html := "<br>" + image("heat", 640, 200, scale) + "<br>\n"
+	html += "<font face=helvetica color=#444444 size=-1>\n"
+	html += fmt.Sprintf("Current Heat Gain: %0.0f W (%0.0f BTU/h)<br>\n", watts, watts*btuPerWattHour)
+	reports := h.ppc.heat.Reports(now)
+	html += "<table border=0 cellpadding=3>\n<tr><th></th>"
+	for _, report := range reports {
+		html += "<th>" + report.Name + "</th>"
+	}
+	html += "</tr>\n<tr><td align=right>Heat Gain:</td>"
+	for _, report := range reports {
+		html += fmt.Sprintf("<td>%0.1f kWh</td>", report.KWh)
+	}
+	html += "</tr>\n<tr><td align=right></td>"
+	for _, report := range reports {
+		html += fmt.Sprintf("<td>%0.0f kBTU</td>", report.BTU()/1000.0)
+	}
+	html += "</tr>\n</table></font>\n"
+	return html
+}
+
+// loadShedHandler lets a home energy manager suspend discretionary pump activity.  POST
+// minutes=N to shed load for N minutes, minutes=0 cancels.
+func (h *Handler) loadShedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Basic")
+	if !h.Authenticate(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if value := getFormValue(r, "minutes", ""); value != "" {
+		minutes, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "Could not parse minutes: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.ppc.loadShed.Request(time.Duration(minutes*float64(time.Minute)), r.RemoteAddr)
+	}
+	wired := h.ppc.config.cfg.LoadShedInput
+	active := h.ppc.loadShed.Active(time.Now(), wired)
+	until := h.ppc.loadShed.Until()
+	status := fmt.Sprintf("active=%t contact=%t until=%s owed=%s\n", active,
+		wired && h.ppc.loadShed.Contact(), until.Format(time.RFC3339), h.ppc.loadShed.Owed())
+	h.writeResponse(w, []byte(status), "text/plain")
+}
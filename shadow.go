@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxDivergences is the number of divergence events kept for the shadow report
+	maxDivergences = 100
+	// maxShadowStep caps the time credited for a single evaluation, so a stalled loop
+	// doesn't credit hours of runtime to whichever state happened to be current.
+	maxShadowStep = time.Minute
+)
+
+// ShadowConfig holds the candidate settings that shadow mode evaluates alongside the
+// live configuration.  A zero value inherits the live setting.
+type ShadowConfig struct {
+	Enabled   bool
+	Target    float64
+	DeltaT    float64
+	Tolerance float64
+}
+
+// candidate returns a copy of the live configuration with the shadow settings applied.
+func (sc *ShadowConfig) candidate(live *PersistedConfig) *PersistedConfig {
+	c := *live
+	if sc.Target != 0.0 {
+		c.Target = sc.Target
+	}
+	if sc.DeltaT != 0.0 {
+		c.DeltaT = sc.DeltaT
+	}
+	if sc.Tolerance != 0.0 {
+		c.Tolerance = sc.Tolerance
+	}
+	return &c
+}
+
+// ShadowDivergence records a point where the shadow strategy would have chosen a different
+// State than the live controller.
+type ShadowDivergence struct {
+	Time   time.Time
+	Live   State
+	Shadow State
+	Water  float64
+	Roof   float64
+}
+
+// ShadowReport summarizes how the shadow strategy compares with the live one.
+type ShadowReport struct {
+	Since       time.Time
+	Live        State
+	Shadow      State
+	LiveRun     time.Duration
+	ShadowRun   time.Duration
+	LiveSolar   time.Duration
+	ShadowSolar time.Duration
+	Divergences []ShadowDivergence
+}
+
+// Shadow runs a candidate configuration against the same conditions as the live controller,
+// making its decisions the same way.  It never touches the relays, it only keeps track of
+// what it would have done.  It starts out from the live controller's state and filtration,
+// and keeps its own from then on.
+type Shadow struct {
+	mtx         sync.Mutex
+	state       State
+	since       time.Time
+	last        time.Time
+	startTime   time.Time
+	filtration  *Filtration // nil until the shadow has started out from the live controller
+	live        State
+	liveRun     time.Duration
+	shadowRun   time.Duration
+	liveSolar   time.Duration
+	shadowSolar time.Duration
+	diverged    bool
+	divergences []ShadowDivergence
+}
+
+// NewShadow creates a Shadow with no history
+func NewShadow() *Shadow {
+	s := Shadow{}
+	s.Reset()
+	return &s
+}
+
+// Reset clears the hypothetical state and the accumulated totals.
+func (s *Shadow) Reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.state = OFF
+	s.since = time.Now()
+	s.last = time.Time{}
+	s.startTime = time.Time{}
+	s.filtration = nil
+	s.liveRun = 0
+	s.shadowRun = 0
+	s.liveSolar = 0
+	s.shadowSolar = 0
+	s.diverged = false
+	s.divergences = nil
+}
+
+// Evaluate runs one tick of the shadow strategy on the live conditions.  The live State is
+// compared against the shadow's decision, divergences are recorded unless the live State was
+// set manually.
+func (s *Shadow) Evaluate(sc *ShadowConfig, live *PersistedConfig, liveState State, c *Conditions,
+	liveFiltration *Filtration, now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	cfg := sc.candidate(live)
+	if s.filtration == nil {
+		s.state = liveState
+		s.live = liveState
+		s.startTime = c.Started
+		s.filtration = liveFiltration.clone()
+	}
+	runtime := DurationFromHours(cfg.RunTime, 1.0)
+	own := *c
+	own.Manual = false
+	own.Started = s.startTime
+	own.Filtered = s.filtration.Account(now, s.state > OFF, runtime)
+	own.Completed = s.filtration.Completed()
+	own.Ran = s.filtration.Ran(now)
+	if _, deferring := filtrationWanted(cfg, &own, now); deferring {
+		s.filtration.Defer(now)
+	}
+	own.Deferred = s.filtration.Deferred(now)
+
+	next := decide(cfg, &own, s.state, now).State
+	if next > OFF && s.state <= OFF {
+		s.startTime = now
+	}
+
+	// The time since the last tick is credited to the states chosen then
+	if !s.last.IsZero() {
+		dt := now.Sub(s.last)
+		if dt > maxShadowStep {
+			dt = maxShadowStep
+		}
+		if s.live > OFF {
+			s.liveRun += dt
+		}
+		if s.live >= SOLAR {
+			s.liveSolar += dt
+		}
+		if s.state > OFF {
+			s.shadowRun += dt
+		}
+		if s.state >= SOLAR {
+			s.shadowSolar += dt
+		}
+	}
+	s.last = now
+	s.state = next
+	s.live = liveState
+
+	differs := liveState != next && !c.Manual
+	if differs && !s.diverged {
+		Debug("Shadow diverged: live(%s) shadow(%s) water(%0.1f) roof(%0.1f)",
+			liveState, next, c.Water, c.Roof)
+		s.divergences = append(s.divergences, ShadowDivergence{
+			Time:   now,
+			Live:   liveState,
+			Shadow: next,
+			Water:  c.Water,
+			Roof:   c.Roof,
+		})
+		if len(s.divergences) > maxDivergences {
+			s.divergences = s.divergences[len(s.divergences)-maxDivergences:]
+		}
+	}
+	s.diverged = differs
+}
+
+// Report returns a snapshot of the shadow comparison
+func (s *Shadow) Report() ShadowReport {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return ShadowReport{
+		Since:       s.since,
+		Live:        s.live,
+		Shadow:      s.state,
+		LiveRun:     s.liveRun,
+		ShadowRun:   s.shadowRun,
+		LiveSolar:   s.liveSolar,
+		ShadowSolar: s.shadowSolar,
+		Divergences: append([]ShadowDivergence(nil), s.divergences...),
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowCandidate(t *testing.T) {
+	live := &PersistedConfig{Target: 30.0, DeltaT: 12.0, Tolerance: 0.5}
+	sc := &ShadowConfig{Enabled: true, DeltaT: 8.0}
+	c := sc.candidate(live)
+	assert.Equal(t, 30.0, c.Target)
+	assert.Equal(t, 8.0, c.DeltaT)
+	assert.Equal(t, 0.5, c.Tolerance)
+	assert.Equal(t, 12.0, live.DeltaT, "live config should not be modified")
+}
+
+func TestShadowEvaluate(t *testing.T) {
+	live := &PersistedConfig{Target: 30.0, DeltaT: 12.0, Tolerance: 0.5,
+		DailyFrequency: 2, RunTime: 6}
+	sc := &ShadowConfig{Enabled: true, DeltaT: 8.0}
+	s := NewShadow()
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.Local)
+	filtered := NewFiltration(now) // don't trigger the daily run
+
+	// Roof is 10C above the water: warm enough for the shadow, not for live
+	c := &Conditions{Water: 25.0, Roof: 35.0, Healthy: true}
+	for i := 0; i < 13; i++ {
+		s.Evaluate(sc, live, OFF, c, filtered, now.Add(time.Duration(i)*5*time.Second))
+	}
+	r := s.Report()
+	assert.Equal(t, SOLAR, r.Shadow)
+	assert.Equal(t, OFF, r.Live)
+	assert.Equal(t, 1, len(r.Divergences), "Only the start of a divergence is recorded")
+	assert.Equal(t, time.Minute, r.ShadowRun)
+	assert.Equal(t, time.Minute, r.ShadowSolar)
+	assert.Equal(t, time.Duration(0), r.LiveRun)
+
+	t.Run("ManualIgnored", func(t *testing.T) {
+		s.Reset()
+		s.Evaluate(sc, live, PUMP, &Conditions{Water: 29.8, Roof: 30.0, Healthy: true, Manual: true},
+			filtered, now)
+		assert.Equal(t, 0, len(s.Report().Divergences))
+	})
+
+	t.Run("Converges", func(t *testing.T) {
+		s.Reset()
+		s.Evaluate(sc, live, SOLAR, &Conditions{Water: 25.0, Roof: 40.0, Healthy: true}, filtered, now)
+		assert.Equal(t, SOLAR, s.Report().Shadow)
+		assert.Equal(t, 0, len(s.Report().Divergences))
+	})
+}
+
+func TestShadowMatchesLive(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	cfg := trp.ppc.config.cfg
+	runTime, frequency := cfg.RunTime, cfg.DailyFrequency
+	defer func() { cfg.RunTime, cfg.DailyFrequency = runTime, frequency }()
+	cfg.RunTime = 1.0
+	cfg.DailyFrequency = 1.0
+	sc := &ShadowConfig{Enabled: true}
+
+	// Days in the past, so the live pump's start time never looks an hour old
+	y, m, d := time.Now().AddDate(0, 0, -3).Date()
+	dawn := time.Date(y, m, d, 4, 0, 0, 0, time.Local)
+	trp.ppc.filtration.completed = dawn.Add(-48 * time.Hour)
+	seen := map[State]bool{}
+	tick := func(now time.Time) {
+		trp.ppc.runPumps(now)
+		seen[trp.ppc.switches.State()] = true
+		trp.ppc.shadow.Evaluate(sc, cfg, trp.ppc.switches.State(), trp.ppc.conditions(now),
+			trp.ppc.filtration, now)
+	}
+
+	trp.setConditions(30.0, 29.8, 10.0, 10.0, OFF)
+	tick(dawn.Add(-5 * time.Hour))
+	for i := 0; i <= 70; i++ {
+		tick(dawn.Add(time.Duration(i) * time.Minute))
+	}
+	assert.True(t, seen[SWEEP], "Daily sweep")
+	assert.Equal(t, OFF, trp.ppc.switches.State(), "Sweep ran its time")
+
+	noon := dawn.Add(8 * time.Hour)
+	trp.roofTemp.temp = 50.0
+	trp.pumpTemp.temp = 25.0
+	for i := 0; i <= 30; i++ {
+		tick(noon.Add(time.Duration(i) * time.Minute))
+	}
+	assert.True(t, trp.ppc.switches.State() >= SOLAR, "Solar run")
+
+	r := trp.ppc.shadow.Report()
+	assert.Empty(t, r.Divergences)
+	assert.Equal(t, r.LiveRun, r.ShadowRun)
+	assert.Equal(t, r.LiveSolar, r.ShadowSolar)
+	assert.True(t, r.ShadowSolar > 0)
+}
+
+func TestShadowConfigForm(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	defer func() {
+		trp.ppc.config.cfg.Shadow = nil
+		trp.ppc.config.Save()
+	}()
+	trp.ppc.config.cfg.Shadow = nil
+	h := Handler{ppc: trp.ppc}
+
+	h.processForm(httptest.NewRequest("POST",
+		"/config?shadow_enabled=false&shadow_target=0.00&shadow_tolerance=0.00&shadow_mindelta=0.00", nil),
+		trp.ppc.config)
+	assert.Nil(t, trp.ppc.config.cfg.Shadow, "Nothing to store")
+
+	h.processForm(httptest.NewRequest("POST", "/config?shadow_enabled=true&shadow_mindelta=8.0", nil),
+		trp.ppc.config)
+	if assert.NotNil(t, trp.ppc.config.cfg.Shadow) {
+		assert.True(t, trp.ppc.config.cfg.Shadow.Enabled)
+		assert.Equal(t, 8.0, trp.ppc.config.cfg.Shadow.DeltaT)
+	}
+}
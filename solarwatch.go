@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSolarCheckMinutes = 45.0
+	defaultSolarMinChange    = 0.2
+)
+
+// SolarWatchdog compares the expected temperature response while the water is running
+// through the panels with what the pump probe measures.  When the water doesn't warm
+// (or cool at night) the valve or the panels are probably not doing their job, and solar
+// is put into a fault state until the fault is acknowledged.  The response is checked again
+// after every period for as long as solar stays on.
+type SolarWatchdog struct {
+	mtx        sync.Mutex
+	running    bool
+	start      time.Time
+	startWater float64
+	startRoof  float64
+	fault      bool
+	faultTime  time.Time
+	reason     string
+}
+
+// NewSolarWatchdog creates a SolarWatchdog without a fault
+func NewSolarWatchdog() *SolarWatchdog {
+	return &SolarWatchdog{}
+}
+
+func solarCheckPeriod(cfg *PersistedConfig) time.Duration {
+	minutes := cfg.SolarCheckMinutes
+	if minutes <= 0.0 {
+		minutes = defaultSolarCheckMinutes
+	}
+	return time.Duration(minutes * float64(time.Minute))
+}
+
+func solarMinChange(cfg *PersistedConfig) float64 {
+	if cfg.SolarMinChange <= 0.0 {
+		return defaultSolarMinChange
+	}
+	return cfg.SolarMinChange
+}
+
+// Check looks at the current state and water temperature.  It returns true when a new fault
+// has been detected, along with the reason.
+func (w *SolarWatchdog) Check(cfg *PersistedConfig, state State, water, roof float64,
+	now time.Time) (bool, string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if state < SOLAR {
+		w.running = false
+		return false, ""
+	}
+	if !w.running {
+		w.running = true
+		w.restart(water, roof, now)
+		return false, ""
+	}
+	if w.fault || now.Sub(w.start) < solarCheckPeriod(cfg) {
+		return false, ""
+	}
+	startWater, startRoof, start := w.startWater, w.startRoof, w.start
+	w.restart(water, roof, now)
+
+	change := water - startWater
+	minChange := solarMinChange(cfg)
+	if startRoof > startWater && change < minChange {
+		w.setFault(now, "no heat gain after %s: water %0.2fC -> %0.2fC with roof at %0.2fC",
+			now.Sub(start).Round(time.Minute), startWater, water, startRoof)
+		return true, w.reason
+	}
+	if startRoof < startWater && -change < minChange {
+		w.setFault(now, "no cooling after %s: water %0.2fC -> %0.2fC with roof at %0.2fC",
+			now.Sub(start).Round(time.Minute), startWater, water, startRoof)
+		return true, w.reason
+	}
+	Debug("Solar check passed: water changed %0.2fC in %s", change, now.Sub(start))
+	return false, ""
+}
+
+// restart begins a new check period from the current temperatures
+func (w *SolarWatchdog) restart(water, roof float64, now time.Time) {
+	w.start = now
+	w.startWater = water
+	w.startRoof = roof
+}
+
+func (w *SolarWatchdog) setFault(now time.Time, format string, args ...interface{}) {
+	w.fault = true
+	w.faultTime = now
+	w.reason = fmt.Sprintf(format, args...)
+}
+
+// Fault returns true if solar is in a fault state, along with the reason
+func (w *SolarWatchdog) Fault() (bool, string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.fault, w.reason
+}
+
+// Acknowledge clears the fault so solar can run again
+func (w *SolarWatchdog) Acknowledge() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.fault {
+		Log("Solar fault acknowledged: %s", w.reason)
+	}
+	w.fault = false
+	w.reason = ""
+	w.running = false
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolarWatchdog(t *testing.T) {
+	cfg := &PersistedConfig{SolarCheckMinutes: 30, SolarMinChange: 0.2}
+	now := time.Now()
+
+	t.Run("HeatGain", func(t *testing.T) {
+		w := NewSolarWatchdog()
+		fault, _ := w.Check(cfg, SOLAR, 25.0, 45.0, now)
+		assert.False(t, fault)
+		fault, _ = w.Check(cfg, SOLAR, 25.1, 45.0, now.Add(10*time.Minute))
+		assert.False(t, fault, "Too early to check")
+		fault, _ = w.Check(cfg, SOLAR, 25.5, 45.0, now.Add(31*time.Minute))
+		assert.False(t, fault)
+		fault, _ = w.Check(cfg, SOLAR, 25.6, 45.0, now.Add(50*time.Minute))
+		assert.False(t, fault, "Too early for the next check")
+		fault, reason := w.Check(cfg, SOLAR, 25.6, 45.0, now.Add(62*time.Minute))
+		assert.True(t, fault, "Checked again while solar stays on")
+		assert.Contains(t, reason, "25.50C -> 25.60C")
+	})
+
+	t.Run("NoHeatGain", func(t *testing.T) {
+		w := NewSolarWatchdog()
+		w.Check(cfg, MIXING, 25.0, 45.0, now)
+		fault, reason := w.Check(cfg, MIXING, 25.1, 45.0, now.Add(31*time.Minute))
+		assert.True(t, fault)
+		assert.Contains(t, reason, "no heat gain")
+		fault, _ = w.Check(cfg, MIXING, 25.1, 45.0, now.Add(40*time.Minute))
+		assert.False(t, fault, "Fault should only be reported once")
+		latched, _ := w.Fault()
+		assert.True(t, latched)
+
+		w.Check(cfg, OFF, 25.1, 45.0, now.Add(50*time.Minute))
+		latched, _ = w.Fault()
+		assert.True(t, latched, "Fault should stay until acknowledged")
+		w.Acknowledge()
+		latched, _ = w.Fault()
+		assert.False(t, latched)
+	})
+
+	t.Run("NoCooling", func(t *testing.T) {
+		w := NewSolarWatchdog()
+		w.Check(cfg, SOLAR, 32.0, 15.0, now)
+		fault, reason := w.Check(cfg, SOLAR, 32.0, 15.0, now.Add(31*time.Minute))
+		assert.True(t, fault)
+		assert.Contains(t, reason, "no cooling")
+	})
+
+	t.Run("Restarts", func(t *testing.T) {
+		w := NewSolarWatchdog()
+		w.Check(cfg, SOLAR, 25.0, 45.0, now)
+		w.Check(cfg, PUMP, 25.0, 45.0, now.Add(5*time.Minute))
+		w.Check(cfg, SOLAR, 25.0, 45.0, now.Add(20*time.Minute))
+		fault, _ := w.Check(cfg, SOLAR, 25.0, 45.0, now.Add(40*time.Minute))
+		assert.False(t, fault, "Period restarts when solar is re-engaged")
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		empty := &PersistedConfig{}
+		assert.Equal(t, 45*time.Minute, solarCheckPeriod(empty))
+		assert.Equal(t, defaultSolarMinChange, solarMinChange(empty))
+	})
+}
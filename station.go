@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brutella/hc/accessory"
+)
+
+const (
+	// ProtocolEcowitt is the Ecowitt "customized" upload, a form POSTed to /data/report/
+	ProtocolEcowitt = "ecowitt"
+	// ProtocolWunderground is the Weather Underground upload, a GET of updateweatherstation.php
+	ProtocolWunderground = "wunderground"
+
+	// ecowittPath is the path Ecowitt stations are usually configured to upload to
+	ecowittPath = "/data/report/"
+	// wundergroundPath is the path of the Weather Underground upload
+	wundergroundPath = "/weatherstation/updateweatherstation.php"
+
+	// defaultStationStale is how long an upload is used, stations upload every minute or so
+	defaultStationStale = 5 * time.Minute
+	// stationTimeFormat is the layout of dateutc in the uploads
+	stationTimeFormat = "2006-01-02 15:04:05"
+
+	mmPerInch  = 25.4
+	mpsPerMile = 0.44704
+)
+
+// errStationCredentials is returned for uploads without the configured passkey or password
+var errStationCredentials = errors.New("bad credentials")
+
+// StationConfig describes the local weather station uploading to the controller
+type StationConfig struct {
+	Passkey  string  // Ecowitt PASSKEY or Weather Underground ID the station uploads with, required
+	Password string  // Weather Underground PASSWORD, empty accepts any
+	Stale    float64 // seconds an upload is used, 0 uses 300
+}
+
+// Observation is an upload from the weather station in metric units.  Measurements the
+// station doesn't have are nil.
+type Observation struct {
+	Time           time.Time
+	Protocol       string
+	Temperature    *float64 `json:",omitempty"` // outdoor, degrees celsius
+	Humidity       *float64 `json:",omitempty"` // outdoor, percent
+	SolarRadiation *float64 `json:",omitempty"` // W/m^2
+	UV             *float64 `json:",omitempty"` // UV index
+	RainRate       *float64 `json:",omitempty"` // mm per hour
+	DailyRain      *float64 `json:",omitempty"` // mm since midnight
+	WindSpeed      *float64 `json:",omitempty"` // meters per second
+	WindGust       *float64 `json:",omitempty"` // meters per second
+}
+
+// Raining returns true while the station measures rain falling
+func (o Observation) Raining() bool {
+	return o.RainRate != nil && *o.RainRate > 0.0
+}
+
+// formValue returns the first of the names present in the form, converted to metric
+func formValue(form url.Values, convert func(float64) float64, names ...string) (*float64, error) {
+	for _, name := range names {
+		str := form.Get(name)
+		if str == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s(%s): %w", name, str, err)
+		}
+		if value <= -9999.0 { // Weather Underground's marker for a missing measurement
+			return nil, nil
+		}
+		value = convert(value)
+		return &value, nil
+	}
+	return nil, nil
+}
+
+func same(v float64) float64       { return v }
+func inchesToMM(v float64) float64 { return v * mmPerInch }
+func mphToMPS(v float64) float64   { return v * mpsPerMile }
+
+// parseObservation reads an Ecowitt or Weather Underground upload, both use imperial units
+func parseObservation(protocol string, form url.Values, now time.Time) (Observation, error) {
+	obs := Observation{Time: now, Protocol: protocol}
+	if date := form.Get("dateutc"); date != "" && date != "now" {
+		t, err := time.ParseInLocation(stationTimeFormat, date, time.UTC)
+		if err != nil {
+			return obs, fmt.Errorf("bad dateutc(%s): %w", date, err)
+		}
+		obs.Time = t
+	}
+	rain := []string{"rainratein"}
+	if protocol == ProtocolWunderground {
+		rain = []string{"rainin"} // rain over the last hour
+	}
+	fields := []struct {
+		ptr     **float64
+		convert func(float64) float64
+		names   []string
+	}{
+		{&obs.Temperature, toCelsius, []string{"tempf"}},
+		{&obs.Humidity, same, []string{"humidity"}},
+		{&obs.SolarRadiation, same, []string{"solarradiation"}},
+		{&obs.UV, same, []string{"uv", "UV"}},
+		{&obs.RainRate, inchesToMM, rain},
+		{&obs.DailyRain, inchesToMM, []string{"dailyrainin"}},
+		{&obs.WindSpeed, mphToMPS, []string{"windspeedmph"}},
+		{&obs.WindGust, mphToMPS, []string{"windgustmph"}},
+	}
+	for _, f := range fields {
+		value, err := formValue(form, f.convert, f.names...)
+		if err != nil {
+			return obs, err
+		}
+		*f.ptr = value
+	}
+	return obs, nil
+}
+
+// WeatherStation keeps the last upload from a local weather station
+type WeatherStation struct {
+	mtx    sync.Mutex
+	config *Config
+	last   *Observation
+}
+
+// NewWeatherStation creates a WeatherStation, configured by config.cfg.Station
+func NewWeatherStation(config *Config) *WeatherStation {
+	return &WeatherStation{config: config}
+}
+
+// Configured returns true if a weather station is set up
+func (s *WeatherStation) Configured() bool {
+	return s.config.cfg.Station != nil
+}
+
+func (s *WeatherStation) stale() time.Duration {
+	return seconds(s.config.cfg.Station.Stale, defaultStationStale)
+}
+
+// Accept checks the credentials in an upload and records the observation
+func (s *WeatherStation) Accept(protocol string, form url.Values, now time.Time) error {
+	sc := s.config.cfg.Station
+	if sc == nil {
+		return errors.New("no weather station is configured")
+	}
+	if sc.Passkey == "" {
+		return fmt.Errorf("%w: no station passkey is configured", errStationCredentials)
+	}
+	key := form.Get("PASSKEY")
+	if protocol == ProtocolWunderground {
+		key = form.Get("ID")
+		if sc.Password != "" && form.Get("PASSWORD") != sc.Password {
+			return fmt.Errorf("%w: wrong password", errStationCredentials)
+		}
+	}
+	if key != sc.Passkey {
+		return fmt.Errorf("%w: unknown station %q", errStationCredentials, key)
+	}
+	obs, err := parseObservation(protocol, form, now)
+	if err != nil {
+		return err
+	}
+	if obs.Time.After(now.Add(remoteMaxSkew)) {
+		return fmt.Errorf("observation at %s is in the future", obs.Time.Format(time.RFC3339))
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.last = &obs
+	return nil
+}
+
+// Last returns the last observation, false if there is none or it is stale
+func (s *WeatherStation) Last(now time.Time) (Observation, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.last == nil || !s.Configured() || now.Sub(s.last.Time) > s.stale() {
+		return Observation{}, false
+	}
+	return *s.last, true
+}
+
+// StationThermometer is the outdoor temperature uploaded by the weather station
+type StationThermometer struct {
+	name      string
+	station   *WeatherStation
+	accessory *accessory.Thermometer
+}
+
+// NewStationThermometer creates a StationThermometer
+func NewStationThermometer(name, manufacturer string, station *WeatherStation) *StationThermometer {
+	acc := accessory.NewTemperatureSensor(AccessoryInfo(name, manufacturer), 0.0, -20.0, 100.0, 1.0)
+	return &StationThermometer{name: name, station: station, accessory: acc}
+}
+
+// Name returns the name of the StationThermometer
+func (t *StationThermometer) Name() string {
+	return t.name
+}
+
+// Accessory returns the Apple HomeKit accessory related to the StationThermometer
+func (t *StationThermometer) Accessory() *accessory.Accessory {
+	return t.accessory.Accessory
+}
+
+// Calibrate is not supported, the station reports temperatures directly
+func (t *StationThermometer) Calibrate(a float64) error {
+	return errors.New("not supported")
+}
+
+// Temperature returns the last outdoor temperature
+func (t *StationThermometer) Temperature() float64 {
+	return t.accessory.TempSensor.CurrentTemperature.GetValue()
+}
+
+// Update takes the temperature from the last upload, failing if it is stale
+func (t *StationThermometer) Update() error {
+	obs, ok := t.station.Last(time.Now())
+	if !ok {
+		return fmt.Errorf("%s: no recent upload from the weather station", t.name)
+	}
+	if obs.Temperature == nil {
+		return fmt.Errorf("%s: the weather station doesn't report the temperature", t.name)
+	}
+	t.accessory.TempSensor.CurrentTemperature.SetValue(*obs.Temperature)
+	return nil
+}
+
+// StationIrradiance is the solar radiation uploaded by the weather station
+type StationIrradiance struct {
+	station *WeatherStation
+}
+
+// Name describes the StationIrradiance
+func (p *StationIrradiance) Name() string {
+	return "Weather station"
+}
+
+// Irradiance returns the solar radiation from the last upload
+func (p *StationIrradiance) Irradiance(now time.Time) (float64, error) {
+	obs, ok := p.station.Last(now)
+	if !ok {
+		return 0.0, errors.New("no recent upload")
+	}
+	if obs.SolarRadiation == nil {
+		return 0.0, errors.New("the station doesn't report solar radiation")
+	}
+	return *obs.SolarRadiation, nil
+}
+
+// stationRrdValues formats the observation for the weather RRD, "U" for what is unknown
+func stationRrdValues(obs Observation, ok bool) string {
+	values := []string{}
+	for _, v := range []*float64{obs.Temperature, obs.SolarRadiation, obs.UV, obs.RainRate,
+		obs.WindSpeed, obs.WindGust} {
+		if !ok || v == nil {
+			values = append(values, "U")
+		} else {
+			values = append(values, fmt.Sprintf("%f", *v))
+		}
+	}
+	return strings.Join(values, ":")
+}
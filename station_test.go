@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ecowittUpload = "PASSKEY=ABCDEF0123456789&stationtype=GW1000B_V1.6.8&dateutc=2021-06-21+19:00:00" +
+		"&tempf=77.0&humidity=40&solarradiation=812.5&uv=7&rainratein=0.000&dailyrainin=0.020" +
+		"&windspeedmph=4.5&windgustmph=8.1"
+	wundergroundUpload = "ID=KCASANJO1&PASSWORD=secret&action=updateraw&dateutc=now" +
+		"&tempf=50.0&rainin=0.1&UV=-9999&windspeedmph=10"
+)
+
+func TestParseObservation(t *testing.T) {
+	now := time.Date(2021, time.June, 21, 19, 1, 0, 0, time.UTC)
+	t.Run("Ecowitt", func(t *testing.T) {
+		form, _ := url.ParseQuery(ecowittUpload)
+		obs, err := parseObservation(ProtocolEcowitt, form, now)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(-time.Minute), obs.Time)
+		assert.InDelta(t, 25.0, *obs.Temperature, 0.001)
+		assert.Equal(t, 812.5, *obs.SolarRadiation)
+		assert.Equal(t, 7.0, *obs.UV)
+		assert.False(t, obs.Raining())
+		assert.InDelta(t, 0.508, *obs.DailyRain, 0.001)
+		assert.InDelta(t, 2.01168, *obs.WindSpeed, 0.0001)
+		assert.Equal(t, "25.000000:812.500000:7.000000:0.000000:2.011680:3.621024", stationRrdValues(obs, true))
+	})
+
+	t.Run("Weather Underground", func(t *testing.T) {
+		form, _ := url.ParseQuery(wundergroundUpload)
+		obs, err := parseObservation(ProtocolWunderground, form, now)
+		assert.NoError(t, err)
+		assert.Equal(t, now, obs.Time)
+		assert.InDelta(t, 10.0, *obs.Temperature, 0.001)
+		assert.True(t, obs.Raining())
+		assert.Nil(t, obs.UV, "Missing measurement")
+		assert.Nil(t, obs.SolarRadiation)
+		assert.Equal(t, "10.000000:U:U:2.540000:4.470400:U", stationRrdValues(obs, true))
+		assert.Equal(t, "U:U:U:U:U:U", stationRrdValues(obs, false))
+	})
+
+	t.Run("Bad Values", func(t *testing.T) {
+		_, err := parseObservation(ProtocolEcowitt, url.Values{"tempf": {"warm"}}, now)
+		assert.Error(t, err)
+		_, err = parseObservation(ProtocolEcowitt, url.Values{"dateutc": {"yesterday"}}, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestWeatherStation(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	config := trp.ppc.config
+	station := config.station
+	defer func() { config.cfg.Station = nil }()
+	now := time.Now()
+	form, _ := url.ParseQuery(wundergroundUpload)
+
+	assert.Error(t, station.Accept(ProtocolWunderground, form, now), "Not configured")
+	config.cfg.Station = &StationConfig{Passkey: "KCASANJO1", Password: "secret", Stale: 60}
+	assert.NoError(t, station.Accept(ProtocolWunderground, form, now))
+	obs, ok := station.Last(now)
+	assert.True(t, ok)
+	assert.InDelta(t, 10.0, *obs.Temperature, 0.001)
+	_, ok = station.Last(now.Add(2 * time.Minute))
+	assert.False(t, ok, "Stale")
+
+	form.Set("PASSWORD", "guess")
+	assert.ErrorIs(t, station.Accept(ProtocolWunderground, form, now), errStationCredentials)
+	form, _ = url.ParseQuery(ecowittUpload)
+	assert.ErrorIs(t, station.Accept(ProtocolEcowitt, form, now), errStationCredentials)
+
+	t.Run("Controller Inputs", func(t *testing.T) {
+		therm := NewStationThermometer("Air", mftr, station)
+		assert.NoError(t, therm.Update())
+		assert.InDelta(t, 10.0, therm.Temperature(), 0.001)
+
+		p, err := NewIrradianceProvider(&IrradianceConfig{Type: IrradianceStation}, station)
+		assert.NoError(t, err)
+		_, err = p.Irradiance(now)
+		assert.Error(t, err, "No solar radiation in the upload")
+
+		assert.False(t, trp.ppc.solarPlausible(), "Raining")
+	})
+}
+
+func TestWeatherHandler(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	defer func() { trp.ppc.config.cfg.Station = nil }()
+	h := stationHandler{&Handler{ppc: trp.ppc}}
+	upload := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", ecowittPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	now := time.Now().UTC().Format(stationTimeFormat)
+	body := strings.Replace(ecowittUpload, "2021-06-21+19:00:00", url.QueryEscape(now), 1)
+	assert.Equal(t, 404, upload(body).Code, "Not configured")
+
+	trp.ppc.config.cfg.Station = &StationConfig{}
+	assert.Equal(t, 403, upload(body).Code, "A passkey is required")
+	trp.ppc.config.cfg.Station = &StationConfig{Passkey: "ABCDEF0123456789"}
+	assert.Equal(t, 403, upload(strings.Replace(body, "ABCDEF", "FEDCBA", 1)).Code)
+	assert.Equal(t, 400, upload(strings.Replace(body, "tempf=77.0", "tempf=hot", 1)).Code)
+	w := upload(body)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "success\n", w.Body.String())
+	obs, ok := trp.ppc.config.station.Last(time.Now())
+	assert.True(t, ok)
+	assert.Equal(t, 812.5, *obs.SolarRadiation)
+	assert.Equal(t, 812.5, *trp.ppc.StatusReport().Weather.SolarRadiation)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	assert.Equal(t, 404, w.Code, "Only uploads are served without TLS")
+	w = httptest.NewRecorder()
+	h.h.ServeHTTP(w, httptest.NewRequest("POST", ecowittPath, strings.NewReader(body)))
+	assert.Equal(t, 404, w.Code, "Uploads are only served on the weather port")
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", wundergroundPath+"?ID=KCASANJO1&dateutc=now&tempf=50", nil)
+	h.ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+}
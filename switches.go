@@ -51,6 +51,9 @@ type Switches struct {
 	sweep    *Relay
 	solar    *SolarValve
 	manualOp time.Time
+	manual   bool // the last change to the switches was a manual one
+	// interlock, when set, returns true while the pumps are not allowed to start
+	interlock func() (bool, string)
 }
 
 func (p *Switches) String() string {
@@ -181,6 +184,7 @@ func (p *Switches) setSwitches(pumpOn, sweepOn, solarOn, isManual bool, state St
 	turnOn(p.pump, pumpOn)
 	turnOn(p.sweep, sweepOn)
 	turnOn(p.solar, solarOn) // deal with solar valve last because it takes time
+	p.manual = isManual
 	if isManual {
 		if p.GetStartTime().After(p.GetStopTime()) {
 			p.manualOp = p.GetStartTime()
@@ -210,6 +214,12 @@ func (p *Switches) SetState(s State, manual bool, runtime float64) {
 			p.state, s)
 		return
 	}
+	if s > OFF && p.interlock != nil {
+		if locked, reason := p.interlock(); locked {
+			Info("Interlocked, can't change state from %s to %s: %s", p.state, s, reason)
+			return
+		}
+	}
 	if p.ManualState(runtime) && !manual {
 		Debug("Manual override, can't change state from %s to %s", p.state, s)
 		return // Don't override a manual operation
@@ -242,6 +252,20 @@ func (p *Switches) State() State {
 	return p.state
 }
 
+// Cause describes why the switches are in their current State, used for energy accounting
+func (p *Switches) Cause() string {
+	if p.manual {
+		return CauseManual
+	}
+	switch p.state {
+	case SOLAR, MIXING:
+		return CauseSolar
+	case SWEEP:
+		return CauseSweep
+	}
+	return CauseSchedule
+}
+
 // DurationFromHours converts a given number of hours to a duration.  If hours < minHours,
 // the duration of minHours is returned
 func DurationFromHours(hours float64, minHours float64) time.Duration {
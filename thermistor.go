@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// kelvin is 0 degrees Celsius in Kelvin
+	kelvin = 273.15
+
+	// ModelLegacy is the 4 parameter curve fit for the original probes
+	ModelLegacy = "legacy"
+	// ModelBeta is the Beta (B parameter) equation
+	ModelBeta = "beta"
+	// ModelSteinhartHart is the Steinhart-Hart equation
+	ModelSteinhartHart = "steinhart-hart"
+	// ModelTable interpolates a resistance/temperature table from a data sheet
+	ModelTable = "table"
+)
+
+// ThermistorModel converts the resistance of a thermistor into a temperature in Celsius
+type ThermistorModel interface {
+	Temperature(ohms float64) float64
+}
+
+// LegacyModel is the curve fit to the probes the controller was built with
+type LegacyModel struct{}
+
+// Temperature returns the temperature for a given resistance
+func (m LegacyModel) Temperature(ohms float64) float64 {
+	const a = 79463.85
+	const b = 0.1453676
+	const c = 2.517178e-15
+	const d = -132.2399
+	if ohms == 0.0 {
+		return 0.0
+	}
+	return d + (a-d)/(1+math.Pow(ohms/c, b))
+}
+
+// BetaModel is an NTC thermistor described by its resistance R0 at T0 (Celsius) and its
+// B value, ex. 10k 3950.
+type BetaModel struct {
+	R0   float64
+	T0   float64
+	Beta float64
+}
+
+// Temperature returns the temperature for a given resistance
+func (m BetaModel) Temperature(ohms float64) float64 {
+	if ohms <= 0.0 {
+		return 0.0
+	}
+	inv := 1.0/(m.T0+kelvin) + math.Log(ohms/m.R0)/m.Beta
+	return 1.0/inv - kelvin
+}
+
+// SteinhartHartModel is a thermistor described by its Steinhart-Hart coefficients
+type SteinhartHartModel struct {
+	A float64
+	B float64
+	C float64
+}
+
+// Temperature returns the temperature for a given resistance
+func (m SteinhartHartModel) Temperature(ohms float64) float64 {
+	if ohms <= 0.0 {
+		return 0.0
+	}
+	ln := math.Log(ohms)
+	return 1.0/(m.A+m.B*ln+m.C*ln*ln*ln) - kelvin
+}
+
+// ThermistorPoint is a single entry of a resistance/temperature table
+type ThermistorPoint struct {
+	Ohms    float64
+	Celsius float64
+}
+
+// TableModel linearly interpolates between the points of a resistance/temperature table,
+// readings outside the table are extrapolated from the nearest two points.
+type TableModel struct {
+	points []ThermistorPoint
+}
+
+// NewTableModel creates a TableModel, the points can be in any order
+func NewTableModel(points []ThermistorPoint) (*TableModel, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("a thermistor table needs at least 2 points, found %d", len(points))
+	}
+	p := append([]ThermistorPoint(nil), points...)
+	sort.Slice(p, func(i, j int) bool { return p[i].Ohms < p[j].Ohms })
+	for i := 1; i < len(p); i++ {
+		if p[i].Ohms == p[i-1].Ohms {
+			return nil, fmt.Errorf("duplicate thermistor table entry for %0.1f ohms", p[i].Ohms)
+		}
+	}
+	return &TableModel{points: p}, nil
+}
+
+// Temperature returns the temperature for a given resistance
+func (m *TableModel) Temperature(ohms float64) float64 {
+	i := sort.Search(len(m.points), func(i int) bool { return m.points[i].Ohms >= ohms })
+	if i == 0 {
+		i = 1
+	} else if i == len(m.points) {
+		i = len(m.points) - 1
+	}
+	lo, hi := m.points[i-1], m.points[i]
+	return lo.Celsius + (ohms-lo.Ohms)*(hi.Celsius-lo.Celsius)/(hi.Ohms-lo.Ohms)
+}
+
+// ThermistorConfig selects the ThermistorModel for a probe, either by part number from the
+// built in library or by providing the parameters of a model.
+type ThermistorConfig struct {
+	Part  string            // part number from thermistorLibrary, overrides the fields below
+	Model string            // ModelLegacy, ModelBeta, ModelSteinhartHart, ModelTable
+	R0    float64           // ModelBeta resistance at T0
+	T0    float64           // ModelBeta reference temperature, 0 uses 25C
+	Beta  float64           // ModelBeta B value
+	A     float64           // ModelSteinhartHart coefficients
+	B     float64           //
+	C     float64           //
+	Table []ThermistorPoint // ModelTable entries
+}
+
+// thermistorLibrary holds the models of common pool sensor probes, by part number
+var thermistorLibrary = map[string]ThermistorConfig{
+	"legacy":        {Model: ModelLegacy},
+	"10K3A":         {Model: ModelSteinhartHart, A: 1.129148e-3, B: 2.34125e-4, C: 8.76741e-8},
+	"NTC-10K-3950":  {Model: ModelBeta, R0: 10000, T0: 25, Beta: 3950},
+	"NTC-10K-3435":  {Model: ModelBeta, R0: 10000, T0: 25, Beta: 3435},
+	"NTC-100K-3950": {Model: ModelBeta, R0: 100000, T0: 25, Beta: 3950},
+}
+
+// ThermistorParts returns the part numbers in the built in library
+func ThermistorParts() []string {
+	parts := []string{}
+	for p := range thermistorLibrary {
+		parts = append(parts, p)
+	}
+	sort.Strings(parts)
+	return parts
+}
+
+// NewThermistorModel creates the ThermistorModel described by the configuration, a nil
+// configuration uses the legacy curve.
+func NewThermistorModel(tc *ThermistorConfig) (ThermistorModel, error) {
+	if tc == nil {
+		return LegacyModel{}, nil
+	}
+	if tc.Part != "" {
+		lib, ok := thermistorLibrary[tc.Part]
+		if !ok {
+			return nil, fmt.Errorf("unknown thermistor part number %q", tc.Part)
+		}
+		tc = &lib
+	}
+	switch tc.Model {
+	case ModelLegacy, "":
+		return LegacyModel{}, nil
+	case ModelBeta:
+		if tc.R0 <= 0.0 || tc.Beta <= 0.0 {
+			return nil, fmt.Errorf("beta model needs R0(%0.1f) and Beta(%0.1f)", tc.R0, tc.Beta)
+		}
+		t0 := tc.T0
+		if t0 == 0.0 {
+			t0 = 25.0
+		}
+		return BetaModel{R0: tc.R0, T0: t0, Beta: tc.Beta}, nil
+	case ModelSteinhartHart:
+		if tc.A == 0.0 || tc.B == 0.0 {
+			return nil, fmt.Errorf("steinhart-hart model needs A and B coefficients")
+		}
+		return SteinhartHartModel{A: tc.A, B: tc.B, C: tc.C}, nil
+	case ModelTable:
+		return NewTableModel(tc.Table)
+	}
+	return nil, fmt.Errorf("unknown thermistor model %q", tc.Model)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThermistorModels(t *testing.T) {
+	t.Run("Legacy", func(t *testing.T) {
+		therm := newGpioThermometer("Test", mftr, &TestPin{})
+		assert.Equal(t, LegacyModel{}, therm.model)
+		assert.Equal(t, 0.0, LegacyModel{}.Temperature(0.0))
+	})
+
+	t.Run("Beta", func(t *testing.T) {
+		m := BetaModel{R0: 10000, T0: 25, Beta: 3950}
+		assert.InDelta(t, 25.0, m.Temperature(10000), 0.0001)
+		assert.InDelta(t, 0.0, m.Temperature(33620), 0.01)
+		assert.InDelta(t, 50.0, m.Temperature(3588), 0.05)
+	})
+
+	t.Run("SteinhartHart", func(t *testing.T) {
+		m := SteinhartHartModel{A: 1.129148e-3, B: 2.34125e-4, C: 8.76741e-8}
+		assert.InDelta(t, 25.0, m.Temperature(10000), 0.01)
+		assert.InDelta(t, 0.0, m.Temperature(32650), 0.05)
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		m, err := NewTableModel([]ThermistorPoint{
+			{Ohms: 10000, Celsius: 25},
+			{Ohms: 32650, Celsius: 0},
+			{Ohms: 3602, Celsius: 50},
+		})
+		assert.NoError(t, err)
+		assert.InDelta(t, 25.0, m.Temperature(10000), 0.0001)
+		assert.InDelta(t, 12.5, m.Temperature(21325), 0.0001)
+		assert.InDelta(t, 37.5, m.Temperature(6801), 0.0001)
+		assert.True(t, m.Temperature(40000) < 0.0, "Extrapolates below the table")
+
+		_, err = NewTableModel([]ThermistorPoint{{Ohms: 10000, Celsius: 25}})
+		assert.Error(t, err)
+		_, err = NewTableModel([]ThermistorPoint{{Ohms: 10000, Celsius: 25}, {Ohms: 10000, Celsius: 20}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		m, err := NewThermistorModel(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, LegacyModel{}, m)
+
+		m, err = NewThermistorModel(&ThermistorConfig{Part: "NTC-10K-3950"})
+		assert.NoError(t, err)
+		assert.Equal(t, BetaModel{R0: 10000, T0: 25, Beta: 3950}, m)
+
+		m, err = NewThermistorModel(&ThermistorConfig{Model: ModelBeta, R0: 10000, Beta: 3435})
+		assert.NoError(t, err)
+		assert.Equal(t, BetaModel{R0: 10000, T0: 25, Beta: 3435}, m, "T0 defaults to 25C")
+
+		_, err = NewThermistorModel(&ThermistorConfig{Part: "bogus"})
+		assert.Error(t, err)
+		_, err = NewThermistorModel(&ThermistorConfig{Model: ModelBeta})
+		assert.Error(t, err)
+		_, err = NewThermistorModel(&ThermistorConfig{Model: "bogus"})
+		assert.Error(t, err)
+
+		for _, part := range ThermistorParts() {
+			m, err := NewThermistorModel(&ThermistorConfig{Part: part})
+			assert.NoError(t, err, part)
+			assert.NotNil(t, m, part)
+		}
+	})
+}
@@ -86,6 +86,7 @@ type GpioThermometer struct {
 	pin         PiPin
 	microfarads float64
 	adjust      float64
+	model       ThermistorModel
 	updated     time.Time
 	history     History
 	accessory   *accessory.Thermometer
@@ -117,6 +118,7 @@ func newGpioThermometer(name string, manufacturer string, pin PiPin) *GpioThermo
 		pin:         pin,
 		microfarads: float64(nanoFarads) / 1000.0,
 		adjust:      2.5,
+		model:       LegacyModel{},
 		history:     *NewHistory(100),
 		updated:     time.Now().Add(-24 * time.Hour),
 		accessory:   acc,
@@ -129,6 +131,11 @@ func (t *GpioThermometer) SetAdjustment(a float64) {
 	t.adjust = a
 }
 
+// SetModel changes the ThermistorModel used to convert resistance to temperature
+func (t *GpioThermometer) SetModel(m ThermistorModel) {
+	t.model = m
+}
+
 // Name returns the name of the GpioThermometer
 func (t *GpioThermometer) Name() string {
 	return t.name
@@ -162,14 +169,7 @@ func (t *GpioThermometer) getDischargeTime() time.Duration {
 }
 
 func (t *GpioThermometer) getTemp(ohms float64) float64 {
-	const a = 79463.85
-	const b = 0.1453676
-	const c = 2.517178e-15
-	const d = -132.2399
-	if ohms == 0.0 {
-		return 0.0
-	}
-	return d + (a-d)/(1+math.Pow(ohms/c, b))
+	return t.model.Temperature(ohms)
 }
 
 func (t *GpioThermometer) getOhms(dischargeTime time.Duration) float64 {
@@ -213,9 +213,6 @@ func (t *GpioThermometer) inRange(dischargeTime time.Duration) bool {
 
 // Temperature returns the current temperature of the GpioThermometer
 func (t *GpioThermometer) Temperature() float64 {
-	if time.Now().After(t.updated.Add(time.Minute)) {
-		t.Update()
-	}
 	return t.accessory.TempSensor.CurrentTemperature.GetValue()
 }
 
@@ -259,3 +256,8 @@ func (t *GpioThermometer) Update() error {
 func toFarenheit(celsius float64) float64 {
 	return (celsius * 9.0 / 5.0) + 32.0
 }
+
+// Converts a temperature in Farenheit to Celsius
+func toCelsius(farenheit float64) float64 {
+	return (farenheit - 32.0) * 5.0 / 9.0
+}
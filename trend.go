@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// trendWindow is how much of the pool temperature history the trend is computed over
+	trendWindow = 30 * time.Minute
+	// trendMinSpan is the least history needed before the trend is trusted
+	trendMinSpan = 10 * time.Minute
+	// trendTau is the time constant of the smoothed pool temperature
+	trendTau = 5 * time.Minute
+	// trendSteady is the slope (degrees per hour) below which the pool is called steady
+	trendSteady = 0.05
+
+	defaultCoastMinutes = 20.0
+)
+
+// Trend summarizes the recent pool temperature
+type Trend struct {
+	Slope   float64 // degrees celsius per hour
+	EWMA    float64
+	Min     float64
+	Max     float64
+	P10     float64
+	Median  float64
+	P90     float64
+	Samples int
+	Valid   bool // there is enough history to trust the slope
+}
+
+// String describes the trend, ex. "warming at 0.40°C/h"
+func (t Trend) String() string {
+	switch {
+	case !t.Valid:
+		return "unknown"
+	case math.Abs(t.Slope) < trendSteady:
+		return "steady"
+	case t.Slope > 0.0:
+		return fmt.Sprintf("warming at %0.2f°C/h", t.Slope)
+	}
+	return fmt.Sprintf("cooling at %0.2f°C/h", -t.Slope)
+}
+
+// RecordTrend adds the pool temperature to the trend history.  The pump probe only follows
+// the pool while the water is moving, a probe in the pool is always recorded.
+func (ppc *PoolPumpController) RecordTrend(now time.Time) {
+	if water, ok := ppc.poolWater(); ok {
+		ppc.trend.Push(water, now)
+	}
+}
+
+// PoolTrend returns the statistics of the recent pool temperature
+func (ppc *PoolPumpController) PoolTrend() Trend {
+	h := ppc.trend
+	return Trend{
+		Slope:   h.Slope(),
+		EWMA:    h.EWMA(trendTau),
+		Min:     h.Min(),
+		Max:     h.Max(),
+		P10:     h.Percentile(10.0),
+		Median:  h.Percentile(50.0),
+		P90:     h.Percentile(90.0),
+		Samples: h.Len(),
+		Valid:   h.Span() >= trendMinSpan,
+	}
+}
+
+func coastMinutes(cfg *PersistedConfig) float64 {
+	if cfg.CoastMinutes == 0.0 {
+		return defaultCoastMinutes
+	}
+	return cfg.CoastMinutes
+}
+
+// shouldCoast returns true when solar heating can stop early, rather than run out the hour
+// and overshoot the target
+func (ppc *PoolPumpController) shouldCoast() bool {
+	return coastWanted(ppc.config.cfg, ppc.conditions(time.Now()), ppc.switches.State())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrend(t *testing.T) {
+	assert.Equal(t, "unknown", Trend{Slope: 1.0}.String())
+	assert.Equal(t, "steady", Trend{Slope: 0.01, Valid: true}.String())
+	assert.Equal(t, "warming at 0.40°C/h", Trend{Slope: 0.4, Valid: true}.String())
+	assert.Equal(t, "cooling at 0.25°C/h", Trend{Slope: -0.25, Valid: true}.String())
+
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 25.0, 50.0, 33.0, OFF)
+	now := time.Now()
+	trp.ppc.RecordTrend(now)
+	assert.Equal(t, 0, trp.ppc.PoolTrend().Samples, "Not recorded while the water is still")
+
+	trp.ppc.switches.state = SOLAR
+	for i := 0; i <= 20; i++ {
+		trp.pumpTemp.temp = 29.4 + float64(i)*0.02
+		trp.ppc.RecordTrend(now.Add(time.Duration(i) * time.Minute))
+	}
+	trend := trp.ppc.PoolTrend()
+	assert.True(t, trend.Valid)
+	assert.InDelta(t, 1.2, trend.Slope, 0.0001)
+	assert.Equal(t, 21, trend.Samples)
+	assert.True(t, trp.ppc.shouldCoast(), "29.8 + 1.2°C/h for 20 minutes passes the target")
+
+	trp.ppc.config.cfg.CoastMinutes = 5.0
+	assert.False(t, trp.ppc.shouldCoast())
+	trp.ppc.config.cfg.CoastMinutes = 0.0
+
+	trp.ppc.switches.state = PUMP
+	assert.False(t, trp.ppc.shouldCoast(), "Only while heating")
+}
+
+func TestStatusJSON(t *testing.T) {
+	SetGpioProvider(NewTestPin)
+	trp := NewTestRunPumps()
+	trp.setConditions(30.0, 25.0, 50.0, 33.0, OFF)
+	h := Handler{ppc: trp.ppc}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/status.json", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var report map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 50.0, report["Roof"])
+	assert.Equal(t, "unknown", report["TrendText"])
+	assert.NotContains(t, report, "Air", "No air sensor")
+	assert.Contains(t, report["Trend"], "Slope")
+}